@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/spf13/pflag"
+)
+
+func fmtMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	write := fs.BoolP("write", "w", false, "Write the result to the dictfile instead of stdout")
+	list := fs.BoolP("list", "l", false, "List the dictfiles which aren't formatted instead of writing the result")
+	check := fs.Bool("check", false, "Don't write anything, but exit with status 1 if any dictfile isn't formatted or has lint warnings (for CI)")
+	noLint := fs.Bool("no-lint", false, "Don't show lint warnings")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictfile...\n\nOptions:\n%s\nFormats dictfiles canonically, keeping comments, include directives (included files are not formatted), and Markdown as-is. To read from stdin, use - as the filename.\n\nLint warnings are shown for trailing whitespace (other than Markdown hard line breaks), variants which are the same as the headword, and raw HTML definitions which could be written in Markdown.\n\nErrors and warnings are shown as file:line: message.\n", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	if *write && *check {
+		fmt.Fprintf(os.Stderr, "Error: --write and --check are mutually exclusive.\n")
+		return 2
+	}
+
+	var failed, unformatted, warned bool
+	for _, fn := range fs.Args() {
+		if fn == "-" && *write {
+			fmt.Fprintf(os.Stderr, "Error: cannot use --write with stdin.\n")
+			return 2
+		}
+
+		var buf []byte
+		var err error
+		if fn == "-" {
+			buf, err = io.ReadAll(os.Stdin)
+		} else {
+			buf, err = os.ReadFile(fn)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: read %s: %v.\n", fn, err)
+			failed = true
+			continue
+		}
+
+		name := fn
+		if fn == "-" {
+			name = "<stdin>"
+		}
+
+		out := bytes.NewBuffer(nil)
+		if err := dictgen.FormatDictFile(out, bytes.NewReader(buf), name); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+			continue
+		}
+
+		if !*noLint {
+			warns, err := dictgen.LintDictFile(bytes.NewReader(buf), name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				failed = true
+				continue
+			}
+			for _, w := range warns {
+				fmt.Fprintf(os.Stderr, "%v\n", w)
+			}
+			warned = warned || len(warns) != 0
+		}
+
+		changed := !bytes.Equal(buf, out.Bytes())
+		unformatted = unformatted || changed
+
+		switch {
+		case *check:
+			if changed {
+				fmt.Fprintf(os.Stderr, "%s: not formatted\n", name)
+			}
+		case *list:
+			if changed {
+				fmt.Println(name)
+			}
+		case *write:
+			if changed {
+				if err := os.WriteFile(fn, out.Bytes(), 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: write %s: %v.\n", fn, err)
+					failed = true
+				}
+			}
+		default:
+			os.Stdout.Write(out.Bytes())
+		}
+	}
+
+	if failed || (*check && (unformatted || warned)) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/spf13/pflag"
+)
+
+func lspMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	prefix := fs.StringP("prefix", "P", "v2", "The prefix algorithm to show in hovers if not specified by the dictfile header (see dictgen --help)")
+	markdown := fs.StringP("markdown", "M", "blackfriday", "The Markdown renderer to use for previews (see dictgen --help)")
+	tmpl := fs.String("template", "", "Use a custom Go text/template for previews (see dictgen --help)")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\nOptions:\n%s\nRuns a Language Server Protocol server for dictfiles over stdin/stdout. It should be started by your editor for *.df files.\n\nIt provides diagnostics (syntax errors, validation errors, dangling cross-references, and lint warnings), hover text with the prefix and a preview of the entry (or the target of a cross-reference), go-to-definition for cross-references and include directives, and completion of headwords for cross-references.\n\nCross-references are resolved using all open dictfiles and the files they include.\n", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	if _, err := kobodict.ParsePrefixFunc(*prefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --prefix, see --help for details.\n")
+		return 2
+	}
+
+	var ho dictgen.KoboHTMLOptions
+	if *tmpl != "" {
+		buf, err := ioutil.ReadFile(*tmpl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			return 2
+		}
+		if ho.Template, err = dictgen.ParseEntryTemplate(string(buf)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			return 2
+		}
+	}
+
+	if *markdown != "blackfriday" {
+		var err error
+		if ho.Renderer, err = dictgen.ParseRenderer(*markdown); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --markdown: %v.\n", err)
+			return 2
+		}
+	}
+
+	l := &lspServer{
+		w:      os.Stdout,
+		prefix: *prefix,
+		ho:     &ho,
+		docs:   map[string]*lspDoc{},
+	}
+	if err := l.Serve(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		return 1
+	}
+	if !l.shutdown {
+		return 1
+	}
+	return 0
+}
+
+// lspServer is a minimal Language Server Protocol server for dictfiles. It only
+// supports full document synchronization, and handles messages sequentially.
+type lspServer struct {
+	w      io.Writer
+	prefix string
+	ho     *dictgen.KoboHTMLOptions
+
+	docs     map[string]*lspDoc // by uri
+	words    map[string]bool    // normalized headwords and variants in the index
+	shutdown bool
+}
+
+// lspDoc is an open dictfile.
+type lspDoc struct {
+	URI  string
+	Path string // empty if not a file
+	Text string
+
+	Entries []*dictgen.DictFileEntry // including the ones from included files
+	Header  *dictgen.DictFileHeader
+	Err     error // the syntax error, if any
+
+	errs  []error // syntax and validation errors
+	warns []error // lint warnings
+
+	published []string // the uris diagnostics were last published to
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return e.Message
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"` // utf-16 code units
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"` // 1 - error, 2 - warning
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+// Serve reads and handles messages until the exit notification is received.
+func (l *lspServer) Serve(r io.Reader) error {
+	tr := textproto.NewReader(bufio.NewReader(r))
+	for {
+		hdr, err := tr.ReadMIMEHeader()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read message header: %w", err)
+		}
+
+		n, err := strconv.Atoi(hdr.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("read message header: invalid content length: %w", err)
+		}
+
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(tr.R, buf); err != nil {
+			return fmt.Errorf("read message: %w", err)
+		}
+
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(buf, &msg); err != nil {
+			return fmt.Errorf("decode message: %w", err)
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		res, err := l.handle(msg.Method, msg.Params)
+		if len(msg.ID) == 0 || msg.Method == "" {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: handle %s: %v.\n", msg.Method, err)
+			}
+			continue // notification (or a response, which we don't need)
+		}
+
+		resp := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      msg.ID,
+		}
+		if err != nil {
+			var le *lspError
+			if !errors.As(err, &le) {
+				le = &lspError{-32603, err.Error()}
+			}
+			resp["error"] = le
+		} else {
+			resp["result"] = res
+		}
+		if err := l.send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *lspServer) send(msg interface{}) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+	if _, err := fmt.Fprintf(l.w, "Content-Length: %d\r\n\r\n%s", len(buf), buf); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	return nil
+}
+
+func (l *lspServer) notify(method string, params interface{}) error {
+	return l.send(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (l *lspServer) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    1, // full
+					"save":      true,
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"["},
+				},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "dictgen",
+				"version": version,
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		l.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc := &lspDoc{URI: p.TextDocument.URI, Text: p.TextDocument.Text}
+		if fn, err := lspURIPath(doc.URI); err == nil {
+			doc.Path = fn
+		}
+		l.docs[doc.URI] = doc
+		l.parse(doc)
+		return nil, l.update(doc)
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		doc, ok := l.docs[p.TextDocument.URI]
+		if !ok || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.Text = p.ContentChanges[len(p.ContentChanges)-1].Text
+		l.parse(doc)
+		return nil, l.update(doc)
+	case "textDocument/didSave":
+		// included files may have changed
+		for _, doc := range l.docs {
+			l.parse(doc)
+		}
+		l.reindex()
+		return nil, l.publishAll()
+	case "textDocument/didClose":
+		var p lspTextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if doc, ok := l.docs[p.TextDocument.URI]; ok {
+			delete(l.docs, doc.URI)
+			for _, uri := range doc.published {
+				if err := l.notify("textDocument/publishDiagnostics", map[string]interface{}{
+					"uri":         uri,
+					"diagnostics": []lspDiagnostic{},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, l.update(nil)
+	case "textDocument/hover":
+		var p lspTextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return l.hover(p)
+	case "textDocument/definition":
+		var p lspTextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return l.definition(p)
+	case "textDocument/completion":
+		var p lspTextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return l.completion(p)
+	default:
+		return nil, &lspError{-32601, "method not found: " + method}
+	}
+}
+
+// parse parses and validates a document, following include directives.
+func (l *lspServer) parse(doc *lspDoc) {
+	var s *dictgen.DictFileScanner
+	if doc.Path != "" {
+		s = dictgen.NewDictFileScannerName(strings.NewReader(doc.Text), doc.Path)
+	} else {
+		s = dictgen.NewDictFileScanner(strings.NewReader(doc.Text))
+	}
+	doc.Entries = nil
+	for s.Scan() {
+		doc.Entries = append(doc.Entries, s.Entry())
+	}
+	doc.Err, doc.Header = s.Err(), s.Header()
+	s.Close()
+
+	doc.errs, doc.warns = nil, nil
+	if doc.Err != nil {
+		doc.errs = append(doc.errs, doc.Err)
+	}
+	for _, dfe := range doc.Entries {
+		if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+			doc.errs = append(doc.errs, err)
+		}
+	}
+	if warns, err := dictgen.LintDictFile(strings.NewReader(doc.Text), doc.Path); err == nil {
+		doc.warns = warns
+	}
+}
+
+// index returns the entries from all open documents and the files they
+// include. If a file is open, the entries from it are used rather than the
+// ones read from the disk by other documents.
+func (l *lspServer) index() []*dictgen.DictFileEntry {
+	open := map[string]bool{}
+	for _, doc := range l.docs {
+		if doc.Path != "" {
+			open[lspAbs(doc.Path)] = true
+		}
+	}
+
+	uris := make([]string, 0, len(l.docs))
+	for uri := range l.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	var idx []*dictgen.DictFileEntry
+	seen := map[string]bool{}
+	for _, uri := range uris {
+		doc := l.docs[uri]
+		for _, dfe := range doc.Entries {
+			file, line := dfe.Position()
+			if file != "" {
+				file = lspAbs(file)
+				if open[file] && file != lspAbs(doc.Path) {
+					continue
+				}
+				if k := file + ":" + strconv.Itoa(line); seen[k] {
+					continue
+				} else {
+					seen[k] = true
+				}
+			}
+			idx = append(idx, dfe)
+		}
+	}
+	return idx
+}
+
+// reindex updates the words in the index, returning true if they changed.
+func (l *lspServer) reindex() bool {
+	words := map[string]bool{}
+	for _, dfe := range l.index() {
+		words[kobodict.NormalizeWordReference(dfe.Headword, true)] = true
+		for _, v := range dfe.Variant {
+			words[kobodict.NormalizeWordReference(v, true)] = true
+		}
+	}
+	changed := len(words) != len(l.words)
+	for w := range words {
+		changed = changed || !l.words[w]
+	}
+	l.words = words
+	return changed
+}
+
+// update publishes the diagnostics for a changed document (nil if it was
+// closed). If the words in the index changed, the cross-references in the other
+// open documents are re-checked too.
+func (l *lspServer) update(doc *lspDoc) error {
+	if l.reindex() {
+		return l.publishAll()
+	}
+	if doc != nil {
+		return l.publish(doc)
+	}
+	return nil
+}
+
+// publishAll publishes the diagnostics for all open documents.
+func (l *lspServer) publishAll() error {
+	uris := make([]string, 0, len(l.docs))
+	for uri := range l.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		if err := l.publish(l.docs[uri]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish publishes the diagnostics for a document. The errors and warnings
+// from the last parse are used, and only the cross-references are re-checked.
+func (l *lspServer) publish(doc *lspDoc) error {
+	diags := map[string][]lspDiagnostic{doc.URI: {}}
+	add := func(err error, severity int) {
+		file, line, msg := "", 1, err.Error()
+		var dfe *dictgen.DictFileError
+		if errors.As(err, &dfe) {
+			file, line, msg = dfe.File, dfe.Line, dfe.Err.Error()
+		}
+		uri := doc.URI
+		if file != "" && lspAbs(file) != lspAbs(doc.Path) {
+			uri = l.uri(file)
+		}
+		diags[uri] = append(diags[uri], lspDiagnostic{
+			Range:    lspRange{lspPosition{line - 1, 0}, lspPosition{line, 0}},
+			Severity: severity,
+			Source:   "dictgen",
+			Message:  msg,
+		})
+	}
+
+	for _, err := range doc.errs {
+		add(err, 1)
+	}
+	for _, dfe := range doc.Entries {
+		for _, ref := range dfe.References() {
+			if !l.words[kobodict.NormalizeWordReference(ref, true)] {
+				file, line := dfe.Position()
+				add(&dictgen.DictFileError{File: file, Line: line, Err: fmt.Errorf("word %#v: dangling cross-reference to %#v", dfe.Headword, ref)}, 2)
+			}
+		}
+	}
+	for _, w := range doc.warns {
+		add(w, 2)
+	}
+
+	for _, uri := range doc.published {
+		if _, ok := diags[uri]; !ok {
+			diags[uri] = []lspDiagnostic{} // clear
+		}
+	}
+
+	uris := make([]string, 0, len(diags))
+	for uri := range diags {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	var published []string
+	for _, uri := range uris {
+		if err := l.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": diags[uri],
+		}); err != nil {
+			return err
+		}
+		if len(diags[uri]) != 0 || uri == doc.URI {
+			published = append(published, uri)
+		}
+	}
+	doc.published = published
+	return nil
+}
+
+// at returns the document, the line, and the byte offset in the line for a
+// position.
+func (l *lspServer) at(p lspTextDocumentPositionParams) (*lspDoc, string, int, error) {
+	doc, ok := l.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, "", 0, &lspError{-32602, "document not open: " + p.TextDocument.URI}
+	}
+	lines := strings.Split(doc.Text, "\n")
+	if p.Position.Line < 0 || p.Position.Line >= len(lines) {
+		return doc, "", 0, nil
+	}
+	line := strings.TrimSuffix(lines[p.Position.Line], "\r")
+	return doc, line, lspUTF16Offset(line, p.Position.Character), nil
+}
+
+// lookup returns the entries matching a word.
+func (l *lspServer) lookup(word string) []*dictgen.DictFileEntry {
+	var res []*dictgen.DictFileEntry
+	word = kobodict.NormalizeWordReference(word, true)
+	for _, dfe := range l.index() {
+		match := kobodict.NormalizeWordReference(dfe.Headword, true) == word
+		for _, v := range dfe.Variant {
+			match = match || kobodict.NormalizeWordReference(v, true) == word
+		}
+		if match {
+			res = append(res, dfe)
+		}
+	}
+	return res
+}
+
+func (l *lspServer) hover(p lspTextDocumentPositionParams) (interface{}, error) {
+	doc, line, off, err := l.at(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// the target of the cross-reference under the cursor
+	var entries []*dictgen.DictFileEntry
+	for _, ref := range dictgen.FindReferences(line) {
+		if off >= ref.Start && off < ref.End {
+			if entries = l.lookup(ref.Target); len(entries) == 0 {
+				return map[string]interface{}{
+					"contents": map[string]interface{}{
+						"kind":  "markdown",
+						"value": fmt.Sprintf("Dangling cross-reference to **%s**.", ref.Target),
+					},
+				}, nil
+			}
+		}
+	}
+
+	// or the entry under the cursor
+	if entries == nil {
+		var cur *dictgen.DictFileEntry
+		for _, dfe := range doc.Entries {
+			if file, n := dfe.Position(); (file == "" || lspAbs(file) == lspAbs(doc.Path)) && n-1 <= p.Position.Line {
+				cur = dfe
+			}
+		}
+		if cur == nil {
+			return nil, nil
+		}
+		entries = append(entries, cur)
+	}
+
+	pn := l.prefix
+	if hp := headerPrefix(doc.Header); hp != "" {
+		pn = hp
+	}
+	pfn, _ := kobodict.ParsePrefixFunc(pn)
+
+	var b strings.Builder
+	for i, dfe := range entries {
+		if i != 0 {
+			b.WriteString("\n\n---\n\n")
+		}
+		fmt.Fprintf(&b, "**%s** (prefix `%s`)", dfe.Headword, pfn(dfe.Headword))
+		for _, v := range dfe.Variant {
+			fmt.Fprintf(&b, "  \n& %s (prefix `%s`)", v, pfn(v))
+		}
+		b.WriteString("\n\n")
+
+		buf := bytes.NewBuffer(nil)
+		if err := (dictgen.DictFile{dfe}).WriteKoboHTMLOptions(buf, l.ho); err != nil {
+			fmt.Fprintf(&b, "*Error: %s*", err)
+		} else {
+			b.WriteString(lspPreviewRe.ReplaceAllString(buf.String(), ""))
+		}
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]interface{}{
+			"kind":  "markdown",
+			"value": b.String(),
+		},
+	}, nil
+}
+
+// lspPreviewRe matches the parts of the dicthtml which are only used by nickel
+// to find the entries.
+var lspPreviewRe = regexp.MustCompile(`</?html>|</?w>|<a name="[^"]*" />|<var>.*?</var>`)
+
+func (l *lspServer) definition(p lspTextDocumentPositionParams) (interface{}, error) {
+	doc, line, off, err := l.at(p)
+	if err != nil {
+		return nil, err
+	}
+
+	locs := []lspLocation{}
+	if x := strings.TrimPrefix(line, "#include"); x != line && (x == "" || x[0] == ' ' || x[0] == '\t') && doc.Path != "" {
+		pattern := strings.TrimSpace(x)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(doc.Path), pattern)
+		}
+		m, _ := filepath.Glob(pattern)
+		for _, fn := range m {
+			locs = append(locs, lspLocation{URI: l.uri(fn)})
+		}
+		return locs, nil
+	}
+
+	for _, ref := range dictgen.FindReferences(line) {
+		if off >= ref.Start && off < ref.End {
+			for _, dfe := range l.lookup(ref.Target) {
+				uri := doc.URI
+				file, n := dfe.Position()
+				if file != "" {
+					uri = l.uri(file)
+				}
+				locs = append(locs, lspLocation{uri, lspRange{lspPosition{n - 1, 0}, lspPosition{n - 1, 0}}})
+			}
+		}
+	}
+	return locs, nil
+}
+
+func (l *lspServer) completion(p lspTextDocumentPositionParams) (interface{}, error) {
+	_, line, off, err := l.at(p)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []map[string]interface{}{}
+
+	// only complete the target of a cross-reference
+	before := line[:off]
+	if i := strings.LastIndex(before, "[["); i == -1 || strings.ContainsAny(before[i:], "]|") {
+		return map[string]interface{}{"isIncomplete": false, "items": items}, nil
+	}
+
+	seen := map[string]bool{}
+	for _, dfe := range l.index() {
+		if seen[dfe.Headword] {
+			continue
+		}
+		seen[dfe.Headword] = true
+		item := map[string]interface{}{
+			"label": dfe.Headword,
+			"kind":  18, // reference
+		}
+		if dfe.HeaderInfo != "" {
+			item["detail"] = dfe.HeaderInfo
+		}
+		items = append(items, item)
+	}
+	return map[string]interface{}{"isIncomplete": false, "items": items}, nil
+}
+
+// uri returns the uri for a file, using the exact one the editor uses if it is
+// open.
+func (l *lspServer) uri(fn string) string {
+	abs := lspAbs(fn)
+	for _, doc := range l.docs {
+		if doc.Path != "" && lspAbs(doc.Path) == abs {
+			return doc.URI
+		}
+	}
+	return lspPathURI(fn)
+}
+
+// lspUTF16Offset converts an offset in UTF-16 code units to a byte offset.
+func lspUTF16Offset(s string, n int) int {
+	for i, r := range s {
+		if n <= 0 {
+			return i
+		}
+		if r >= 0x10000 {
+			n -= 2
+		} else {
+			n--
+		}
+	}
+	return len(s)
+}
+
+func lspURIPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri scheme %#v", u.Scheme)
+	}
+	p := u.Path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:] // windows drive letter
+	}
+	return filepath.FromSlash(p), nil
+}
+
+func lspPathURI(fn string) string {
+	p := filepath.ToSlash(lspAbs(fn))
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // windows drive letter
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+func lspAbs(fn string) string {
+	if fn == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(fn); err == nil {
+		return abs
+	}
+	return fn
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/dictutil/dictgen"
+)
+
+func TestLSP(t *testing.T) {
+	dir := t.TempDir()
+	a, b := lspPathURI(filepath.Join(dir, "a.df")), lspPathURI(filepath.Join(dir, "b.df"))
+
+	c := newLSPTestClient(t)
+
+	c.Request("initialize", map[string]interface{}{})
+	if res := c.Response(); res["result"] == nil {
+		t.Fatalf("initialize: unexpected response %v", res)
+	}
+	c.Notify("initialized", map[string]interface{}{})
+
+	t.Run("Diagnostics", func(t *testing.T) {
+		c.Notify("textDocument/didOpen", lspTestDoc(a, "@ foo\nSee [[bar]].  \n\n@ baz\n& baz\nBaz.\n"))
+		c.ExpectDiagnostics(a, []string{
+			`1:2: word "foo": dangling cross-reference to "bar"`,
+			`4:2: word "baz": variant "baz" is the same as the headword (variants are matched case-insensitively)`,
+		})
+		c.ExpectNone()
+
+		// a new word affects the other documents
+		c.Notify("textDocument/didOpen", lspTestDoc(b, "@ bar\nBar.\n"))
+		c.ExpectDiagnostics(a, []string{
+			`4:2: word "baz": variant "baz" is the same as the headword (variants are matched case-insensitively)`,
+		})
+		c.ExpectDiagnostics(b, nil)
+		c.ExpectNone()
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		// only the changed document is re-published if the words don't change
+		c.Notify("textDocument/didChange", lspTestChange(b, "@ bar\nBar. \n"))
+		c.ExpectDiagnostics(b, []string{
+			`2:2: trailing whitespace`,
+		})
+		c.ExpectNone()
+
+		c.Notify("textDocument/didChange", lspTestChange(b, "#include\n@ bar\nBar.\n"))
+		c.ExpectDiagnostics(a, []string{
+			`1:2: word "foo": dangling cross-reference to "bar"`,
+			`4:2: word "baz": variant "baz" is the same as the headword (variants are matched case-insensitively)`,
+		})
+		c.ExpectDiagnostics(b, []string{
+			`1:1: no path after include directive (#include)`,
+		})
+		c.ExpectNone()
+
+		c.Notify("textDocument/didChange", lspTestChange(b, "@ bar\n: noun\nBar.\n"))
+		c.ExpectDiagnostics(a, []string{
+			`4:2: word "baz": variant "baz" is the same as the headword (variants are matched case-insensitively)`,
+		})
+		c.ExpectDiagnostics(b, nil)
+		c.ExpectNone()
+	})
+
+	t.Run("Completion", func(t *testing.T) {
+		for _, x := range []struct {
+			Line, Character int
+			Items           []string
+		}{
+			{1, 6, []string{"bar (noun)", "baz", "foo"}},
+			{1, 8, []string{"bar (noun)", "baz", "foo"}},
+			{1, 4, nil},  // before [[
+			{1, 12, nil}, // after ]]
+			{0, 2, nil},
+		} {
+			c.Request("textDocument/completion", lspTestPosition(a, x.Line, x.Character))
+			res := c.Response()["result"].(map[string]interface{})
+			var act []string
+			for _, it := range res["items"].([]interface{}) {
+				it := it.(map[string]interface{})
+				if d, ok := it["detail"]; ok {
+					act = append(act, fmt.Sprintf("%s (%s)", it["label"], d))
+				} else {
+					act = append(act, fmt.Sprint(it["label"]))
+				}
+			}
+			sort.Strings(act)
+			if !reflect.DeepEqual(act, x.Items) {
+				t.Errorf("%d:%d: expected items %q, got %q", x.Line, x.Character, x.Items, act)
+			}
+		}
+	})
+
+	t.Run("Definition", func(t *testing.T) {
+		for _, x := range []struct {
+			Line, Character int
+			Locations       []string
+		}{
+			{1, 6, []string{b + ":0"}},
+			{1, 10, []string{b + ":0"}},
+			{1, 2, nil},
+			{4, 2, nil},
+		} {
+			c.Request("textDocument/definition", lspTestPosition(a, x.Line, x.Character))
+			var act []string
+			for _, loc := range c.Response()["result"].([]interface{}) {
+				loc := loc.(map[string]interface{})
+				act = append(act, fmt.Sprintf("%s:%.0f", loc["uri"], loc["range"].(map[string]interface{})["start"].(map[string]interface{})["line"]))
+			}
+			if !reflect.DeepEqual(act, x.Locations) {
+				t.Errorf("%d:%d: expected locations %q, got %q", x.Line, x.Character, x.Locations, act)
+			}
+		}
+
+		c.Request("textDocument/definition", lspTestPosition(lspPathURI(filepath.Join(dir, "c.df")), 0, 0))
+		if res := c.Response(); res["error"] == nil {
+			t.Errorf("expected error for unopened document, got %v", res)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		c.Notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]interface{}{"uri": b}})
+		c.ExpectDiagnostics(b, nil)
+		c.ExpectDiagnostics(a, []string{
+			`1:2: word "foo": dangling cross-reference to "bar"`,
+			`4:2: word "baz": variant "baz" is the same as the headword (variants are matched case-insensitively)`,
+		})
+		c.ExpectNone()
+	})
+}
+
+// lspTestClient is a client for an lspServer running over a pipe.
+type lspTestClient struct {
+	t   *testing.T
+	w   *io.PipeWriter
+	msg chan map[string]interface{}
+	id  int
+}
+
+func newLSPTestClient(t *testing.T) *lspTestClient {
+	ir, iw := io.Pipe()
+	or, ow := io.Pipe()
+
+	l := &lspServer{
+		w:      ow,
+		prefix: "v2",
+		ho:     &dictgen.KoboHTMLOptions{},
+		docs:   map[string]*lspDoc{},
+	}
+	go func() {
+		err := l.Serve(ir)
+		ow.CloseWithError(err)
+	}()
+
+	c := &lspTestClient{t: t, w: iw, msg: make(chan map[string]interface{}, 64)}
+	go func() {
+		defer close(c.msg)
+		tr := textproto.NewReader(bufio.NewReader(or))
+		for {
+			hdr, err := tr.ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(hdr.Get("Content-Length"))
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(tr.R, buf); err != nil {
+				return
+			}
+			var m map[string]interface{}
+			if err := json.Unmarshal(buf, &m); err != nil {
+				return
+			}
+			c.msg <- m
+		}
+	}()
+	t.Cleanup(func() {
+		c.Notify("exit", nil)
+		iw.Close()
+	})
+	return c
+}
+
+func (c *lspTestClient) send(msg map[string]interface{}) {
+	c.t.Helper()
+	msg["jsonrpc"] = "2.0"
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatalf("encode message: %v", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(buf), buf); err != nil {
+		c.t.Fatalf("write message: %v", err)
+	}
+}
+
+func (c *lspTestClient) Request(method string, params interface{}) {
+	c.t.Helper()
+	c.id++
+	c.send(map[string]interface{}{"id": c.id, "method": method, "params": params})
+}
+
+func (c *lspTestClient) Notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// Next returns the next message from the server.
+func (c *lspTestClient) Next() map[string]interface{} {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.msg:
+		if !ok {
+			c.t.Fatalf("server closed connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for message")
+	}
+	return nil
+}
+
+// Response returns the response to the last request.
+func (c *lspTestClient) Response() map[string]interface{} {
+	c.t.Helper()
+	m := c.Next()
+	if id, _ := m["id"].(float64); int(id) != c.id {
+		c.t.Fatalf("expected response to request %d, got %v", c.id, m)
+	}
+	return m
+}
+
+// ExpectDiagnostics checks that the next message publishes the specified
+// diagnostics (line:severity: message) for uri.
+func (c *lspTestClient) ExpectDiagnostics(uri string, exp []string) {
+	c.t.Helper()
+	m := c.Next()
+	if m["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %v", m)
+	}
+	p := m["params"].(map[string]interface{})
+	if p["uri"] != uri {
+		c.t.Errorf("expected diagnostics for %s, got %s", uri, p["uri"])
+	}
+	var act []string
+	for _, d := range p["diagnostics"].([]interface{}) {
+		d := d.(map[string]interface{})
+		line := d["range"].(map[string]interface{})["start"].(map[string]interface{})["line"].(float64)
+		act = append(act, fmt.Sprintf("%d:%.0f: %s", int(line)+1, d["severity"], d["message"]))
+	}
+	if !reflect.DeepEqual(act, exp) {
+		c.t.Errorf("%s: expected diagnostics:\n%s\ngot:\n%s", uri, strings.Join(exp, "\n"), strings.Join(act, "\n"))
+	}
+}
+
+// ExpectNone checks that there aren't any more messages after the server
+// handles a request.
+func (c *lspTestClient) ExpectNone() {
+	c.t.Helper()
+	c.Request("test/sync", nil) // the (error) response comes after everything else
+	if m := c.Next(); m["method"] != nil {
+		c.t.Errorf("unexpected message %v", m)
+		for m["method"] != nil {
+			m = c.Next()
+		}
+	}
+}
+
+func lspTestDoc(uri, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "dictfile", "version": 1, "text": text},
+	}
+}
+
+func lspTestPosition(uri string, line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+func lspTestChange(uri, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": text}},
+	}
+}
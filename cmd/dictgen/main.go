@@ -5,7 +5,9 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	_ "image/gif"
@@ -13,27 +15,306 @@ import (
 	_ "image/png"
 
 	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/hunspell"
 	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/pgaskin/koboutils/v2/kobo"
 	"github.com/spf13/pflag"
 )
 
 var version = "dev"
 
+// subcommands are run instead of generating a dictzip if the first argument
+// matches (use ./name to generate a dictzip from a dictfile with the same
+// name).
+var subcommands = map[string]func(args []string, fs *pflag.FlagSet) int{
+	"fmt":   fmtMain,
+	"lsp":   lspMain,
+	"serve": serveMain,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if fn, ok := subcommands[os.Args[1]]; ok {
+			args := append([]string{os.Args[0] + " " + os.Args[1]}, os.Args[2:]...)
+			os.Exit(fn(args, pflag.NewFlagSet(args[0], pflag.ExitOnError)))
+			return
+		}
+	}
+
 	pflag.CommandLine.SortFlags = false
 	output := pflag.StringP("output", "o", "dicthtml.zip", "The output filename (will be overwritten if it exists) (- is stdout)")
+	format := pflag.StringP("format", "f", "kobo", "The output format (kobo - a dictzip for Kobo eReaders, stardict - a StarDict dictionary for KOReader and other readers, where the output is the path of the .ifo file and the other files are written next to it, xdxf - a logical XDXF dictionary, xdxf-visual - a visual XDXF dictionary for older readers)")
 	crypt := pflag.StringP("crypt", "c", "", "Encrypt the dictzip using the specified encryption method (format: method:keyhex)")
 	imageMethod := pflag.StringP("image-method", "I", "base64", "How to handle images (if an image path is relative, it is loaded from the current dir) (base64 - optimize and encode as base64, embed - add to dictzip, remove)")
+	prefix := pflag.StringP("prefix", "P", "v2", "The prefix algorithm to use for sharding words (v2 - the default for non-Japanese dictionaries, v1 - firmware versions before 4.7.10364, ja - Japanese dictionaries like jaxxdjs)")
+	variants := pflag.StringP("variants", "V", "", "Automatically generate variants for alternate forms of words (comma-separated) (apostrophe - straight/curly apostrophes, hyphen - hyphenated/spaced/joined forms, normalization - NFC/NFD forms, accent - without diacritics, ligature - expanded/typographic ligatures, all)")
+	inflect := pflag.String("inflect", "", "Add the inflected forms of headwords as variants using a Hunspell dictionary (the path to the .aff or .dic file, or the path without the extension)")
+	inflectMax := pflag.Int("inflect-max", 32, "The maximum number of inflected forms to add to each entry")
+	markdown := pflag.StringP("markdown", "M", "blackfriday", "The Markdown renderer to use (blackfriday, goldmark, or goldmark:extensions where extensions is a comma-separated list of table, strikethrough, linkify, footnote, deflist, typographer, or all)")
+	tmpl := pflag.String("template", "", "Use a custom Go text/template for the HTML of each entry (see https://pgaskin.net/dictutil/dictgen for details)")
+	mapping := pflag.String("map", "", "The mapping spec for CSV, TSV, JSON, and JSON Lines inputs (comma-separated key=value pairs) (headword, variant (repeatable), variant-sep, info, and definition - the column names or object keys, format - markdown or html)")
+	mapFormat := pflag.String("map-format", "", "Read stdin as CSV, TSV, JSON, or JSON Lines with --map instead of as a dictfile (csv, tsv, json, or jsonl)")
+	allowDangling := pflag.Bool("allow-dangling-refs", false, "Show a warning instead of an error for cross-references ([[word]]) which don't match any headword or variant")
+	stream := pflag.Bool("stream", false, "Process the entries one at a time and spool them to temporary files instead of loading everything into memory (for very large dictionaries) (not supported with --inflect)")
+	uncompressed := pflag.Bool("uncompressed", false, "With --format stardict, write an uncompressed .dict instead of a .dict.dz")
 	removeFooter := pflag.Bool("remove-footer", false, "Add code to prevent the non-applicable dictionary source footer for certain locales from being added after the entry (e.g. if replacing the French dictionary)")
 	help := pflag.BoolP("help", "h", false, "Show this help text")
 	pflag.Parse()
 
 	if *help || pflag.NArg() == 0 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictfile...\n\nVersion: dictgen %s\n\nOptions:\n%s\nIf multiple dictfiles (*.df) are provided, they will be merged (duplicate entries are fine; they will be shown in sequential order). To read from stdin, use - as the filename.\n\nNote that currently, the only usable image method is removing them or using base64-encoding (for firmware 4.20.14601+; older versions segfault in the in-book dictionary if images are enabled), as embedded dict:/// image URLs cause the webviews to appear blank (this is a nickel bug). See https://github.com/pgaskin/dictutil/issues/1 for more details.\n\nSee https://pgaskin.net/dictutil/dictgen for more information about the dictfile format.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictfile...\n\nVersion: dictgen %s\n\nOptions:\n%s\nIf multiple dictfiles (*.df) are provided, they will be merged (duplicate entries are fine; they will be shown in sequential order). To read from stdin, use - as the filename.\n\nGlossaries in CSV (*.csv), TSV (*.tsv), JSON (*.json, an array of objects), and JSON Lines (*.jsonl) files can also be used as inputs with --map (e.g. --map 'headword=Term,variant=Plural,info=Type,definition=Meaning'). For CSV and TSV, the first row must contain the column names. For JSON and JSON Lines, every object must contain the headword and definition keys. Errors refer to the row number for CSV and TSV, and the line number for JSON. Since these files don't have a header, a dictfile containing only a header can be added to the inputs. To read one from stdin, use - as the filename and specify the format with --map-format.\n\nThe dictfile header (if present) provides the defaults for --crypt, --image-method, --prefix, and --output. For StarDict dictionaries, the title, author, version, and license are also used for the .ifo file, and for XDXF dictionaries, they are used for the metadata.\n\nNote that currently, the only usable image method is removing them or using base64-encoding (for firmware 4.20.14601+; older versions segfault in the in-book dictionary if images are enabled), as embedded dict:/// image URLs cause the webviews to appear blank (this is a nickel bug). See https://github.com/pgaskin/dictutil/issues/1 for more details.\n\nTo format and lint dictfiles, use %s fmt (see %s fmt --help). For a language server, use %s lsp. To preview the dictionary in a browser, use %s serve.\n\nSee https://pgaskin.net/dictutil/dictgen for more information about the dictfile format.\n", os.Args[0], version, pflag.CommandLine.FlagUsages(), os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 		os.Exit(0)
 		return
 	}
 
+	var vg *dictgen.VariantGenerator
+	if *variants != "" {
+		var err error
+		if vg, err = dictgen.ParseVariantGenerator(*variants); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --variants: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+	}
+
+	var in *dictgen.Inflector
+	if *inflect != "" {
+		base := strings.TrimSuffix(strings.TrimSuffix(*inflect, ".aff"), ".dic")
+		hd, err := hunspell.Open(base+".aff", base+".dic")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --inflect: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+		in = &dictgen.Inflector{Forms: hd.Forms, Max: *inflectMax}
+	}
+
+	var tm *dictgen.TableMapping
+	if *mapping != "" {
+		var err error
+		if tm, err = dictgen.ParseTableMapping(*mapping); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --map: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+	}
+
+	var tf dictgen.TableFormat
+	if *mapFormat != "" {
+		switch tf = dictgen.TableFormat(*mapFormat); tf {
+		case dictgen.TableCSV, dictgen.TableTSV, dictgen.TableJSON, dictgen.TableJSONL:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --map-format: unknown format %#v.\n", *mapFormat)
+			os.Exit(2)
+			return
+		}
+		if tm == nil {
+			fmt.Fprintf(os.Stderr, "Error: --map-format requires --map.\n")
+			os.Exit(2)
+			return
+		}
+	}
+
+	var ho dictgen.KoboHTMLOptions
+	if *tmpl != "" {
+		buf, err := ioutil.ReadFile(*tmpl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+		if ho.Template, err = dictgen.ParseEntryTemplate(string(buf)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+	}
+
+	if *markdown != "blackfriday" {
+		var err error
+		if ho.Renderer, err = dictgen.ParseRenderer(*markdown); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --markdown: %v.\n", err)
+			os.Exit(2)
+			return
+		}
+	}
+
+	switch *format {
+	case "kobo":
+		if *uncompressed {
+			fmt.Fprintf(os.Stderr, "Error: --uncompressed can only be used with --format stardict.\n")
+			os.Exit(2)
+			return
+		}
+	case "stardict":
+		for _, x := range []string{"crypt", "stream", "remove-footer"} {
+			if pflag.CommandLine.Changed(x) {
+				fmt.Fprintf(os.Stderr, "Error: --%s cannot be used with --format stardict.\n", x)
+				os.Exit(2)
+				return
+			}
+		}
+		if *output == "-" {
+			fmt.Fprintf(os.Stderr, "Error: cannot write a StarDict dictionary to stdout.\n")
+			os.Exit(2)
+			return
+		}
+		if !pflag.CommandLine.Changed("output") {
+			*output = "dictionary.ifo"
+		}
+	case "xdxf", "xdxf-visual":
+		for _, x := range []string{"crypt", "stream", "remove-footer", "uncompressed", "image-method", "template"} {
+			if pflag.CommandLine.Changed(x) {
+				fmt.Fprintf(os.Stderr, "Error: --%s cannot be used with --format %s.\n", x, *format)
+				os.Exit(2)
+				return
+			}
+		}
+		if !pflag.CommandLine.Changed("output") {
+			*output = "dictionary.xdxf"
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --format, see --help for details.\n")
+		os.Exit(2)
+		return
+	}
+
+	if *stream && in != nil {
+		fmt.Fprintf(os.Stderr, "Error: --inflect cannot be used with --stream (it needs all headwords to skip forms which are entries themselves).\n")
+		os.Exit(2)
+		return
+	}
+
+	// the first entry of each dictfile is read up-front so the headers are
+	// available before the entries are processed
+	type scanner interface {
+		Scan() bool
+		Entry() *dictgen.DictFileEntry
+		Header() *dictgen.DictFileHeader
+		Err() error
+		Close() error
+	}
+	type input struct {
+		name  string
+		s     scanner
+		first *dictgen.DictFileEntry
+	}
+	var inputs []input
+	hdr := new(dictgen.DictFileHeader)
+
+	fmt.Fprintf(os.Stderr, "Reading dictfile headers.\n")
+	var seenStdin bool
+	for _, fn := range pflag.Args() {
+		if fn == "-" {
+			if seenStdin {
+				fmt.Fprintf(os.Stderr, "Error: stdin can only be specified once.\n")
+				os.Exit(1)
+				return
+			}
+			seenStdin = true
+		}
+
+		if err := func() error {
+			var s scanner
+			if fn == "-" {
+				if tf != "" {
+					ts, err := dictgen.NewTableScanner(os.Stdin, tf, tm)
+					if err != nil {
+						return err
+					}
+					s = ts
+				} else {
+					s = dictgen.NewDictFileScanner(os.Stdin)
+				}
+			} else if _, ok := dictgen.TableFormatFor(fn); ok {
+				if tm == nil {
+					return fmt.Errorf("--map must be specified for CSV, TSV, and JSON inputs")
+				}
+				ts, err := dictgen.OpenTableScanner(fn, tm)
+				if err != nil {
+					return err
+				}
+				s = ts
+			} else {
+				ds, err := dictgen.OpenDictFileScanner(fn)
+				if err != nil {
+					return err
+				}
+				s = ds
+			}
+
+			var first *dictgen.DictFileEntry
+			if s.Scan() {
+				first = s.Entry()
+			} else if err := s.Err(); err != nil {
+				s.Close()
+				return err
+			}
+
+			if err := hdr.Merge(s.Header()); err != nil {
+				s.Close()
+				return fmt.Errorf("merge header: %w", err)
+			}
+
+			inputs = append(inputs, input{fn, s, first})
+			return nil
+		}(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: input %#v: %v.\n", fn, err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	// scan calls fn for each entry of an input
+	scan := func(in input, fn func(*dictgen.DictFileEntry) error) error {
+		defer in.s.Close()
+		if in.first != nil {
+			if err := fn(in.first); err != nil {
+				return err
+			}
+		}
+		for in.s.Scan() {
+			if err := fn(in.s.Entry()); err != nil {
+				return err
+			}
+		}
+		return in.s.Err()
+	}
+
+	// the dictfile header provides the defaults for options not explicitly set
+	if !hdr.IsZero() {
+		if hdr.Title != "" {
+			fmt.Fprintf(os.Stderr, "  Dictionary: %s", hdr.Title)
+			if hdr.Version != "" {
+				fmt.Fprintf(os.Stderr, " (version %s)", hdr.Version)
+			}
+			fmt.Fprintf(os.Stderr, ".\n")
+		}
+		if hdr.Crypt != "" && !pflag.CommandLine.Changed("crypt") && *format == "kobo" {
+			*crypt = hdr.Crypt
+		}
+		if !pflag.CommandLine.Changed("image-method") {
+			if hdr.ImageMethod != "" {
+				*imageMethod = hdr.ImageMethod
+			} else if hdr.Firmware != "" && kobo.VersionCompare(hdr.Firmware, "4.20.14601") < 0 {
+				*imageMethod = "remove" // older versions segfault in the in-book dictionary if images are enabled
+			}
+		}
+		if p := headerPrefix(hdr); p != "" && !pflag.CommandLine.Changed("prefix") {
+			*prefix = p
+		}
+		if !pflag.CommandLine.Changed("output") && hdr.Locale != "" && hdr.Locale != "en" {
+			switch *format {
+			case "stardict":
+				*output = "dictionary-" + hdr.Locale + ".ifo"
+			case "xdxf", "xdxf-visual":
+				*output = "dictionary-" + hdr.Locale + ".xdxf"
+			default:
+				*output = "dicthtml-" + hdr.Locale + ".zip"
+			}
+		}
+	}
+
 	var e kobodict.Crypter
 	if *crypt != "" {
 		if spl := strings.SplitN(*crypt, ":", 2); len(spl) < 2 {
@@ -67,54 +348,158 @@ func main() {
 		return
 	}
 
-	var tdf dictgen.DictFile
+	pfn, err := kobodict.ParsePrefixFunc(*prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --prefix, see --help for details.")
+		os.Exit(2)
+		return
+	}
 
-	fmt.Fprintf(os.Stderr, "Parsing dictfiles.\n")
-	var seenStdin bool
-	for _, fn := range pflag.Args() {
-		if fn == "-" {
-			if seenStdin {
-				fmt.Fprintf(os.Stderr, "Error: stdin can only be specified once.\n")
+	const footerHTML = `<span class="end"><style>.end,.end+*{display: none !important;}</style></span>`
+
+	var tdf dictgen.DictFile
+	if !*stream {
+		fmt.Fprintf(os.Stderr, "Parsing dictfiles.\n")
+		for _, inp := range inputs {
+			var df dictgen.DictFile
+			if err := scan(inp, func(dfe *dictgen.DictFileEntry) error {
+				df = append(df, dfe)
+				return nil
+			}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: input %#v: %v.\n", inp.name, err)
+				os.Exit(1)
+				return
+			} else if err := df.Validate(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: input %#v: %v.\n", inp.name, err)
 				os.Exit(1)
 				return
 			}
-			seenStdin = true
+			tdf = append(tdf, df...)
 		}
 
-		if err := func() error {
-			var fr io.Reader
-			if fn == "-" {
-				fr = os.Stdin
-			} else {
-				f, err := os.OpenFile(fn, os.O_RDONLY, 0)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
-				fr = f
+		if err := tdf.CheckReferences(); err != nil {
+			if !*allowDangling {
+				fmt.Fprintf(os.Stderr, "Error: check cross-references:\n%v\n", err)
+				os.Exit(1)
+				return
 			}
+			fmt.Fprintf(os.Stderr, "Warning: check cross-references:\n%v\n", err)
+		}
 
-			if df, err := dictgen.ParseDictFile(fr); err != nil {
-				return err
-			} else if err := df.Validate(); err != nil {
-				return err
-			} else {
-				tdf = append(tdf, df...)
+		if in != nil {
+			fmt.Fprintf(os.Stderr, "Adding inflected forms.\n")
+			in.Apply(tdf)
+		}
+
+		if vg != nil {
+			fmt.Fprintf(os.Stderr, "Generating variants.\n")
+			vg.Apply(tdf)
+		}
+
+		if *removeFooter {
+			fmt.Fprintf(os.Stderr, "Appending HTML code to remove entry footers (note: you don't need this and should not use it unless you are replacing a dictionary which adds it, such as the French one).\n")
+			for _, dfe := range tdf {
+				dfe.PostRawHTML += footerHTML
 			}
+		}
+	}
 
-			return nil
-		}(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: input %#v: %v.\n", fn, err)
+	if *format == "stardict" {
+		if _, ok := ih.(*dictgen.ImageHandlerEmbed); ok {
+			fmt.Fprintf(os.Stderr, "Error: the embed image method cannot be used with --format stardict.\n")
+			os.Exit(2)
+			return
+		}
+
+		opt := &dictgen.StarDictOptions{
+			BookName:     hdr.Title,
+			Author:       hdr.Author,
+			Uncompressed: *uncompressed,
+			HTML:         &ho,
+		}
+		var desc []string
+		if hdr.Version != "" {
+			desc = append(desc, "Version: "+hdr.Version)
+		}
+		if hdr.License != "" {
+			desc = append(desc, "License: "+hdr.License)
+		}
+		opt.Description = strings.Join(desc, "\n")
+
+		fmt.Fprintf(os.Stderr, "Generating StarDict dictionary.\n")
+		if ih != nil {
+			fmt.Fprintf(os.Stderr, "  Using image method: %s.\n", ih.Description())
+		}
+		if ho.Template != nil {
+			fmt.Fprintf(os.Stderr, "  Using custom template.\n")
+		}
+		if ho.Renderer != nil {
+			fmt.Fprintf(os.Stderr, "  Using Markdown renderer: %s.\n", *markdown)
+		}
+		if *uncompressed {
+			fmt.Fprintf(os.Stderr, "  Not compressing dict.\n")
+		}
+		if err := tdf.WriteStarDict(filepath.Dir(*output), strings.TrimSuffix(filepath.Base(*output), ".ifo"), ih, dictgen.ImageFuncFilesystem, opt); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write StarDict dictionary: %v\n", err)
 			os.Exit(1)
 			return
 		}
+
+		fmt.Fprintf(os.Stderr, "Successfully wrote %d entries from %d dictfile(s) to StarDict dictionary %s.\n", len(tdf), pflag.NArg(), *output)
+		os.Exit(0)
+		return
 	}
 
-	if *removeFooter {
-		fmt.Fprintf(os.Stderr, "Appending HTML code to remove entry footers (note: you don't need this and should not use it unless you are replacing a dictionary which adds it, such as the French one).\n")
-		for _, dfe := range tdf {
-			dfe.PostRawHTML += `<span class="end"><style>.end,.end+*{display: none !important;}</style></span>`
+	if *format == "xdxf" || *format == "xdxf-visual" {
+		opt := &dictgen.XDXFOptions{
+			Title:    hdr.Title,
+			Author:   hdr.Author,
+			Version:  hdr.Version,
+			Locale:   hdr.Locale,
+			Visual:   *format == "xdxf-visual",
+			Renderer: ho.Renderer,
+		}
+		if hdr.License != "" {
+			opt.Description = "License: " + hdr.License
+		}
+
+		fmt.Fprintf(os.Stderr, "Opening output.\n")
+		var f io.WriteCloser
+		switch *output {
+		case "-":
+			f = os.Stdout
+		default:
+			ff, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: create XDXF dictionary: %v\n", err)
+				os.Exit(1)
+				return
+			}
+			f = ff
+		}
+
+		fmt.Fprintf(os.Stderr, "Generating XDXF dictionary.\n")
+		if opt.Visual {
+			fmt.Fprintf(os.Stderr, "  Using visual format.\n")
+		}
+		if ho.Renderer != nil {
+			fmt.Fprintf(os.Stderr, "  Using Markdown renderer: %s.\n", *markdown)
+		}
+		if err := tdf.WriteXDXF(f, opt); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write XDXF dictionary: %v\n", err)
+			os.Exit(1)
+			return
+		}
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write XDXF dictionary: %v\n", err)
+			os.Exit(1)
+			return
 		}
+
+		fmt.Fprintf(os.Stderr, "Successfully wrote %d entries from %d dictfile(s) to XDXF dictionary %s.\n", len(tdf), pflag.NArg(), *output)
+		os.Exit(0)
+		return
 	}
 
 	fmt.Fprintf(os.Stderr, "Opening output.\n")
@@ -135,18 +520,73 @@ func main() {
 	fmt.Fprintf(os.Stderr, "Generating dictzip.\n")
 	dw := kobodict.NewWriter(f)
 	dw.SetEncrypter(e)
+	dw.SetPrefixFunc(pfn)
+	if *prefix != "v2" {
+		fmt.Fprintf(os.Stderr, "  Using prefix algorithm: %s.\n", *prefix)
+	}
 	if e != nil {
 		fmt.Fprintf(os.Stderr, "  Using encryption.\n")
 	}
 	if ih != nil {
 		fmt.Fprintf(os.Stderr, "  Using image method: %s.\n", ih.Description())
 	}
-	if err := tdf.WriteDictzip(dw, ih, dictgen.ImageFuncFilesystem); err != nil {
+	if ho.Template != nil {
+		fmt.Fprintf(os.Stderr, "  Using custom template.\n")
+	}
+	if ho.Renderer != nil {
+		fmt.Fprintf(os.Stderr, "  Using Markdown renderer: %s.\n", *markdown)
+	}
+	n := len(tdf)
+	if *stream {
+		fmt.Fprintf(os.Stderr, "  Streaming entries.\n")
+		if *removeFooter {
+			fmt.Fprintf(os.Stderr, "  Appending HTML code to remove entry footers.\n")
+		}
+		if err := func() error {
+			sp, err := dictgen.NewSpooler(dw, "")
+			if err != nil {
+				return err
+			}
+			defer sp.Close()
+
+			var rc dictgen.ReferenceChecker
+			for _, inp := range inputs {
+				if err := scan(inp, func(dfe *dictgen.DictFileEntry) error {
+					if vg != nil {
+						vg.Apply(dictgen.DictFile{dfe})
+					}
+					if *removeFooter {
+						dfe.PostRawHTML += footerHTML
+					}
+					rc.Add(dfe)
+					n++
+					return sp.Add(dfe)
+				}); err != nil {
+					return fmt.Errorf("input %#v: %w", inp.name, err)
+				}
+			}
+
+			if err := rc.Check(); err != nil {
+				if !*allowDangling {
+					return fmt.Errorf("check cross-references:\n%w", err)
+				}
+				fmt.Fprintf(os.Stderr, "Warning: check cross-references:\n%v\n", err)
+			}
+
+			return sp.WriteDictzip(ih, dictgen.ImageFuncFilesystem, &ho)
+		}(); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictzip: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	} else if err := tdf.WriteDictzipOptions(dw, ih, dictgen.ImageFuncFilesystem, &ho); err != nil {
 		f.Close()
 		fmt.Fprintf(os.Stderr, "Error: write dictzip: %v\n", err)
 		os.Exit(1)
 		return
-	} else if err := dw.Close(); err != nil {
+	}
+	if err := dw.Close(); err != nil {
 		f.Close()
 		fmt.Fprintf(os.Stderr, "Error: write dictzip: %v\n", err)
 		os.Exit(1)
@@ -157,6 +597,17 @@ func main() {
 		return
 	}
 
-	fmt.Fprintf(os.Stderr, "Successfully wrote %d entries from %d dictfile(s) to dictzip %s.\n", len(tdf), pflag.NArg(), *output)
+	fmt.Fprintf(os.Stderr, "Successfully wrote %d entries from %d dictfile(s) to dictzip %s.\n", n, pflag.NArg(), *output)
 	os.Exit(0)
 }
+
+// headerPrefix returns the prefix algorithm to use for a dictfile header, or an
+// empty string if it doesn't need a specific one.
+func headerPrefix(hdr *dictgen.DictFileHeader) string {
+	if hdr.Locale == "ja" {
+		return "ja"
+	} else if hdr.Firmware != "" && kobo.VersionCompare(hdr.Firmware, "4.7.10364") < 0 {
+		return "v1"
+	}
+	return ""
+}
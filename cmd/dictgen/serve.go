@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/internal/preview"
+	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/spf13/pflag"
+)
+
+func serveMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	addr := fs.StringP("addr", "a", "localhost:8080", "The address to listen on")
+	imageMethod := fs.StringP("image-method", "I", "base64", "How to handle images (see dictgen --help)")
+	prefix := fs.StringP("prefix", "P", "v2", "The prefix algorithm to use (see dictgen --help)")
+	variants := fs.StringP("variants", "V", "", "Automatically generate variants (see dictgen --help)")
+	markdown := fs.StringP("markdown", "M", "blackfriday", "The Markdown renderer to use (see dictgen --help)")
+	tmpl := fs.String("template", "", "Use a custom Go text/template for the HTML of each entry (see dictgen --help)")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictfile...\n\nOptions:\n%s\nStarts a local HTTP server to preview the dictionary the dictfiles would generate. The entries for a word are found in the same way as on a Kobo eReader, and are shown in an approximation of the dictionary webview.\n\nThe dictionary is rebuilt automatically when a dictfile (or a file it includes) changes.\n", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	for _, fn := range fs.Args() {
+		if fn == "-" {
+			fmt.Fprintf(os.Stderr, "Error: cannot read from stdin, since the dictfiles are watched for changes.\n")
+			return 2
+		}
+	}
+
+	var vg *dictgen.VariantGenerator
+	if *variants != "" {
+		var err error
+		if vg, err = dictgen.ParseVariantGenerator(*variants); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --variants: %v.\n", err)
+			return 2
+		}
+	}
+
+	var ho dictgen.KoboHTMLOptions
+	if *tmpl != "" {
+		buf, err := ioutil.ReadFile(*tmpl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			return 2
+		}
+		if ho.Template, err = dictgen.ParseEntryTemplate(string(buf)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --template: %v.\n", err)
+			return 2
+		}
+	}
+
+	if *markdown != "blackfriday" {
+		var err error
+		if ho.Renderer, err = dictgen.ParseRenderer(*markdown); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --markdown: %v.\n", err)
+			return 2
+		}
+	}
+
+	if _, err := kobodict.ParsePrefixFunc(*prefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --prefix, see --help for details.\n")
+		return 2
+	}
+
+	ps := &preview.Server{Title: fs.Arg(0)}
+
+	// build generates the dictzip in memory, returning the files to watch
+	build := func() ([]string, *kobodict.Reader, kobodict.PrefixFunc, error) {
+		files := append([]string(nil), fs.Args()...)
+		seen := map[string]bool{}
+		for _, fn := range files {
+			seen[fn] = true
+		}
+
+		var tdf dictgen.DictFile
+		hdr := new(dictgen.DictFileHeader)
+		for _, fn := range fs.Args() {
+			s, err := dictgen.OpenDictFileScanner(fn)
+			if err != nil {
+				return files, nil, nil, fmt.Errorf("input %#v: %w", fn, err)
+			}
+			for s.Scan() {
+				tdf = append(tdf, s.Entry())
+				if file, _ := s.Entry().Position(); file != "" && !seen[file] {
+					seen[file] = true
+					files = append(files, file) // included files
+				}
+			}
+			if err := s.Err(); err != nil {
+				return files, nil, nil, fmt.Errorf("input %#v: %w", fn, err)
+			}
+			if err := hdr.Merge(s.Header()); err != nil {
+				return files, nil, nil, fmt.Errorf("input %#v: merge header: %w", fn, err)
+			}
+		}
+
+		if err := tdf.Validate(); err != nil {
+			return files, nil, nil, err
+		}
+		if err := tdf.CheckReferences(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: check cross-references:\n%v\n", err)
+		}
+		if vg != nil {
+			vg.Apply(tdf)
+		}
+
+		pn, im := *prefix, *imageMethod
+		if p := headerPrefix(hdr); p != "" && !fs.Changed("prefix") {
+			pn = p
+		}
+		if hdr.ImageMethod != "" && !fs.Changed("image-method") {
+			im = hdr.ImageMethod
+		}
+
+		var ih dictgen.ImageHandler
+		switch im {
+		case "base64":
+			ih = new(dictgen.ImageHandlerBase64)
+		case "embed":
+			ih = new(dictgen.ImageHandlerEmbed)
+		case "remove":
+			ih = new(dictgen.ImageHandlerRemove)
+		default:
+			return files, nil, nil, fmt.Errorf("invalid image method %#v", im)
+		}
+
+		pfn, err := kobodict.ParsePrefixFunc(pn)
+		if err != nil {
+			return files, nil, nil, err
+		}
+
+		buf := bytes.NewBuffer(nil)
+		dw := kobodict.NewWriter(buf)
+		dw.SetPrefixFunc(pfn)
+		if err := tdf.WriteDictzipOptions(dw, ih, dictgen.ImageFuncFilesystem, &ho); err != nil {
+			return files, nil, nil, fmt.Errorf("write dictzip: %w", err)
+		} else if err := dw.Close(); err != nil {
+			return files, nil, nil, fmt.Errorf("write dictzip: %w", err)
+		}
+
+		dr, err := kobodict.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			return files, nil, nil, fmt.Errorf("read dictzip: %w", err)
+		}
+		return files, dr, pfn, nil
+	}
+
+	go preview.Watch(time.Second, func() []string {
+		fmt.Fprintf(os.Stderr, "Building dictionary.\n")
+		files, dr, pfn, err := build()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Successfully built dictionary with %d words.\n", len(dr.Word))
+		}
+		ps.Update(dr, pfn, err)
+		return files
+	})
+
+	fmt.Fprintf(os.Stderr, "Serving preview on http://%s/.\n", *addr)
+	if err := http.ListenAndServe(*addr, ps); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		return 1
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"database/sql"
 	"fmt"
 	"io"
@@ -108,6 +109,7 @@ func installMain(args []string, fs *pflag.FlagSet) int {
 	builtin := fs.StringP("builtin", "b", "replace", "How to handle built-in locales [replace = replace and prevent from syncing] [ignore = replace and leave syncing as-is] (doesn't have any effect on 4.24.15672+)")
 	noCustom := fs.BoolP("no-custom", "B", false, "Whether to force installation to .kobo/dict instead of .kobo/custom-dict (4.24.15672+ only)")
 	useExtraLocales := fs.BoolP("use-extra-locales", "", false, "Whether to use ExtraLocales on 4.24.15672+ if not a built-in dictionary (this is not required anymore since 4.24.15672) (4.24.15672+ only)")
+	requireSignature := fs.String("require-signature", "", "Refuse to install the dictzip unless it is signed by the specified ed25519 public key (hex, or a file containing it) (see the sign command)")
 	help := fs.BoolP("help", "h", false, "Show this help text")
 	fs.Parse(args[1:])
 
@@ -137,6 +139,20 @@ func installMain(args []string, fs *pflag.FlagSet) int {
 	}
 	dictSize := dfi.Size()
 
+	if *requireSignature != "" {
+		pub, err := parseKey(*requireSignature, ed25519.PublicKeySize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid public key for --require-signature: %v.\n", err)
+			return 2
+		}
+		src, err := verifyDictzip(fs.Args()[0], df, dictSize, pub)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: verify dictzip signature: %v.\n", err)
+			return 1
+		}
+		fmt.Printf("Verified dictzip signature from %s.\n", src)
+	}
+
 	dictLocale := *locale
 	if len(dictLocale) == 0 {
 		m := regexp.MustCompile(`^dicthtml-([a-zA-Z0-9]{2}(?:-[a-zA-Z0-9]{2})?)\.zip$`).FindStringSubmatch(filepath.Base(fs.Args()[0]))
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// keyring maps dictzip filenames to the key used to decrypt them. It is read
+// from a file where each line is a filename (or a glob matching the base name)
+// followed by the key (method:keyhex), separated by whitespace. Blank lines
+// and lines starting with # are ignored.
+type keyring []keyringEntry
+
+type keyringEntry struct {
+	pattern string
+	crypter kobodict.Crypter
+}
+
+func readKeyring(fn string) (keyring, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var kr keyring
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		spl := strings.Fields(line)
+		if len(spl) != 2 {
+			return nil, fmt.Errorf("line %d: expected filename and key", n)
+		}
+		if _, err := filepath.Match(spl[0], ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %#v: %w", n, spl[0], err)
+		}
+		c, err := parseCrypter(spl[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		kr = append(kr, keyringEntry{spl[0], c})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// Find returns the first key matching the dictzip, or nil if none match.
+func (kr keyring) Find(fn string) kobodict.Crypter {
+	for _, e := range kr {
+		if e.pattern == fn {
+			return e.crypter
+		}
+		if ok, _ := filepath.Match(e.pattern, filepath.Base(fn)); ok {
+			return e.crypter
+		}
+	}
+	return nil
+}
+
+// parseCrypter parses a key in the format method:keyhex.
+func parseCrypter(s string) (kobodict.Crypter, error) {
+	if spl := strings.SplitN(s, ":", 2); len(spl) < 2 {
+		return nil, fmt.Errorf("no ':' found")
+	} else if key, err := hex.DecodeString(spl[1]); err != nil {
+		return nil, fmt.Errorf("decode hex: %w", err)
+	} else if c, err := kobodict.NewCrypter(spl[0], key); err != nil {
+		return nil, fmt.Errorf("initialize crypter: %w", err)
+	} else {
+		return c, nil
+	}
+}
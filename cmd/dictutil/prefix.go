@@ -15,6 +15,7 @@ func init() {
 func prefixMain(args []string, fs *pflag.FlagSet) int {
 	fs.SortFlags = false
 	format := fs.StringP("format", "f", "json-array", "The output format (go-slice, go-map, csv, tsv, json-array, json-object)")
+	method := fs.StringP("prefix", "P", "v2", "The prefix algorithm to use (v2 - firmware 4.7.10364+, v1 - older firmware versions, ja - Japanese dictionaries like jaxxdjs)")
 	help := fs.BoolP("help", "h", false, "Show this help text")
 	fs.Parse(args[1:])
 
@@ -28,6 +29,12 @@ func prefixMain(args []string, fs *pflag.FlagSet) int {
 		return 2
 	}
 
+	pfn, err := kobodict.ParsePrefixFunc(*method)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid prefix algorithm %#v, see --help for more details.\n", *method)
+		return 2
+	}
+
 	switch *format {
 	case "go-slice":
 		fmt.Printf("[][]string{\n")
@@ -44,7 +51,7 @@ func prefixMain(args []string, fs *pflag.FlagSet) int {
 	}
 
 	for i, word := range fs.Args() {
-		prefix := kobodict.WordPrefix(word)
+		prefix := pfn(word)
 		last := i == fs.NArg()-1
 
 		switch *format {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	commands = append(commands, &command{Name: "reshard", Short: "r", Description: "Re-calculate the prefixes of a dictzip file (e.g. v1 to v2)", Main: reshardMain})
+}
+
+func reshardMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	output := fs.StringP("output", "o", "", "The output dictzip filename (will be overwritten if it exists) (default: the input filename with the prefix algorithm inserted before the extension)")
+	method := fs.StringP("prefix", "P", "v2", "The prefix algorithm to convert to (v2 - firmware 4.7.10364+, v1 - older firmware versions, ja - Japanese dictionaries like jaxxdjs)")
+	crypt := fs.StringP("crypt", "c", "", "Decrypt and re-encrypt the dictzip using the specified encryption method (format: method:keyhex)")
+	discard := fs.Bool("discard", false, "Discard text outside of <w> entries (e.g. words missing the <w> tags in v1 dictionaries) instead of failing")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictzip\n\nOptions:\n%s", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	pfn, err := kobodict.ParsePrefixFunc(*method)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid prefix algorithm %#v, see --help for more details.\n", *method)
+		return 2
+	}
+
+	var c kobodict.Crypter
+	if *crypt != "" {
+		if spl := strings.SplitN(*crypt, ":", 2); len(spl) < 2 {
+			fmt.Fprintf(os.Stderr, "Error: invalid format for --crypt: no ':' found.\n")
+			return 2
+		} else if key, err := hex.DecodeString(spl[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid format for --crypt: decode hex: %v.\n", err)
+			return 2
+		} else if enc, err := kobodict.NewCrypter(spl[0], key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid format for --crypt: initialize encrypter: %v.\n", err)
+			return 2
+		} else {
+			c = enc
+		}
+	}
+
+	fn, err := filepath.Abs(fs.Args()[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: resolve input path %#v: %v.\n", fs.Args()[0], err)
+		return 2
+	}
+
+	ofn := *output
+	if ofn == "" {
+		ofn = strings.TrimSuffix(fn, filepath.Ext(fn)) + "." + *method + filepath.Ext(fn)
+	}
+	if ofn, err = filepath.Abs(ofn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: resolve output path %#v: %v.\n", *output, err)
+		return 2
+	} else if ofn == fn {
+		fmt.Fprintf(os.Stderr, "Error: output must not be the same as the input.\n")
+		return 2
+	}
+
+	fmt.Printf("Opening input dictzip.\n")
+	f, err := os.Open(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: open input file %#v: %v.\n", fn, err)
+		return 1
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: stat input file %#v: %v.\n", fn, err)
+		return 1
+	}
+
+	fmt.Printf("Parsing dictzip.\n")
+	dr, err := kobodict.NewReader(f, s.Size())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: parse input file %#v: %v.\n", fn, err)
+		return 1
+	}
+	dr.SetDecrypter(c)
+
+	fmt.Printf("Creating output temp file\n")
+	tf, err := ioutil.TempFile(filepath.Dir(ofn), "tmp_dicthtml.*.zip")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: create output temp file: %v.\n", err)
+		return 2
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	fmt.Printf("Resharding dictzip using prefix algorithm %s.\n", *method)
+	dw := kobodict.NewWriter(tf)
+	dw.SetEncrypter(c)
+	dw.SetPrefixFunc(pfn)
+
+	if *discard {
+		if n, err := kobodict.ReshardDiscard(dw, dr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: reshard %#v to %#v: %v.\n", fn, ofn, err)
+			return 1
+		} else if n != 0 {
+			fmt.Fprintf(os.Stderr, "Warning: discarded %d fragment(s) of text outside of <w> entries.\n", n)
+		}
+	} else if err := kobodict.Reshard(dw, dr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reshard %#v to %#v: %v.\n", fn, ofn, err)
+		return 1
+	}
+
+	if err := dw.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reshard %#v to %#v: %v.\n", fn, ofn, err)
+		return 1
+	}
+
+	fmt.Printf("Renaming output file.\n")
+	if err := tf.Chmod(0644); err != nil && runtime.GOOS != "windows" {
+		fmt.Fprintf(os.Stderr, "Error: set output file permissions: %v.\n", err)
+		return 2
+	}
+	if err := tf.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: sync output file: %v.\n", err)
+		return 2
+	}
+	if err := tf.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: close output file: %v.\n", err)
+		return 2
+	}
+	if err := os.Rename(tf.Name(), ofn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: rename output file: %v.\n", err)
+		return 2
+	}
+
+	fmt.Printf("Successfully resharded dictzip %#v to %#v.\n", fn, ofn)
+	return 0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/dictutil/internal/dictapi"
+	"github.com/pgaskin/dictutil/internal/preview"
+	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	commands = append(commands, &command{Name: "serve", Short: "S", Description: "Preview a dictzip in a browser or serve a JSON API", Main: serveMain})
+}
+
+func serveMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	addr := fs.StringP("addr", "a", "localhost:8080", "The address to listen on")
+	crypt := fs.StringP("crypt", "c", "", "Decrypt the dictzip (if needed) using the specified encryption method (format: method:keyhex)")
+	keyringFn := fs.StringP("keyring", "k", "", "Decrypt the dictzips (if needed) using the keys in the specified file (see below)")
+	prefix := fs.StringP("prefix", "P", "v2", "The prefix algorithm the dictzip uses (v1, v2, or ja) (see dictutil prefix --help)")
+	api := fs.Bool("api", false, "Serve a JSON API for one or more dictzips instead of the preview (see below)")
+	cors := fs.String("cors", "", "With --api, allow requests from the specified origin (or *)")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() == 0 || (!*api && fs.NArg() != 1) {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictzip\n       %s [options] --api dictzip...\n\nOptions:\n%s\nStarts a local HTTP server to preview the dictzip. The entries for a word are found in the same way as on a Kobo eReader, and are shown in an approximation of the dictionary webview. If --prefix isn't specified, ja is used for dicthtml-ja* and the default otherwise.\n\nWith --api, a JSON API is served instead (see the documentation for the endpoints). Each dictzip is identified by its filename without the extension.\n\nThe keyring contains a line for each key, with a filename (or a glob matching the base name) and the key (method:keyhex) separated by whitespace. Blank lines and lines starting with # are ignored. The first matching key is used, falling back to --crypt.\n\nThe dictzips are reloaded automatically when they change.\n", args[0], args[0], fs.FlagUsages())
+		return 0
+	}
+
+	if *cors != "" && !*api {
+		fmt.Fprintf(os.Stderr, "Error: --cors can only be used with --api.\n")
+		return 2
+	}
+
+	var c kobodict.Crypter
+	if *crypt != "" {
+		var err error
+		if c, err = parseCrypter(*crypt); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid format for --crypt: %v.\n", err)
+			return 2
+		}
+	}
+
+	var kr keyring
+	if *keyringFn != "" {
+		var err error
+		if kr, err = readKeyring(*keyringFn); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for --keyring: %v.\n", err)
+			return 2
+		}
+	}
+
+	pfn, err := kobodict.ParsePrefixFunc(*prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --prefix, see --help for details.\n")
+		return 2
+	}
+
+	// prefixFor returns the prefix function for a dictzip, using the Japanese
+	// one for Japanese dictzips unless --prefix was specified
+	prefixFor := func(fn string) kobodict.PrefixFunc {
+		if !fs.Changed("prefix") && strings.HasPrefix(filepath.Base(fn), "dicthtml-ja") {
+			return kobodict.WordPrefixJapanese
+		}
+		return pfn
+	}
+
+	// load reads a dictzip into memory so it can be replaced while it's being
+	// served
+	load := func(fn string) (*kobodict.Reader, error) {
+		fmt.Printf("Loading dictzip %#v.\n", fn)
+
+		buf, err := os.ReadFile(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: read dictzip %#v: %v.\n", fn, err)
+			return nil, err
+		}
+
+		dr, err := kobodict.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: parse dictzip %#v: %v.\n", fn, err)
+			return nil, err
+		}
+		if k := kr.Find(fn); k != nil {
+			dr.SetDecrypter(k)
+		} else {
+			dr.SetDecrypter(c)
+		}
+
+		fmt.Printf("Successfully loaded dictzip %#v with %d words.\n", fn, len(dr.Word))
+		return dr, nil
+	}
+
+	var h http.Handler
+	if *api {
+		as := &dictapi.Server{CORS: *cors}
+		ids := map[string]string{}
+		for _, fn := range fs.Args() {
+			id := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+			if x, ok := ids[id]; ok {
+				fmt.Fprintf(os.Stderr, "Error: dictzips %#v and %#v have the same id %#v.\n", x, fn, id)
+				return 2
+			}
+			ids[id] = fn
+
+			fn, dpfn := fn, prefixFor(fn)
+			go preview.Watch(time.Second, func() []string {
+				dr, err := load(fn)
+				as.Update(id, dr, dpfn, err)
+				return []string{fn}
+			})
+		}
+		h = as
+	} else {
+		fn := fs.Args()[0]
+		ps, dpfn := &preview.Server{Title: fn}, prefixFor(fn)
+		go preview.Watch(time.Second, func() []string {
+			dr, err := load(fn)
+			ps.Update(dr, dpfn, err)
+			return []string{fn}
+		})
+		h = ps
+	}
+
+	if *api {
+		fmt.Printf("Serving API on http://%s/api/.\n", *addr)
+	} else {
+		fmt.Printf("Serving preview on http://%s/.\n", *addr)
+	}
+	if err := http.ListenAndServe(*addr, h); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v.\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+	"github.com/spf13/pflag"
+)
+
+// parseKey parses a hex-encoded key, or reads one from the specified file if
+// it isn't valid hex.
+func parseKey(s string, size int) ([]byte, error) {
+	if key, err := hex.DecodeString(s); err == nil && len(key) == size {
+		return key, nil
+	}
+	buf, err := ioutil.ReadFile(s)
+	if err != nil {
+		return nil, fmt.Errorf("not a %d-byte hex key, and could not read key file: %w", size, err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("read key file %#v: decode hex: %w", s, err)
+	} else if len(key) != size {
+		return nil, fmt.Errorf("read key file %#v: key must be %d bytes, got %d", s, size, len(key))
+	}
+	return key, nil
+}
+
+// verifyDictzip checks the signature of the dictzip at fn (which should be
+// opened as f) from the sidecar file if it exists, or the zip comment
+// otherwise. It returns a description of where the signature was read from.
+func verifyDictzip(fn string, f *os.File, size int64, key ed25519.PublicKey) (string, error) {
+	var src, sig string
+	if buf, err := ioutil.ReadFile(fn + ".sig"); err == nil {
+		src, sig = "sidecar file "+filepath.Base(fn)+".sig", string(buf)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("read sidecar signature: %w", err)
+	} else if sig, err = kobodict.ReadCommentSignature(f, size); err != nil {
+		return "", fmt.Errorf("read zip comment signature: %w", err)
+	} else if sig == "" {
+		return "", fmt.Errorf("no signature found (in the zip comment or a .sig sidecar file)")
+	} else {
+		src = "zip comment"
+	}
+	if err := kobodict.Verify(f, size, sig, key); err != nil {
+		return "", fmt.Errorf("verify signature from %s: %w", src, err)
+	}
+	return src, nil
+}
+
+// the stuff above is shared with verify and install
+
+func init() {
+	commands = append(commands, &command{Name: "sign", Short: "s", Description: "Sign a dictzip file", Main: signMain})
+}
+
+func signMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	key := fs.StringP("key", "k", "", "The ed25519 private key seed to sign with (hex, or a file containing it)")
+	sidecar := fs.BoolP("sidecar", "s", false, "Write the signature to a .sig file next to the dictzip instead of the zip comment")
+	generate := fs.Bool("generate-key", false, "Instead of signing, generate a new keypair and print it to stdout")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *generate {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: generate keypair: %v.\n", err)
+			return 1
+		}
+		fmt.Printf("private: %x\npublic:  %x\n", priv.Seed(), []byte(pub))
+		return 0
+	}
+
+	if *help || fs.NArg() != 1 || *key == "" {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictzip\n\nOptions:\n%s\nThe signature covers the names and contents of the files in the dictzip, so\nit stays valid if the dictzip is re-packed without changing its contents.\n", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	seed, err := parseKey(*key, ed25519.SeedSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid private key: %v.\n", err)
+		return 2
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+
+	fn, err := filepath.Abs(fs.Args()[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: resolve input path %#v: %v.\n", fs.Args()[0], err)
+		return 2
+	}
+
+	fmt.Printf("Opening dictzip.\n")
+	f, err := os.Open(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: open dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: stat dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+
+	fmt.Printf("Signing dictzip.\n")
+	sig, err := kobodict.Sign(f, s.Size(), priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: sign dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+
+	if *sidecar {
+		fmt.Printf("Writing sidecar signature.\n")
+		if err := ioutil.WriteFile(fn+".sig", []byte(sig+"\n"), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write sidecar signature: %v.\n", err)
+			return 1
+		}
+		fmt.Printf("Successfully signed dictzip %#v to %#v.\n", fn, fn+".sig")
+		return 0
+	}
+
+	fmt.Printf("Writing signature to zip comment.\n")
+	tf, err := ioutil.TempFile(filepath.Dir(fn), "tmp_dicthtml.*.zip")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: create output temp file: %v.\n", err)
+		return 1
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	if err := kobodict.WriteCommentSignature(tf, f, s.Size(), sig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: write signed dictzip: %v.\n", err)
+		return 1
+	}
+
+	f.Close()
+	if err := tf.Chmod(s.Mode().Perm()); err != nil && runtime.GOOS != "windows" {
+		fmt.Fprintf(os.Stderr, "Error: set output file permissions: %v.\n", err)
+		return 1
+	}
+	if err := tf.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: sync output file: %v.\n", err)
+		return 1
+	}
+	if err := tf.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: close output file: %v.\n", err)
+		return 1
+	}
+	if err := os.Rename(tf.Name(), fn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: rename output file: %v.\n", err)
+		return 1
+	}
+
+	fmt.Printf("Successfully signed dictzip %#v.\n", fn)
+	return 0
+}
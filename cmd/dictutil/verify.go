@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	commands = append(commands, &command{Name: "verify", Short: "v", Description: "Verify the signature of a dictzip file", Main: verifyMain})
+}
+
+func verifyMain(args []string, fs *pflag.FlagSet) int {
+	fs.SortFlags = false
+	key := fs.StringP("key", "k", "", "The ed25519 public key to verify with (hex, or a file containing it)")
+	help := fs.BoolP("help", "h", false, "Show this help text")
+	fs.Parse(args[1:])
+
+	if *help || fs.NArg() != 1 || *key == "" {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] dictzip\n\nOptions:\n%s\nIf a .sig sidecar file exists next to the dictzip, it is used instead of the\nzip comment.\n", args[0], fs.FlagUsages())
+		return 0
+	}
+
+	pub, err := parseKey(*key, ed25519.PublicKeySize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid public key: %v.\n", err)
+		return 2
+	}
+
+	fn := fs.Args()[0]
+
+	f, err := os.Open(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: open dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+	defer f.Close()
+
+	s, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: stat dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+
+	src, err := verifyDictzip(fn, f, s.Size(), pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: dictzip %#v: %v.\n", fn, err)
+		return 1
+	}
+
+	fmt.Printf("Successfully verified dictzip %#v (signature from %s).\n", fn, src)
+	return 0
+}
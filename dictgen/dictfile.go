@@ -1,9 +1,9 @@
 package dictgen
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"text/template"
 )
@@ -19,184 +19,226 @@ type DictFileEntry struct {
 	NoHeader   bool
 	HeaderInfo string
 
+	Attr map[string][]string // custom attributes (%key value), which are available to the template but not shown by default
+
 	RawHTML    bool
 	Definition string
 
 	PostRawHTML string // will not be parsed or saved, only to be used for runtime additions before generating
 
-	line int // for internal use if parsed, zero otherwise
+	file     string   // for internal use if parsed from a file, empty otherwise
+	line     int      // for internal use if parsed, zero otherwise
+	pre      []string // for internal use by FormatDictFile (comment and include lines before the entry)
+	comments bool     // for internal use by FormatDictFile (the definition ends with comments)
 }
 
-// ParseDictFile parses a DictFile from it's textual representation (usually
-// stored in a file with the extension .df).
-func ParseDictFile(r io.Reader) (DictFile, error) {
-	var df DictFile
-	var dfe *DictFileEntry
+// attrKeyRe matches valid attribute keys. They are restricted so a definition
+// starting with % (e.g. "%50 of") isn't silently parsed as an attribute.
+var attrKeyRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
 
-	br := bufio.NewScanner(r)
-	br.Buffer(make([]byte, 64*1024), 2048*1024) // start with a 64KiB buffer, but allow up to 2MiB (for dictfiles with long lines of raw HTML)
-	var line int
+// AttrValue returns the first value of the attribute with the specified key,
+// or an empty string if it isn't set.
+func (d DictFileEntry) AttrValue(key string) string {
+	if v := d.Attr[key]; len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
 
-	for br.Scan() {
-		buf := br.Bytes()
-		line++
+// Position returns the file and line the entry was parsed from. The file will
+// be empty if it wasn't parsed from a file (e.g. with ParseDictFile), and the
+// line will be zero if it wasn't parsed at all.
+func (d *DictFileEntry) Position() (file string, line int) {
+	return d.file, d.line
+}
 
-		if len(buf) == 0 {
-			// if in a block and after the metadata (in the definition),
-			// preserve the blank line
-			if dfe != nil && len(dfe.Definition) != 0 {
-				dfe.Definition += "\n"
-			}
-			continue
-		}
+// DictFileError is returned for syntax errors when parsing a DictFile.
+type DictFileError struct {
+	File string // empty if not parsed from a file
+	Line int
+	Err  error
+}
 
-		switch buf[0] {
-		case '@':
-			// start another one
-			dfe = new(DictFileEntry)
+// Error implements error. If the file is known, it is in the file:line: format
+// recognized by most editors.
+func (e *DictFileError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("dictfile: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
 
-			// add the headword and line info
-			dfe.Headword = strings.TrimSpace(string(buf[1:]))
-			dfe.line = line
+// Unwrap returns the underlying error.
+func (e *DictFileError) Unwrap() error {
+	return e.Err
+}
 
-			// but error if the headword is blank (note that duplicates are
-			// acceptable, and encouraged in some cases; Kobo will merge it;
-			// try looking up 'be' in the English dictionary)
-			if len(dfe.Headword) == 0 {
-				return nil, fmt.Errorf("dictfile: line %d: empty headword after @", line)
-			}
+// ParseDictFile parses a DictFile from it's textual representation (usually
+// stored in a file with the extension .df). Include directives are resolved
+// relative to the current directory.
+//
+// Lines starting with // are comments, and are ignored. Within the definition
+// content, comments must have a space after the //, and must not be followed
+// by more of the definition (since these lines used to be part of the
+// definition, e.g. protocol-relative URLs). Lines starting with
+// #include followed by a path or glob will be replaced with the entries in the
+// matching files. Lines in the form "key: value" before the first entry or
+// include directive are the header (see ParseDictFileWithHeader).
+func ParseDictFile(r io.Reader) (DictFile, error) {
+	df, _, err := readDictFile(NewDictFileScanner(r))
+	return df, err
+}
 
-			// otherwise, add it to the dictfile (remember it's a pointer, it'll
-			// still get updated)
-			df = append(df, dfe)
-		case ':':
-			// if not in a block (before the first @), return an error
-			if dfe == nil {
-				return nil, fmt.Errorf("dictfile: line %d: header info (: or ::) specified before word (@)", line)
-			}
+// ParseDictFileWithHeader is like ParseDictFile, but also returns the header.
+// The returned header will never be nil.
+func ParseDictFileWithHeader(r io.Reader) (DictFile, *DictFileHeader, error) {
+	return readDictFile(NewDictFileScanner(r))
+}
 
-			// if already after the metadata (in the definition), return an error
-			if len(dfe.Definition) != 0 {
-				return nil, fmt.Errorf("dictfile: line %d: header info (: or ::) specified within definition content (prepend a space if this was intended to be part of the definition itself)", line)
-			}
+// OpenDictFile parses a DictFile from the specified file. Include directives
+// are resolved relative to the directory containing the file, and errors will
+// contain the filename.
+func OpenDictFile(name string) (DictFile, error) {
+	df, _, err := OpenDictFileWithHeader(name)
+	return df, err
+}
 
-			// if already seen the header info (a line starting with :)
-			if dfe.NoHeader || len(dfe.HeaderInfo) != 0 {
-				return nil, fmt.Errorf("dictfile: line %d: multiple header infos (: or ::) specified in definition block", line)
-			}
+// OpenDictFileWithHeader is like OpenDictFile, but also returns the header.
+// The returned header will never be nil.
+func OpenDictFileWithHeader(name string) (DictFile, *DictFileHeader, error) {
+	s, err := OpenDictFileScanner(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readDictFile(s)
+}
 
-			// put the trimmed text in the header info, or disable the header if
-			// it is ::
-			if len(buf) >= 2 {
-				if buf[1] == ':' {
-					if len(strings.TrimSpace(string(buf[2:]))) != 0 {
-						return nil, fmt.Errorf("dictfile: line %d: extra data after no header specified (::)", line)
-					}
-					dfe.NoHeader = true
-				} else {
-					dfe.HeaderInfo = strings.TrimSpace(string(buf[1:]))
-				}
-			} else {
-				dfe.HeaderInfo = ""
-			}
-		case '&':
-			// if not in a block, error
-			if dfe == nil {
-				return nil, fmt.Errorf("dictfile: line %d: variant (&) specified before word (@)", line)
-			}
+func readDictFile(s *DictFileScanner) (DictFile, *DictFileHeader, error) {
+	var df DictFile
+	for s.Scan() {
+		df = append(df, s.Entry())
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
 
-			// if already after the metadata (in the definition), error
-			if len(dfe.Definition) != 0 {
-				return nil, fmt.Errorf("dictfile: line %d: variant (&) specified within definition content (prepend a space if this was intended to be part of the definition itself)", line)
-			}
+	// note: validation is done separately (and always done before generation)
 
-			// trim the rest of the line (error if nothing left)
-			v := strings.TrimSpace(string(buf[1:]))
-			if len(v) == 0 {
-				return nil, fmt.Errorf("dictfile: line %d: no word after variant specifier (&)", line)
-			}
+	return df, s.Header(), nil
+}
 
-			// and add it to the variant list
-			dfe.Variant = append(dfe.Variant, v)
-		default:
-			// if not in a block, error
-			if dfe == nil {
-				return nil, fmt.Errorf("dictfile: line %d: definition specified before word (@)", line)
-			}
+// finishDictFileEntry updates the raw html flag and cleans up whitespace after
+// an entry has been parsed.
+func finishDictFileEntry(dfe *DictFileEntry) error {
+	dfe.Definition = strings.TrimSpace(dfe.Definition)
 
-			// append the line to the definition
-			dfe.Definition += string(buf) + "\n"
+	if v := strings.TrimSpace(strings.TrimPrefix(dfe.Definition, "<html>")); v != dfe.Definition {
+		if strings.HasSuffix(v, "</html>") {
+			return &DictFileError{dfe.file, dfe.line, fmt.Errorf("entry: raw HTML definitions are specified with <html>, but SHOULD NOT be a full HTML document ending with </html>")}
 		}
+		dfe.RawHTML = true
+		dfe.Definition = v
+	} else if strings.Contains(dfe.Definition, "<html>") {
+		return &DictFileError{dfe.file, dfe.line, fmt.Errorf("entry: why does the definition contain a <html> tag ... to make it raw HTML, it should be at the very beginning")}
 	}
+	return nil
+}
 
-	// check for read errors
-	if err := br.Err(); err != nil {
-		return nil, err
-	}
-
-	// and finally, update the raw html flag and cleanup whitespace
-	for _, dfe := range df {
-		dfe.Definition = strings.TrimSpace(dfe.Definition)
-
-		if v := strings.TrimSpace(strings.TrimPrefix(dfe.Definition, "<html>")); v != dfe.Definition {
-			if strings.HasSuffix(v, "</html>") {
-				return nil, fmt.Errorf("dictfile: entry at line %d: raw HTML definitions are specified with <html>, but SHOULD NOT be a full HTML document ending with </html>", dfe.line)
+// Validate validates the entries in the DictFile. Note that duplicate entries
+// are fine, and are encouraged if necessary (Kobo will merge them).
+func (df DictFile) Validate() error {
+	for i, dfe := range df {
+		if err := dfe.validate(i); err != nil {
+			if dfe.line != 0 {
+				return &DictFileError{dfe.file, dfe.line, err}
 			}
-			dfe.RawHTML = true
-			dfe.Definition = v
-		} else if strings.Contains(dfe.Definition, "<html>") {
-			return nil, fmt.Errorf("dictfile: entry at line %d: why does the definition contain a <html> tag ... to make it raw HTML, it should be at the very beginning", dfe.line)
+			return err
 		}
 	}
+	return nil
+}
 
-	// note: validation is done separately (and always done before generation)
-
-	return df, nil
+// ValidateWord checks if a word can be used as a headword or variant.
+func ValidateWord(word string) error {
+	if strings.TrimSpace(word) == "" {
+		return fmt.Errorf("must not be blank")
+	} else if err := validateIllegal(word, true); err != nil {
+		return fmt.Errorf("contains illegal string: %w", err)
+	}
+	return nil
 }
 
-// Validate validates the entries in the DictFile. Note that duplicate entries
-// are fine, and are encouraged if necessary (Kobo will merge them).
-func (df DictFile) Validate() error {
-	illegal := func(s string, word bool) error {
-		if word && strings.Contains(s, "\"") {
-			return fmt.Errorf("must not contain %#v", "\"")
-		}
-		for _, c := range []string{
-			"<w", "</w",
-			"<html", "</html",
-			"<var", "</var",
-			"<a name=",
-		} {
-			// TODO: optimize
-			if strings.Contains(s, c) {
-				return fmt.Errorf("must not contain %#v", c)
-			}
+func (dfe *DictFileEntry) validate(i int) error {
+	if strings.TrimSpace(dfe.Headword) == "" {
+		return fmt.Errorf("word %#v (i:%d, dfe:%#v): headword must not be blank", dfe.Headword, i, dfe)
+	} else if err := validateIllegal(dfe.Headword, true); err != nil {
+		return fmt.Errorf("word %#v (i:%d): headword contains illegal string: %w", dfe.Headword, i, err)
+	}
+	for _, v := range dfe.Variant {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("word %#v (i:%d): variant %#v must not be blank", dfe.Headword, i, v)
+		} else if err := validateIllegal(v, true); err != nil {
+			return fmt.Errorf("word %#v (i:%d): variant %#v contains illegal string : %w", dfe.Headword, i, v, err)
 		}
-		return nil
 	}
-	for i, dfe := range df {
-		if strings.TrimSpace(dfe.Headword) == "" {
-			return fmt.Errorf("word %#v (i:%d, dfe:%#v): headword must not be blank", dfe.Headword, i, dfe)
-		} else if err := illegal(dfe.Headword, true); err != nil {
-			return fmt.Errorf("word %#v (i:%d): headword contains illegal string: %w", dfe.Headword, i, err)
+	for k, vs := range dfe.Attr {
+		if !attrKeyRe.MatchString(k) {
+			return fmt.Errorf("word %#v (i:%d): attribute key %#v must start with a letter and only contain letters, digits, -, and _", dfe.Headword, i, k)
 		}
-		for _, v := range dfe.Variant {
-			if strings.TrimSpace(v) == "" {
-				return fmt.Errorf("word %#v (i:%d): variant %#v must not be blank", dfe.Headword, i, v)
-			} else if err := illegal(v, true); err != nil {
-				return fmt.Errorf("word %#v (i:%d): variant %#v contains illegal string : %w", dfe.Headword, i, v, err)
+		for _, v := range vs {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("word %#v (i:%d): attribute %#v value %#v must not contain newlines", dfe.Headword, i, k, v)
+			} else if err := validateIllegal(v, false); err != nil {
+				return fmt.Errorf("word %#v (i:%d): attribute %#v value %#v contains illegal string : %w", dfe.Headword, i, k, v, err)
 			}
 		}
-		if err := illegal(dfe.HeaderInfo, false); err != nil {
-			return fmt.Errorf("word %#v (i:%d): header info %#v contains illegal string : %w", dfe.Headword, i, dfe.HeaderInfo, err)
-		}
-		if err := illegal(dfe.Definition, false); err != nil {
-			return fmt.Errorf("word %#v (i:%d): definition %#v contains illegal string : %w", dfe.Headword, i, dfe.Definition, err)
+	}
+	if err := validateIllegal(dfe.HeaderInfo, false); err != nil {
+		return fmt.Errorf("word %#v (i:%d): header info %#v contains illegal string : %w", dfe.Headword, i, dfe.HeaderInfo, err)
+	}
+	if err := validateIllegal(dfe.Definition, false); err != nil {
+		return fmt.Errorf("word %#v (i:%d): definition %#v contains illegal string : %w", dfe.Headword, i, dfe.Definition, err)
+	}
+	return nil
+}
+
+func validateIllegal(s string, word bool) error {
+	if word && strings.Contains(s, "\"") {
+		return fmt.Errorf("must not contain %#v", "\"")
+	}
+	for _, c := range []string{
+		"<w", "</w",
+		"<html", "</html",
+		"<var", "</var",
+		"<a name=",
+	} {
+		// TODO: optimize
+		if strings.Contains(s, c) {
+			return fmt.Errorf("must not contain %#v", c)
 		}
 	}
 	return nil
 }
 
+var (
+	sanitizeWbrRe     = regexp.MustCompile(`(?i)<wbr\s*/?>`)
+	sanitizeWrapperRe = regexp.MustCompile(`(?i)</?(?:html|body|head)\b[^>]*>`)
+	sanitizeVarRe     = regexp.MustCompile(`(?i)<(/?)var\b`)
+	sanitizeAnchorRe  = regexp.MustCompile(`(?i)<a\s+name=`)
+)
+
+// SanitizeHTML removes or replaces the parts of raw HTML from other
+// dictionary formats which aren't allowed in a definition (see Validate), i.e.
+// <wbr>, <html>, <body>, and <head> tags are removed, <var> is replaced with
+// <i>, and <a name="..."> is replaced with <a id="...">.
+func SanitizeHTML(s string) string {
+	s = sanitizeWbrRe.ReplaceAllString(s, "")
+	s = sanitizeWrapperRe.ReplaceAllString(s, "")
+	s = sanitizeVarRe.ReplaceAllString(s, "<${1}i")
+	s = sanitizeAnchorRe.ReplaceAllString(s, "<a id=")
+	return strings.TrimSpace(s)
+}
+
 // WriteDictFile validates the DictFile and writes it to w in the dictfile
 // format.
 func (df DictFile) WriteDictFile(w io.Writer) error {
@@ -205,6 +247,11 @@ func (df DictFile) WriteDictFile(w io.Writer) error {
 	}
 
 	for _, dfe := range df {
+		for _, line := range dfe.pre {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
 		if err := dfe.writeDictFileEntry(w); err != nil {
 			return err
 		}
@@ -217,14 +264,23 @@ func (df DictFile) WriteDictFile(w io.Writer) error {
 	return nil
 }
 
+var dictFileEscaper = strings.NewReplacer(
+	"\n@", "\n @",
+	"\n:", "\n :",
+	"\n&", "\n &",
+	"\n//", "\n //",
+	"\n#include", "\n #include",
+)
+
 // note: this assumes the entry is valid
 var dictFileEntryTmpl = template.Must(template.New("").Funcs(template.FuncMap{
 	"dfesc": func(str string) string {
-		return strings.NewReplacer(
-			"\n@", "\n @",
-			"\n:", "\n :",
-			"\n&", "\n &",
-		).Replace(str)
+		// attributes are only parsed before the definition
+		if strings.HasPrefix(str, "%") {
+			str = " " + str
+		}
+		// the leading newline is so the first line is also escaped
+		return dictFileEscaper.Replace("\n" + str)[1:]
 	},
 }).Parse(`
 {{- /* trim leading whitespace from template */ -}}
@@ -238,6 +294,9 @@ var dictFileEntryTmpl = template.Must(template.New("").Funcs(template.FuncMap{
 {{range .Variant}}
 & {{.}}{{end -}}
 
+{{range $k, $vs := .Attr}}{{range $vs}}
+%{{$k}}{{with .}} {{.}}{{end}}{{end}}{{end -}}
+
 {{with .RawHTML}}
 <html>{{end -}}
 
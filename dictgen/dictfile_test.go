@@ -3,7 +3,10 @@ package dictgen
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -96,6 +99,71 @@ test</p></w><w><p><a name="markdown" /><b>markdown</b> -test</p><var></var><ol>
 </ol>
 
 <p>Blah blah blah.</p></w></html>`,
+}, {
+	What: "attributes",
+	In: `@ test
+: -noun
+%pos noun
+& tests
+%ipa /ˈtɛst/
+%tag legal
+%tag  common
+%empty
+%note before the definition
+A procedure.
+%also not an attribute
+@ percent
+ %50`,
+	Out: DictFile{
+		{Headword: "test", Variant: []string{"tests"}, HeaderInfo: "-noun", Attr: map[string][]string{"pos": {"noun"}, "ipa": {"/ˈtɛst/"}, "tag": {"legal", "common"}, "empty": {""}, "note": {"before the definition"}}, Definition: "A procedure.\n%also not an attribute", line: 1},
+		{Headword: "percent", Definition: "%50", line: 12},
+	},
+	OutDictFile: `@ test
+: -noun
+& tests
+%empty
+%ipa /ˈtɛst/
+%note before the definition
+%pos noun
+%tag legal
+%tag common
+A procedure.
+%also not an attribute
+
+@ percent
+ %50
+
+`,
+	OutKoboHTML: `<html><w><p><a name="percent" /><b>percent</b></p><var></var><p>%50</p></w><w><p><a name="test" /><b>test</b> -noun</p><var><variant name="tests"/></var><p>A procedure.
+%also not an attribute</p></w></html>`,
+}, {
+	What: "comments",
+	In: `// comment before the first entry
+@ word
+// comment in the header
+: info
+test
+ // escaped comment
+#hashtag
+test
+// comment at the end of the definition
+
+// comment after the definition`,
+	Out: DictFile{
+		{Headword: "word", Variant: []string(nil), NoHeader: false, HeaderInfo: "info", RawHTML: false, Definition: "test\n // escaped comment\n#hashtag\ntest", line: 2},
+	},
+	OutDictFile: `@ word
+: info
+test
+ // escaped comment
+#hashtag
+test
+
+`,
+	OutKoboHTML: `<html><w><p><a name="word" /><b>word</b> info</p><var></var><p>test
+ // escaped comment
+#hashtag
+test</p></w></html>`,
 }}
 
 func TestDictFile(t *testing.T) {
@@ -164,3 +232,204 @@ func TestDictFile(t *testing.T) {
 		}
 	}
 }
+
+func TestDictFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	for fn, buf := range map[string]string{
+		"main.df":       "@ main\ntest\n#include entries/*.df\n@ after\n#include other.df\n",
+		"entries/a.df":  "// a\n@ a\ntest\n",
+		"entries/b.df":  "@ b\n#include ../other.df\n",
+		"other.df":      "@ other\ntest\n",
+		"cycle.df":      "@ cycle\n#include cycle2.df\n",
+		"cycle2.df":     "#include cycle.df\n",
+		"missing.df":    "@ missing\n#include nonexistent/*.df\n",
+		"invalid.df":    "@ valid\n\n@ invalid\n& \"\n",
+		"includeinv.df": "#include invalid.df\n",
+		"entries/c.txt": "not included",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, fn)), 0755); err != nil {
+			t.Fatalf("write test file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(buf), 0644); err != nil {
+			t.Fatalf("write test file: %v", err)
+		}
+	}
+
+	df, err := OpenDictFile(filepath.Join(dir, "main.df"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var act []string
+	for _, dfe := range df {
+		file, line := dfe.Position()
+		rel, _ := filepath.Rel(dir, file)
+		act = append(act, fmt.Sprintf("%s:%s:%d", dfe.Headword, filepath.ToSlash(rel), line))
+	}
+	if exp := []string{"main:main.df:1", "a:entries/a.df:2", "b:entries/b.df:1", "other:other.df:1", "after:main.df:4", "other:other.df:1"}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("expected entries %q, got %q", exp, act)
+	}
+	if df[0].Definition != "test" {
+		t.Errorf("expected include to end the previous entry, got definition %q", df[0].Definition)
+	}
+
+	var dfErr *DictFileError
+	if _, err := OpenDictFile(filepath.Join(dir, "cycle.df")); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("expected include cycle error, got %v", err)
+	}
+	if _, err := OpenDictFile(filepath.Join(dir, "missing.df")); err == nil || !strings.Contains(err.Error(), "no files matched") {
+		t.Errorf("expected no files matched error, got %v", err)
+	} else if !errors.As(err, &dfErr) || dfErr.File != filepath.Join(dir, "missing.df") || dfErr.Line != 2 {
+		t.Errorf("expected error at missing.df:2, got %v", err)
+	}
+	if df, err := OpenDictFile(filepath.Join(dir, "includeinv.df")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if err := df.Validate(); !errors.As(err, &dfErr) || dfErr.File != filepath.Join(dir, "invalid.df") || dfErr.Line != 3 {
+		t.Errorf("expected validation error at invalid.df:3, got %v", err)
+	}
+}
+
+func TestDictFileHeader(t *testing.T) {
+	df, h, err := ParseDictFileWithHeader(strings.NewReader("// comment\ntitle: Test Dictionary\nLocale: en\n\nimage-method: remove\n@ word\ntest\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(df) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(df))
+	} else if exp := (DictFileHeader{Title: "Test Dictionary", Locale: "en", ImageMethod: "remove"}); *h != exp {
+		t.Errorf("expected header %+v, got %+v", exp, *h)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := h.WriteDictFileHeader(buf); err != nil {
+		t.Fatalf("write header: unexpected error: %v", err)
+	} else if exp := "title: Test Dictionary\nlocale: en\nimage-method: remove\n\n"; buf.String() != exp {
+		t.Errorf("write header: expected %q, got %q", exp, buf.String())
+	} else if err := df.WriteDictFile(buf); err != nil {
+		t.Fatalf("write dictfile: unexpected error: %v", err)
+	} else if _, ph, err := ParseDictFileWithHeader(buf); err != nil {
+		t.Fatalf("reparse: unexpected error: %v", err)
+	} else if *ph != *h {
+		t.Errorf("reparse: expected header %+v, got %+v", *h, *ph)
+	}
+
+	if _, h, err := ParseDictFileWithHeader(strings.NewReader("@ word\ntitle: not a header\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !h.IsZero() {
+		t.Errorf("expected empty header, got %+v", *h)
+	}
+
+	for _, c := range []string{
+		"title: a\ntitle: b\n@ word\n",
+		"unknown: a\n@ word\n",
+		"definition\n@ word\n",
+		"title:\n@ word\n",
+	} {
+		if _, err := ParseDictFile(strings.NewReader(c)); err == nil {
+			t.Errorf("%q: expected error", c)
+		}
+	}
+
+	m := &DictFileHeader{Title: "a"}
+	if err := m.Merge(&DictFileHeader{Title: "a", Locale: "fr"}); err != nil {
+		t.Errorf("merge: unexpected error: %v", err)
+	} else if exp := (DictFileHeader{Title: "a", Locale: "fr"}); *m != exp {
+		t.Errorf("merge: expected %+v, got %+v", exp, *m)
+	} else if err := m.Merge(&DictFileHeader{Title: "b"}); err == nil {
+		t.Errorf("merge: expected error for conflicting values")
+	}
+}
+
+func TestDictFileComments(t *testing.T) {
+	for _, c := range []struct {
+		In  string
+		Err string
+	}{
+		{"@ a\n// before the definition\nA.\n// after\n//\n\n@ b\nB.\n", ""},
+		{"@ a\nA.\n// comment\nA.\n", "dictfile: line 3: comment (//) followed by more definition content (prepend a space if this was intended to be part of the definition itself)"},
+		{"@ a\nA.\n// comment\n\n%50 of A.\n", "dictfile: line 3: comment (//) followed by more definition content (prepend a space if this was intended to be part of the definition itself)"},
+		{"@ a\n<html><img src=\"x.png\"\n//cdn.example.com/x.png\n", "dictfile: line 3: comment (//) without a space after it within definition content (prepend a space if this was intended to be part of the definition itself)"},
+	} {
+		if _, err := ParseDictFile(strings.NewReader(c.In)); c.Err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", c.In, err)
+		} else if c.Err != "" && (err == nil || err.Error() != c.Err) {
+			t.Errorf("%q: expected error %q, got %v", c.In, c.Err, err)
+		}
+	}
+}
+
+func TestDictFileAttributes(t *testing.T) {
+	for _, c := range []struct {
+		In  string
+		Err string
+	}{
+		{"@ a\n%pos noun\n%see-also b\n%x_1\nA.\n", ""},
+		{"@ a\n%50 of A.\n", `dictfile: line 2: invalid attribute key "50": must start with a letter and only contain letters, digits, -, and _ (prepend a space if this was intended to be part of the definition itself)`},
+		{"@ a\n%pos: noun\n", `dictfile: line 2: invalid attribute key "pos:": must start with a letter and only contain letters, digits, -, and _ (prepend a space if this was intended to be part of the definition itself)`},
+		{"@ a\n%\n", `dictfile: line 2: no key after attribute specifier (%)`},
+	} {
+		if _, err := ParseDictFile(strings.NewReader(c.In)); c.Err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", c.In, err)
+		} else if c.Err != "" && (err == nil || err.Error() != c.Err) {
+			t.Errorf("%q: expected error %q, got %v", c.In, c.Err, err)
+		}
+	}
+
+	if err := (DictFile{{Headword: "a", Attr: map[string][]string{"50": {"of"}}}}).Validate(); err == nil || !strings.Contains(err.Error(), `attribute key "50" must start with a letter`) {
+		t.Errorf("expected validation error for invalid attribute key, got %v", err)
+	}
+}
+
+func TestValidateWord(t *testing.T) {
+	for _, c := range []struct {
+		Word string
+		Err  string
+	}{
+		{"test", ""},
+		{"say hi", ""},
+		{"<b>", ""},
+		{" ", "must not be blank"},
+		{"say \"hi\"", `contains illegal string: must not contain "\""`},
+		{"<var>", `contains illegal string: must not contain "<var"`},
+	} {
+		if err := ValidateWord(c.Word); c.Err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", c.Word, err)
+		} else if c.Err != "" && (err == nil || err.Error() != c.Err) {
+			t.Errorf("%q: expected error %q, got %v", c.Word, c.Err, err)
+		}
+	}
+}
+
+func TestEntryTemplate(t *testing.T) {
+	for _, c := range []string{
+		`<w><a name="{{normhw .Headword}}" /></w>`,
+		`<w><p><a name="{{normhw .Headword}}" /><b>{{.Headword}}</b></p><var>{{range .Variant}}<variant name="{{.}}"/>{{end}}</var></w>`,
+		`<w><a name="{{normhw .Headword}}" /><var>{{range .Variant}}<variant name="{{normv .}}"/>{{end}}</var></w><w></w>`,
+		`<w><a name="{{normhw .Headword}}" /><var>{{range .Variant}}<variant name="{{normv .}}"/>{{end}}</var>{{.Unknown}}</w>`,
+	} {
+		if _, err := ParseEntryTemplate(c); err == nil {
+			t.Errorf("%q: expected error", c)
+		}
+	}
+
+	tmpl, err := ParseEntryTemplate(`<w><p><a name="{{normhw .Headword}}" /><b>{{.Headword}}</b>{{with .AttrValue "pos"}} <i>{{.}}</i>{{end}}</p><var>{{range .Variant}}<variant name="{{normv .}}"/>{{end}}</var>{{md .Definition}}</w>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := (DictFile{
+		{Headword: "Test", Variant: []string{"Tests"}, Attr: map[string][]string{"pos": {"noun"}}, Definition: "*Test*."},
+	}).WriteKoboHTMLOptions(buf, &KoboHTMLOptions{Template: tmpl}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if exp := `<html><w><p><a name="Test" /><b>Test</b> <i>noun</i></p><var><variant name="tests"/></var><p><em>Test</em>.</p></w></html>`; buf.String() != exp {
+		t.Errorf("expected %q, got %q", exp, buf.String())
+	}
+
+	tmpl, err = ParseEntryTemplate(`<w><a name="{{normhw .Headword}}" /><var>{{range .Variant}}<variant name="{{normv .}}"/>{{end}}</var>{{if eq .Headword "bad"}}</w>{{end}}</w>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := (DictFile{{Headword: "bad"}}).WriteKoboHTMLOptions(bytes.NewBuffer(nil), &KoboHTMLOptions{Template: tmpl}); err == nil {
+		t.Errorf("expected error for invalid template output")
+	}
+}
@@ -15,16 +15,22 @@ import (
 	"text/template"
 
 	"github.com/pgaskin/dictutil/kobodict"
-	"github.com/russross/blackfriday/v2"
 )
 
 // WriteDictzip writes the dictfile to a kobodict.Writer, which should not have
 // been used yet. The writer is not closed automatically. If the ImageHandler
 // requires a file to be opened (i.e. not ImageHandlerRemove), the provided
-// ImageFunc will be called.
+// ImageFunc will be called. The entries are sharded using the writer's prefix
+// function (see kobodict.Writer.SetPrefixFunc).
 func (df DictFile) WriteDictzip(dw *kobodict.Writer, ih ImageHandler, img ImageFunc) error {
+	return df.WriteDictzipOptions(dw, ih, img, nil)
+}
+
+// WriteDictzipOptions is like WriteDictzip, but with options for generating the
+// dicthtml (which may be nil), which are passed to WriteKoboHTMLOptions.
+func (df DictFile) WriteDictzipOptions(dw *kobodict.Writer, ih ImageHandler, img ImageFunc, opt *KoboHTMLOptions) error {
 	var prefixes []string
-	prefixed := df.Prefixed()
+	prefixed := df.PrefixedFunc(dw.Prefix)
 	for pfx := range prefixed {
 		prefixes = append(prefixes, pfx)
 	}
@@ -42,21 +48,30 @@ func (df DictFile) WriteDictzip(dw *kobodict.Writer, ih ImageHandler, img ImageF
 				}
 			}
 		}
-		hbuf.Reset()
-		if err := prefixed[pfx].WriteKoboHTML(hbuf); err != nil {
-			return fmt.Errorf("generate dicthtml for %s: %w", pfx, err)
-		} else if buf, err := transformHTMLImages(ih, dw, hbuf.Bytes(), img); err != nil {
-			return fmt.Errorf("generate dicthtml for %s: transform images: %w", pfx, err)
-		} else if hw, err := dw.CreateDicthtml(pfx); err != nil {
-			return fmt.Errorf("write dicthtml for %s: %w", pfx, err)
-		} else if _, err = hw.Write(buf); err != nil {
-			return fmt.Errorf("write dicthtml for %s: %w", pfx, err)
+		if err := writeDicthtml(dw, pfx, prefixed[pfx], hbuf, ih, img, opt); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// writeDicthtml generates and writes the dicthtml for a prefix using hbuf as a
+// scratch buffer.
+func writeDicthtml(dw *kobodict.Writer, pfx string, df DictFile, hbuf *bytes.Buffer, ih ImageHandler, img ImageFunc, opt *KoboHTMLOptions) error {
+	hbuf.Reset()
+	if err := df.WriteKoboHTMLOptions(hbuf, opt); err != nil {
+		return fmt.Errorf("generate dicthtml for %s: %w", pfx, err)
+	} else if buf, err := transformHTMLImages(ih, dw, hbuf.Bytes(), img); err != nil {
+		return fmt.Errorf("generate dicthtml for %s: transform images: %w", pfx, err)
+	} else if hw, err := dw.CreateDicthtml(pfx); err != nil {
+		return fmt.Errorf("write dicthtml for %s: %w", pfx, err)
+	} else if _, err = hw.Write(buf); err != nil {
+		return fmt.Errorf("write dicthtml for %s: %w", pfx, err)
+	}
+	return nil
+}
+
 // Prefixed shards the DictFile into the different word prefixes. The original
 // DictFile is unchanged, but the entries are still pointers to the originals
 // (i.e. the result will become out of date if you modify the entries).
@@ -66,13 +81,19 @@ func (df DictFile) WriteDictzip(dw *kobodict.Writer, ih ImageHandler, img ImageF
 // If a variamt has a different prefix, the entire entry is duplicated as
 // necessary.
 func (df DictFile) Prefixed() map[string]DictFile {
+	return df.PrefixedFunc(kobodict.PrefixV2)
+}
+
+// PrefixedFunc is like Prefixed, but uses a custom function to calculate the
+// prefixes (e.g. kobodict.PrefixV1 or kobodict.WordPrefixJapanese).
+func (df DictFile) PrefixedFunc(prefix kobodict.PrefixFunc) map[string]DictFile {
 	prefixed := map[string]DictFile{}
 	for _, dfe := range df {
 		pfx := map[string]bool{}
 
-		pfx[kobodict.WordPrefix(dfe.Headword)] = true
+		pfx[prefix(dfe.Headword)] = true
 		for _, v := range dfe.Variant {
-			pfx[kobodict.WordPrefix(v)] = true
+			pfx[prefix(v)] = true
 		}
 
 		for p := range pfx {
@@ -82,13 +103,38 @@ func (df DictFile) Prefixed() map[string]DictFile {
 	return prefixed
 }
 
+// KoboHTMLOptions contains options for generating the dicthtml. A nil or zero
+// value uses the defaults.
+type KoboHTMLOptions struct {
+	// Template is the template used to generate the HTML for each entry. It is
+	// executed with a DictFileEntry. If nil, DefaultEntryTemplate is used. It
+	// should be parsed with ParseEntryTemplate.
+	Template *template.Template
+
+	// Renderer is used to render Markdown definitions (the md template
+	// function). If nil, RendererBlackfriday is used.
+	Renderer Renderer
+}
+
 // WriteKoboHTML validates the DictFile and writes it to w in the dicthtml
-// format.
+// format. Cross-references are rendered, but not checked (see
+// CheckReferences).
 func (df DictFile) WriteKoboHTML(w io.Writer) error {
+	return df.WriteKoboHTMLOptions(w, nil)
+}
+
+// WriteKoboHTMLOptions is like WriteKoboHTML, but with options for generating
+// the dicthtml (which may be nil).
+func (df DictFile) WriteKoboHTMLOptions(w io.Writer, opt *KoboHTMLOptions) error {
 	if err := df.Validate(); err != nil {
 		return err
 	}
 
+	tmpl, check, err := opt.template()
+	if err != nil {
+		return err
+	}
+
 	// must be sorted for proper matching
 	dfs := df[:]
 	sort.Slice(dfs, func(i int, j int) bool {
@@ -98,8 +144,21 @@ func (df DictFile) WriteKoboHTML(w io.Writer) error {
 	if _, err := w.Write([]byte("<html>")); err != nil {
 		return err
 	}
+	buf := bytes.NewBuffer(nil)
 	for _, dfe := range dfs {
-		if err := dfe.writeKoboHTML(w); err != nil {
+		e := *dfe
+		e.Definition = renderReferences(e.Definition)
+
+		buf.Reset()
+		if err := tmpl.Execute(buf, e); err != nil {
+			return fmt.Errorf("word %#v: execute template: %w", dfe.Headword, err)
+		}
+		if check {
+			if err := checkKoboHTMLEntry(e, buf.String()); err != nil {
+				return fmt.Errorf("word %#v: invalid template output: %w", dfe.Headword, err)
+			}
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
 			return err
 		}
 	}
@@ -110,23 +169,37 @@ func (df DictFile) WriteKoboHTML(w io.Writer) error {
 	return nil
 }
 
-// note: we don't want the html/template escaping, this isn't actually proper
+// template returns the template to use for each entry, and whether the output
+// needs to be checked (i.e. it is a custom template).
+func (opt *KoboHTMLOptions) template() (*template.Template, bool, error) {
+	tmpl, check := koboHTMLTmpl, false
+	if opt != nil && opt.Template != nil {
+		tmpl, check = opt.Template, true
+	}
+	if opt != nil && opt.Renderer != nil {
+		if t, err := tmpl.Clone(); err != nil {
+			return nil, false, fmt.Errorf("clone template: %w", err)
+		} else {
+			tmpl = t.Funcs(template.FuncMap{"md": opt.Renderer.Render})
+		}
+	}
+	return tmpl, check, nil
+}
+
+// DefaultEntryTemplate is the default template used to generate the HTML for
+// each entry. It can be used as a starting point for custom templates.
+//
+// In addition to the built-in functions, templates can use md (renders
+// Markdown), normhw (normalizes a headword for the <a name="" />), and normv
+// (normalizes a variant for the <variant name=""/>).
+//
+// Note: we don't want the html/template escaping, this isn't actually proper
 // html, and also, the whitespaces in the end tags should stay EXACTLY as is
 // (yes, I know there is a space before the end of the a but not the variant) to
 // provide the best possible matches against the regexps Kobo uses. Also, the
 // output should not have any newlines. Also, keep in mind headwords can have
 // unescaped html tags in it, and they will be rendered properly by Kobo.
-var koboHTMLTmpl = template.Must(template.New("").Funcs(template.FuncMap{
-	"md": func(md string) string {
-		return strings.TrimSpace(string(blackfriday.Run([]byte(md))))
-	},
-	"normhw": func(headword string) string {
-		return kobodict.NormalizeWordReference(headword, false)
-	},
-	"normv": func(variant string) string {
-		return kobodict.NormalizeWordReference(variant, true)
-	},
-}).Parse(`
+const DefaultEntryTemplate = `
 {{- /* trim */ -}}
 
 <w>
@@ -153,8 +226,67 @@ var koboHTMLTmpl = template.Must(template.New("").Funcs(template.FuncMap{
 </w>
 
 {{- /* trim */ -}}
-`))
+`
+
+var koboHTMLTmpl = template.Must(ParseEntryTemplate(DefaultEntryTemplate))
+
+var koboHTMLTmplFuncs = template.FuncMap{
+	"md": new(RendererBlackfriday).Render,
+	"normhw": func(headword string) string {
+		return kobodict.NormalizeWordReference(headword, false)
+	},
+	"normv": func(variant string) string {
+		return kobodict.NormalizeWordReference(variant, true)
+	},
+}
+
+// ParseEntryTemplate parses a custom template for generating the HTML for each
+// entry (see DefaultEntryTemplate). To ensure it generates the structure
+// required by nickel (a single <w> containing the exact <a name="..." /> for
+// the headword and the <var> with the exact <variant name="..."/> for each
+// variant), it is executed with a few sample entries. The output for each
+// entry is also checked when generating the dicthtml.
+func ParseEntryTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("entry").Funcs(koboHTMLTmplFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	for _, dfe := range []DictFileEntry{
+		{Headword: "Test", Definition: "Test *definition*."},
+		{Headword: "test", Variant: []string{"Tests", "testing"}, HeaderInfo: "-noun", Attr: map[string][]string{"pos": {"noun"}}, Definition: "Test *definition*."},
+		{Headword: "test", NoHeader: true, RawHTML: true, Definition: "<p>Test</p>"},
+	} {
+		buf := bytes.NewBuffer(nil)
+		if err := tmpl.Execute(buf, dfe); err != nil {
+			return nil, fmt.Errorf("execute template for %#v: %w", dfe.Headword, err)
+		}
+		if err := checkKoboHTMLEntry(dfe, buf.String()); err != nil {
+			return nil, fmt.Errorf("check template output %#v: %w", buf.String(), err)
+		}
+	}
+	return tmpl, nil
+}
 
-func (d DictFileEntry) writeKoboHTML(w io.Writer) error {
-	return koboHTMLTmpl.Execute(w, d)
+// checkKoboHTMLEntry checks if the generated HTML for an entry has the
+// structure required by nickel.
+func checkKoboHTMLEntry(dfe DictFileEntry, html string) error {
+	if !strings.HasPrefix(html, "<w>") || !strings.HasSuffix(html, "</w>") {
+		return fmt.Errorf("must start with <w> and end with </w>")
+	}
+	if strings.Count(html, "<w>") != 1 || strings.Count(html, "</w>") != 1 {
+		return fmt.Errorf("must contain exactly one <w> and </w>")
+	}
+	if a := `<a name="` + kobodict.NormalizeWordReference(dfe.Headword, false) + `" />`; strings.Count(html, a) != 1 {
+		return fmt.Errorf("must contain exactly one %s for the headword", a)
+	}
+	var v strings.Builder
+	v.WriteString("<var>")
+	for _, x := range dfe.Variant {
+		v.WriteString(`<variant name="` + kobodict.NormalizeWordReference(x, true) + `"/>`)
+	}
+	v.WriteString("</var>")
+	if strings.Count(html, "<var>") != 1 || !strings.Contains(html, v.String()) {
+		return fmt.Errorf("must contain exactly one %s for the variants", v.String())
+	}
+	return nil
 }
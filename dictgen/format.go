@@ -0,0 +1,176 @@
+package dictgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// FormatDictFile reads a single dictfile and writes it to w in the canonical
+// format (i.e. the header and entries written by WriteDictFileHeader and
+// WriteDictFile). The name is only used for errors, and may be empty.
+//
+// Unlike ParseDictFile, comments and include directives are kept as-is, and
+// included files are not read. Comments between the lines before the
+// definition of an entry are moved before it, and the ones at the end of a
+// definition are moved after it. The Markdown in definitions is not changed
+// other than trimming leading and trailing blank lines.
+func FormatDictFile(w io.Writer, r io.Reader, name string) error {
+	s := newDictFileScannerRaw(r, name)
+
+	var df DictFile
+	for s.Scan() {
+		df = append(df, s.Entry())
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	// if there isn't a header, the leading comments belong to the first entry
+	hpre, post := s.hpre, s.pre
+	if s.h.IsZero() && len(hpre) != 0 {
+		if len(df) != 0 {
+			df[0].pre = append(hpre, df[0].pre...)
+		} else {
+			post = append(hpre, post...)
+		}
+		hpre = nil
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, line := range hpre {
+		bw.WriteString(line + "\n")
+	}
+	if err := s.h.WriteDictFileHeader(bw); err != nil {
+		return err
+	}
+	if err := df.WriteDictFile(bw); err != nil {
+		return err
+	}
+	for _, line := range post {
+		bw.WriteString(line + "\n")
+	}
+	return bw.Flush()
+}
+
+// LintDictFile checks a single dictfile for issues which aren't errors, but
+// may be mistakes. The warnings are returned as *DictFileError, sorted by
+// line. An error is returned if the dictfile can't be parsed or is invalid.
+// The name is only used for errors and warnings, and may be empty. Like
+// FormatDictFile, included files are not read.
+//
+// Currently, it warns about trailing whitespace (except for Markdown hard line
+// breaks), variants which are the same as the headword, and raw HTML
+// definitions which could be written in Markdown.
+func LintDictFile(r io.Reader, name string) ([]error, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var warns []*DictFileError
+	warnf := func(line int, format string, a ...interface{}) {
+		warns = append(warns, &DictFileError{name, line, fmt.Errorf(format, a...)})
+	}
+
+	for _, n := range lintTrailingWhitespace(buf) {
+		warnf(n, "trailing whitespace")
+	}
+
+	s := newDictFileScannerRaw(bytes.NewReader(buf), name)
+	for s.Scan() {
+		dfe := s.Entry()
+		if err := dfe.validate(0); err != nil {
+			return nil, &DictFileError{dfe.file, dfe.line, err}
+		}
+		hw := kobodict.NormalizeWordReference(dfe.Headword, true)
+		for _, v := range dfe.Variant {
+			if kobodict.NormalizeWordReference(v, true) == hw {
+				warnf(dfe.line, "word %#v: variant %#v is the same as the headword (variants are matched case-insensitively)", dfe.Headword, v)
+			}
+		}
+		if dfe.RawHTML && lintMarkdownable(dfe.Definition) {
+			warnf(dfe.line, "word %#v: raw HTML definition only uses tags which can be written in Markdown", dfe.Headword)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(warns, func(i, j int) bool {
+		return warns[i].Line < warns[j].Line
+	})
+
+	errs := make([]error, len(warns))
+	for i, w := range warns {
+		errs[i] = w
+	}
+	return errs, nil
+}
+
+// lintTrailingWhitespace returns the line numbers of lines with trailing
+// whitespace. Lines in Markdown definitions ending with exactly two spaces are
+// ignored, since that's a hard line break.
+func lintTrailingWhitespace(buf []byte) []int {
+	var (
+		lines   []int
+		entry   bool // in an entry
+		content bool // after the start of the definition
+		html    bool // the definition is raw HTML
+	)
+	for i, line := range bytes.Split(buf, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		switch {
+		case len(line) == 0 || bytes.HasPrefix(line, []byte("//")):
+		case line[0] == '@':
+			entry, content, html = true, false, false
+		case bytes.HasPrefix(line, []byte("#include")) && (len(line) == 8 || line[8] == ' ' || line[8] == '\t'):
+			entry, content = false, false
+		case !entry, !content && (line[0] == '&' || line[0] == ':' || line[0] == '%'):
+		case !content:
+			content, html = true, bytes.HasPrefix(bytes.TrimSpace(line), []byte("<html>"))
+		}
+		trimmed := bytes.TrimRight(line, " \t")
+		if len(trimmed) == len(line) {
+			continue
+		}
+		if entry && content && !html && len(trimmed) != 0 && len(line)-len(trimmed) == 2 && bytes.HasSuffix(line, []byte("  ")) {
+			continue // markdown hard line break
+		}
+		lines = append(lines, i+1)
+	}
+	return lines
+}
+
+var lintHTMLTagRe = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+var lintHTMLHrefRe = regexp.MustCompile(`^href="[^"]*"$`)
+
+// lintMarkdownable checks if the HTML only uses tags without attributes (other
+// than the href for links) which have a Markdown equivalent.
+func lintMarkdownable(html string) bool {
+	if strings.Contains(html, "<!--") {
+		return false
+	}
+	for _, m := range lintHTMLTagRe.FindAllStringSubmatch(html, -1) {
+		attr := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[3]), "/"))
+		switch strings.ToLower(m[2]) {
+		case "p", "br", "hr", "b", "strong", "i", "em", "code", "pre", "blockquote", "ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6":
+			if attr != "" {
+				return false
+			}
+		case "a":
+			if m[1] == "" && !lintHTMLHrefRe.MatchString(attr) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
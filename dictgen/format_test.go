@@ -0,0 +1,107 @@
+package dictgen
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormatDictFile(t *testing.T) {
+	for _, c := range []struct {
+		What string
+		In   string
+		Out  string
+	}{{
+		What: "canonical",
+		In:   "@ a\nA.\n\n@ b\n: info\n& bb\nB.\n\n",
+		Out:  "@ a\nA.\n\n@ b\n: info\n& bb\nB.\n\n",
+	}, {
+		What: "whitespace",
+		In:   "\n\n@   a  \n&bb\n\n\nA *markdown*  \n\n  - list\n\n\n\n@ b\n",
+		Out:  "@ a\n& bb\nA *markdown*  \n\n  - list\n\n@ b\n\n",
+	}, {
+		What: "header and comments",
+		In:   "// leading\nLocale: fr\ntitle: Test\n\n// section\n@ a\n& aa\n// moved\n: info\nA.\n// after\n\n// trailing\n",
+		Out:  "// leading\ntitle: Test\nlocale: fr\n\n// section\n// moved\n@ a\n: info\n& aa\nA.\n\n// after\n// trailing\n",
+	}, {
+		What: "leading comments without header",
+		In:   "// leading\n\n@ a\nA.\n",
+		Out:  "// leading\n@ a\nA.\n\n",
+	}, {
+		What: "includes",
+		In:   "@ a\nA.\n// before\n#include other/*.df\n\n@ b\nB.\n#include last.df\n",
+		Out:  "@ a\nA.\n\n// before\n#include other/*.df\n@ b\nB.\n\n#include last.df\n",
+	}, {
+		What: "escaping",
+		In:   "@ a\n :not header info\n %not an attribute\n",
+		Out:  "@ a\n :not header info\n %not an attribute\n\n",
+	}} {
+		buf := bytes.NewBuffer(nil)
+		if err := FormatDictFile(buf, strings.NewReader(c.In), "test.df"); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.What, err)
+			continue
+		} else if buf.String() != c.Out {
+			t.Errorf("%s: expected %q, got %q", c.What, c.Out, buf.String())
+			continue
+		}
+
+		res := bytes.NewBuffer(nil)
+		if err := FormatDictFile(res, bytes.NewReader(buf.Bytes()), "test.df"); err != nil {
+			t.Errorf("%s: reformat: unexpected error: %v", c.What, err)
+		} else if res.String() != buf.String() {
+			t.Errorf("%s: reformat: expected %q, got %q", c.What, buf.String(), res.String())
+		}
+	}
+
+	var dfe *DictFileError
+	if err := FormatDictFile(bytes.NewBuffer(nil), strings.NewReader("@ a\nA.\n@ b\n& \"\n"), "test.df"); !errors.As(err, &dfe) {
+		t.Errorf("expected DictFileError, got %v", err)
+	} else if dfe.File != "test.df" || dfe.Line != 3 {
+		t.Errorf("expected error on test.df:3, got %s:%d", dfe.File, dfe.Line)
+	}
+}
+
+func TestLintDictFile(t *testing.T) {
+	warns, err := LintDictFile(strings.NewReader("@ a \n& A\n& b\nA.\n@ b\n<html><p>B <b>bold</b></p>\n@ c\n<html><p class=\"x\">C</p>\n@ d\nD.\t\n"), "test.df")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var act []string
+	for _, w := range warns {
+		act = append(act, w.Error())
+	}
+	exp := []string{
+		`test.df:1: trailing whitespace`,
+		`test.df:1: word "a": variant "A" is the same as the headword (variants are matched case-insensitively)`,
+		`test.df:5: word "b": raw HTML definition only uses tags which can be written in Markdown`,
+		`test.df:10: trailing whitespace`,
+	}
+	if strings.Join(act, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("expected warnings:\n%s\ngot:\n%s", strings.Join(exp, "\n"), strings.Join(act, "\n"))
+	}
+
+	warns, err = LintDictFile(strings.NewReader("title: Test  \n\n@ a\n: info  \nLine 1  \nline 2   \nline 3\t\n@ b\n<html><p class=\"x\">B</p>  \n"), "test.df")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	act = nil
+	for _, w := range warns {
+		act = append(act, w.Error())
+	}
+	exp = []string{
+		`test.df:1: trailing whitespace`,
+		`test.df:4: trailing whitespace`,
+		`test.df:6: trailing whitespace`,
+		`test.df:7: trailing whitespace`,
+		`test.df:9: trailing whitespace`,
+	}
+	if strings.Join(act, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("expected warnings:\n%s\ngot:\n%s", strings.Join(exp, "\n"), strings.Join(act, "\n"))
+	}
+
+	if _, err := LintDictFile(strings.NewReader("@ a\n::\n::\n"), "test.df"); err == nil {
+		t.Errorf("expected error")
+	}
+}
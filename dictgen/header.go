@@ -0,0 +1,107 @@
+package dictgen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DictFileHeader contains dictionary-level metadata, which is specified as
+// "key: value" lines before the first entry of a dictfile. All fields are
+// optional, and are stored as-is; it is up to the user (e.g. dictgen) to
+// interpret them.
+type DictFileHeader struct {
+	Title       string // title: the name of the dictionary
+	Locale      string // locale: the locale code of the dictionary (e.g. en, fr, ja, en-fr)
+	Author      string // author: the author of the dictionary
+	License     string // license: the license of the dictionary
+	Version     string // version: the version of the dictionary
+	ImageMethod string // image-method: the default image method (base64, embed, remove)
+	Crypt       string // crypt: the default encryption (method:keyhex)
+	Firmware    string // firmware: the minimum firmware version targeted (e.g. 4.20.14601)
+}
+
+type dictFileHeaderField struct {
+	Key   string
+	Value *string
+}
+
+func (h *DictFileHeader) fields() []dictFileHeaderField {
+	return []dictFileHeaderField{
+		{"title", &h.Title},
+		{"locale", &h.Locale},
+		{"author", &h.Author},
+		{"license", &h.License},
+		{"version", &h.Version},
+		{"image-method", &h.ImageMethod},
+		{"crypt", &h.Crypt},
+		{"firmware", &h.Firmware},
+	}
+}
+
+// parseLine parses a single "key: value" header line.
+func (h *DictFileHeader) parseLine(line string) error {
+	spl := strings.SplitN(line, ":", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid line %#v: expected key: value", line)
+	}
+	key, value := strings.ToLower(strings.TrimSpace(spl[0])), strings.TrimSpace(spl[1])
+	for _, f := range h.fields() {
+		if f.Key == key {
+			if len(value) == 0 {
+				return fmt.Errorf("empty value for %#v", key)
+			}
+			if len(*f.Value) != 0 {
+				return fmt.Errorf("duplicate key %#v", key)
+			}
+			*f.Value = value
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %#v", key)
+}
+
+// IsZero checks if no fields are set in the header.
+func (h *DictFileHeader) IsZero() bool {
+	return h == nil || *h == DictFileHeader{}
+}
+
+// Merge copies the fields set in o which aren't set in h. If a field is set
+// in both, it must have the same value.
+func (h *DictFileHeader) Merge(o *DictFileHeader) error {
+	if o == nil {
+		return nil
+	}
+	of := o.fields()
+	for i, f := range h.fields() {
+		switch v := *of[i].Value; {
+		case len(v) == 0:
+		case len(*f.Value) == 0:
+			*f.Value = v
+		case *f.Value != v:
+			return fmt.Errorf("conflicting values for %#v: %#v and %#v", f.Key, *f.Value, v)
+		}
+	}
+	return nil
+}
+
+// WriteDictFileHeader writes the header in the dictfile format, followed by a
+// blank line. Nothing is written if the header is empty. It should be written
+// before the DictFile.
+func (h *DictFileHeader) WriteDictFileHeader(w io.Writer) error {
+	if h.IsZero() {
+		return nil
+	}
+	for _, f := range h.fields() {
+		if len(*f.Value) != 0 {
+			if strings.ContainsAny(*f.Value, "\r\n") {
+				return fmt.Errorf("header %#v must not contain newlines", f.Key)
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s\n", f.Key, *f.Value); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
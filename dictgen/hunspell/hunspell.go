@@ -0,0 +1,453 @@
+// Package hunspell implements a minimal reader for Hunspell affix (.aff) and
+// dictionary (.dic) files, for generating the inflected forms of words.
+//
+// Only the parts of the format needed for generating forms are implemented:
+// SET, FLAG, PFX, SFX (including one level of continuation classes),
+// FORBIDDENWORD, ONLYINCOMPOUND, NEEDAFFIX, and the st: (stem) morphological
+// field in dictionary entries. Compounding and suggestions are not supported.
+package hunspell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Dictionary is a parsed Hunspell dictionary.
+type Dictionary struct {
+	flagMode string
+	forbid   string
+	compound string
+	needAff  string
+	pfx      map[string]*affixClass
+	sfx      map[string]*affixClass
+	order    []string // affix class flags in the order they were defined
+	words    map[string][]*word
+	stems    map[string][]string // stem -> words which declared it with st:
+}
+
+type word struct {
+	word  string
+	flags []string
+}
+
+type affixClass struct {
+	flag   string
+	suffix bool
+	cross  bool
+	rules  []*affixRule
+}
+
+type affixRule struct {
+	strip string
+	add   string
+	cont  []string
+	cond  []condChar
+}
+
+type condChar struct {
+	chars  string
+	negate bool
+	any    bool
+}
+
+// Open reads a Hunspell dictionary from the specified .aff and .dic files.
+func Open(aff, dic string) (*Dictionary, error) {
+	af, err := os.Open(aff)
+	if err != nil {
+		return nil, fmt.Errorf("open affix file: %w", err)
+	}
+	defer af.Close()
+
+	df, err := os.Open(dic)
+	if err != nil {
+		return nil, fmt.Errorf("open dictionary file: %w", err)
+	}
+	defer df.Close()
+
+	return Parse(af, df)
+}
+
+// Parse reads a Hunspell dictionary from the contents of the .aff and .dic
+// files. The character encoding is taken from the SET directive in the affix
+// file (UTF-8 and ISO8859-* are supported).
+func Parse(aff, dic io.Reader) (*Dictionary, error) {
+	abuf, err := ioutil.ReadAll(aff)
+	if err != nil {
+		return nil, fmt.Errorf("read affix file: %w", err)
+	}
+
+	enc, err := detectEncoding(abuf)
+	if err != nil {
+		return nil, fmt.Errorf("read affix file: %w", err)
+	}
+	if enc != nil {
+		if abuf, err = enc.NewDecoder().Bytes(abuf); err != nil {
+			return nil, fmt.Errorf("read affix file: decode: %w", err)
+		}
+		dic = enc.NewDecoder().Reader(dic)
+	}
+
+	d := &Dictionary{
+		pfx:   map[string]*affixClass{},
+		sfx:   map[string]*affixClass{},
+		words: map[string][]*word{},
+		stems: map[string][]string{},
+	}
+
+	if err := d.parseAffix(abuf); err != nil {
+		return nil, fmt.Errorf("parse affix file: %w", err)
+	}
+	if err := d.parseDic(dic); err != nil {
+		return nil, fmt.Errorf("parse dictionary file: %w", err)
+	}
+	return d, nil
+}
+
+func detectEncoding(aff []byte) (encoding.Encoding, error) {
+	sc := bufio.NewScanner(bytes.NewReader(aff))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 || f[0] != "SET" {
+			continue
+		}
+		switch set := strings.ToUpper(f[1]); {
+		case set == "UTF-8":
+			return nil, nil
+		case strings.HasPrefix(set, "ISO8859-"):
+			n, err := strconv.Atoi(strings.TrimPrefix(set, "ISO8859-"))
+			if err != nil {
+				return nil, fmt.Errorf("unsupported encoding %#v", f[1])
+			}
+			for _, cm := range charmap.All {
+				if c, ok := cm.(*charmap.Charmap); ok && c.String() == fmt.Sprintf("ISO 8859-%d", n) {
+					return c, nil
+				}
+			}
+			return nil, fmt.Errorf("unsupported encoding %#v", f[1])
+		case set == "KOI8-R":
+			return charmap.KOI8R, nil
+		case set == "KOI8-U":
+			return charmap.KOI8U, nil
+		default:
+			return nil, fmt.Errorf("unsupported encoding %#v", f[1])
+		}
+	}
+	return nil, nil // hunspell defaults to ISO8859-1, but UTF-8 is much more common for files without a SET
+}
+
+func (d *Dictionary) parseAffix(buf []byte) error {
+	var line int
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line++
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		switch f[0] {
+		case "FLAG":
+			if len(f) < 2 {
+				return fmt.Errorf("line %d: missing flag type", line)
+			}
+			switch f[1] {
+			case "long", "num", "UTF-8":
+				d.flagMode = f[1]
+			default:
+				return fmt.Errorf("line %d: unknown flag type %#v", line, f[1])
+			}
+		case "FORBIDDENWORD", "ONLYINCOMPOUND", "NEEDAFFIX":
+			if len(f) < 2 {
+				return fmt.Errorf("line %d: missing flag for %s", line, f[0])
+			}
+			switch f[0] {
+			case "FORBIDDENWORD":
+				d.forbid = f[1]
+			case "ONLYINCOMPOUND":
+				d.compound = f[1]
+			case "NEEDAFFIX":
+				d.needAff = f[1]
+			}
+		case "PFX", "SFX":
+			if len(f) < 4 {
+				return fmt.Errorf("line %d: invalid %s line", line, f[0])
+			}
+			cls, ok := d.affixClasses(f[0] == "SFX")[f[1]]
+			if !ok {
+				// header: PFX flag cross_product count
+				cls = &affixClass{
+					flag:   f[1],
+					suffix: f[0] == "SFX",
+					cross:  f[2] == "Y",
+				}
+				d.affixClasses(cls.suffix)[f[1]] = cls
+				d.order = append(d.order, f[0]+f[1])
+				continue
+			}
+			// rule: PFX flag strip add[/flags] [condition [morph...]]
+			r := &affixRule{
+				strip: f[2],
+				add:   f[3],
+			}
+			if r.strip == "0" {
+				r.strip = ""
+			}
+			if i := strings.Index(r.add, "/"); i != -1 {
+				r.cont = d.parseFlags(r.add[i+1:])
+				r.add = r.add[:i]
+			}
+			if r.add == "0" {
+				r.add = ""
+			}
+			cond := "."
+			if len(f) >= 5 {
+				cond = f[4]
+			}
+			c, err := parseCondition(cond)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			r.cond = c
+			cls.rules = append(cls.rules, r)
+		}
+	}
+	return sc.Err()
+}
+
+func (d *Dictionary) affixClasses(suffix bool) map[string]*affixClass {
+	if suffix {
+		return d.sfx
+	}
+	return d.pfx
+}
+
+func (d *Dictionary) parseDic(r io.Reader) error {
+	var line int
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line++
+		s := strings.TrimSpace(sc.Text())
+		if line == 1 {
+			if _, err := strconv.Atoi(s); err == nil {
+				continue // approximate word count
+			}
+		}
+		if s == "" || strings.HasPrefix(s, "#") || strings.HasPrefix(s, "/") {
+			continue
+		}
+
+		// word[/flags][\tmorph...]
+		var morph []string
+		if i := strings.IndexAny(s, " \t"); i != -1 {
+			morph = strings.Fields(s[i:])
+			s = s[:i]
+		}
+
+		w := &word{word: s}
+		if i := strings.LastIndex(s, "/"); i > 0 && s[i-1] != '\\' {
+			w.word, w.flags = s[:i], d.parseFlags(s[i+1:])
+		}
+		w.word = strings.ReplaceAll(w.word, "\\/", "/")
+
+		d.words[w.word] = append(d.words[w.word], w)
+		for _, m := range morph {
+			if st := strings.TrimPrefix(m, "st:"); st != m && st != w.word {
+				d.stems[st] = append(d.stems[st], w.word)
+			}
+		}
+	}
+	return sc.Err()
+}
+
+func (d *Dictionary) parseFlags(s string) []string {
+	var flags []string
+	switch d.flagMode {
+	case "long":
+		for len(s) >= 2 {
+			flags = append(flags, s[:2])
+			s = s[2:]
+		}
+	case "num":
+		for _, f := range strings.Split(s, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				flags = append(flags, f)
+			}
+		}
+	default:
+		for len(s) != 0 {
+			_, n := utf8.DecodeRuneInString(s)
+			flags = append(flags, s[:n])
+			s = s[n:]
+		}
+	}
+	return flags
+}
+
+func parseCondition(s string) ([]condChar, error) {
+	var cond []condChar
+	for r := []rune(s); len(r) != 0; {
+		switch r[0] {
+		case '.':
+			cond = append(cond, condChar{any: true})
+			r = r[1:]
+		case '[':
+			end := -1
+			for i, c := range r {
+				if c == ']' {
+					end = i
+					break
+				}
+			}
+			if end == -1 {
+				return nil, fmt.Errorf("invalid condition %#v: unterminated character class", s)
+			}
+			cc := condChar{chars: string(r[1:end])}
+			if strings.HasPrefix(cc.chars, "^") {
+				cc.negate, cc.chars = true, cc.chars[1:]
+			}
+			cond = append(cond, cc)
+			r = r[end+1:]
+		default:
+			cond = append(cond, condChar{chars: string(r[0])})
+			r = r[1:]
+		}
+	}
+	return cond, nil
+}
+
+func (c condChar) match(r rune) bool {
+	if c.any {
+		return true
+	}
+	return strings.ContainsRune(c.chars, r) != c.negate
+}
+
+// apply applies the rule to w, returning false if the condition doesn't match.
+func (r *affixRule) apply(w string, suffix bool) (string, bool) {
+	rw := []rune(w)
+	if len(rw) < len(r.cond) {
+		return "", false
+	}
+	if suffix {
+		if !strings.HasSuffix(w, r.strip) || len(r.strip) == len(w) {
+			return "", false
+		}
+		for i, c := range r.cond {
+			if !c.match(rw[len(rw)-len(r.cond)+i]) {
+				return "", false
+			}
+		}
+		return w[:len(w)-len(r.strip)] + r.add, true
+	}
+	if !strings.HasPrefix(w, r.strip) || len(r.strip) == len(w) {
+		return "", false
+	}
+	for i, c := range r.cond {
+		if !c.match(rw[i]) {
+			return "", false
+		}
+	}
+	return r.add + w[len(r.strip):], true
+}
+
+func hasFlag(flags []string, flag string) bool {
+	if flag == "" {
+		return false
+	}
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Forms returns the inflected forms of a word (not including the word
+// itself), in the order the affixes were defined in. If the word isn't in the
+// dictionary as-is, the lowercase version is used. Words which declare the
+// word as their stem (with the st: morphological field) are also included.
+func (d *Dictionary) Forms(w string) []string {
+	ws, ok := d.words[w]
+	if !ok {
+		ws = d.words[strings.ToLower(w)]
+	}
+
+	var forms []string
+	seen := map[string]bool{w: true}
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			forms = append(forms, f)
+		}
+	}
+
+	for _, e := range ws {
+		if hasFlag(e.flags, d.forbid) || hasFlag(e.flags, d.compound) {
+			continue
+		}
+		for _, k := range d.order {
+			if !hasFlag(e.flags, k[3:]) {
+				continue
+			}
+			cls := d.affixClasses(k[:3] == "SFX")[k[3:]]
+			for _, r := range cls.rules {
+				f, ok := r.apply(e.word, cls.suffix)
+				if !ok {
+					continue
+				}
+				if !hasFlag(r.cont, d.needAff) && !hasFlag(r.cont, d.compound) {
+					add(f)
+				}
+
+				// continuation classes (e.g. twofold suffixes)
+				for _, cf := range r.cont {
+					if ccls, ok := d.affixClasses(cls.suffix)[cf]; ok {
+						for _, cr := range ccls.rules {
+							if cf, ok := cr.apply(f, ccls.suffix); ok {
+								add(cf)
+							}
+						}
+					}
+				}
+
+				// cross products of prefixes and suffixes
+				if cls.suffix && cls.cross {
+					for _, pk := range d.order {
+						if pk[:3] != "PFX" || !hasFlag(e.flags, pk[3:]) {
+							continue
+						}
+						if pcls := d.pfx[pk[3:]]; pcls.cross {
+							for _, pr := range pcls.rules {
+								if pf, ok := pr.apply(f, false); ok {
+									add(pf)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, sw := range d.stems[w] {
+		add(sw)
+	}
+	if lw := strings.ToLower(w); lw != w {
+		for _, sw := range d.stems[lw] {
+			add(sw)
+		}
+	}
+
+	return forms
+}
@@ -0,0 +1,89 @@
+package hunspell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testAff = `SET UTF-8
+# comment
+FLAG UTF-8
+FORBIDDENWORD !
+
+PFX U Y 1
+PFX U   0     un         .
+
+SFX D Y 4
+SFX D   0     d          e
+SFX D   y     ied        [^aeiou]y
+SFX D   0     ed         [^ey]
+SFX D   0     ed         [aeiou]y
+
+SFX S Y 4
+SFX S   y     ies        [^aeiou]y
+SFX S   0     s          [aeiou]y
+SFX S   0     es         [sxzh]
+SFX S   0     s          [^sxzhy]
+
+SFX Ü Y 1
+SFX Ü   utter ütter/S    utter
+`
+
+const testDic = `7
+try/DS
+test/DSU
+bake/D
+go
+went	st:go
+mouse
+mice st:mouse
+Mutter/Ü
+bad/!S
+`
+
+func TestForms(t *testing.T) {
+	d, err := Parse(strings.NewReader(testAff), strings.NewReader(testDic))
+	if err != nil {
+		t.Fatalf("parse: unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		w string
+		f []string
+	}{
+		{"try", []string{"tried", "tries"}},
+		{"test", []string{"untest", "tested", "untested", "tests", "untests"}},
+		{"bake", []string{"baked"}},
+		{"go", []string{"went"}},
+		{"mouse", []string{"mice"}},
+		{"Mutter", []string{"Mütter", "Mütters"}},
+		{"bad", nil},
+		{"Try", []string{"tried", "tries"}},
+		{"nonexistent", nil},
+	} {
+		t.Logf("word %#v", tc.w)
+		if f := d.Forms(tc.w); !reflect.DeepEqual(f, tc.f) {
+			t.Errorf("    expected %#v, got %#v", tc.f, f)
+		}
+	}
+}
+
+func TestParseLongFlags(t *testing.T) {
+	d, err := Parse(strings.NewReader("FLAG long\nSFX Aa Y 1\nSFX Aa 0 s .\n"), strings.NewReader("1\ncat/AaBb\n"))
+	if err != nil {
+		t.Fatalf("parse: unexpected error: %v", err)
+	}
+	if f := d.Forms("cat"); !reflect.DeepEqual(f, []string{"cats"}) {
+		t.Errorf("expected %#v, got %#v", []string{"cats"}, f)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	d, err := Parse(strings.NewReader("SET ISO8859-1\nSFX A Y 1\nSFX A 0 \xe9 .\n"), strings.NewReader("1\ncaf/A\n"))
+	if err != nil {
+		t.Fatalf("parse: unexpected error: %v", err)
+	}
+	if f := d.Forms("caf"); !reflect.DeepEqual(f, []string{"café"}) {
+		t.Errorf("expected %#v, got %#v", []string{"café"}, f)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -172,6 +173,23 @@ func (ih *ImageHandlerBase64) Description() string {
 
 var imgTagRe = regexp.MustCompile(`(<img)(\s+(?:[^>]*\s+)?src\s*=\s*['"]+)([^'"]+)(['"][^>]*>)`)
 
+// TransformImages transforms the img tags in the definition of an entry (which
+// should be raw HTML) using an ImageHandler, in the same way as WriteDictzip.
+// It is intended for importers where the images are stored in the source
+// dictionary (the ImageFunc can read them from it). Since there isn't a
+// dictzip to add them to, ImageHandlerEmbed is not supported.
+func (d *DictFileEntry) TransformImages(ih ImageHandler, img ImageFunc) error {
+	if _, ok := ih.(*ImageHandlerEmbed); ok {
+		return errors.New("cannot embed images without a dictzip")
+	}
+	buf, err := transformHTMLImages(ih, nil, []byte(d.Definition), img)
+	if err != nil {
+		return err
+	}
+	d.Definition = string(buf)
+	return nil
+}
+
 // transformHTMLImages transforms img tags in the specified HTML, using
 // openImage to read the specified paths. If openImage implements io.Closer,
 // it will be closed automatically. Img tags which reference have a data URL are
@@ -0,0 +1,429 @@
+// Package bgl reads Babylon BGL dictionaries and converts them into dictfiles.
+//
+// A BGL file consists of a short header followed by a gzip stream containing a
+// sequence of blocks with the metadata, entries, and embedded resources (e.g.
+// images). Text is stored in the charsets specified in the metadata (unless
+// the dictionary is marked as UTF-8), and definitions may contain additional
+// binary fields (e.g. the part of speech and the transcription) after the
+// HTML.
+package bgl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Dictionary is a parsed BGL dictionary.
+type Dictionary struct {
+	Title       string
+	Author      string
+	Email       string
+	Copyright   string
+	Description string
+
+	SourceLanguage string // ISO 639-1 code, or empty if unknown
+	TargetLanguage string // ISO 639-1 code, or empty if unknown
+
+	Entries   []*Entry
+	Resources map[string][]byte // embedded files (e.g. images) by name
+}
+
+// Entry is a single entry in the dictionary. The text is decoded to UTF-8, but
+// is otherwise as stored in the BGL.
+type Entry struct {
+	Headword      string
+	Alternates    []string
+	Definition    string // HTML
+	PartOfSpeech  string // e.g. noun, or empty if not specified
+	Transcription string
+}
+
+// Open parses a BGL file.
+func Open(name string) (*Dictionary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(bufio.NewReader(f))
+}
+
+// Parse parses a BGL file.
+func Parse(r io.Reader) (*Dictionary, error) {
+	hdr := make([]byte, 6)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if sig := binary.BigEndian.Uint32(hdr); sig != 0x12340001 && sig != 0x12340002 {
+		return nil, fmt.Errorf("read header: invalid signature %08X", sig)
+	}
+	off := int64(binary.BigEndian.Uint16(hdr[4:]))
+	if off < 6 {
+		return nil, fmt.Errorf("read header: invalid gzip offset %d", off)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, off-6); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	zr.Multistream(false)
+
+	// some files have a truncated or corrupted gzip stream at the end, so use
+	// as much as possible
+	buf, err := ioutil.ReadAll(zr)
+	if err != nil && len(buf) == 0 {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+
+	p := &parser{
+		d:   &Dictionary{Resources: map[string][]byte{}},
+		buf: buf,
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.d, nil
+}
+
+type parser struct {
+	d   *Dictionary
+	buf []byte
+
+	utf8           bool
+	defaultCharset encoding.Encoding
+	sourceCharset  encoding.Encoding
+	targetCharset  encoding.Encoding
+	entries        []rawEntry
+}
+
+// rawEntry is an entry before the text is decoded (since the charset may be
+// specified after it).
+type rawEntry struct {
+	word []byte
+	alts [][]byte
+	defi []byte
+}
+
+func (p *parser) parse() error {
+	for len(p.buf) != 0 {
+		typ, data, err := p.block()
+		if err != nil {
+			return fmt.Errorf("read block: %w", err)
+		}
+		switch typ {
+		case 0:
+			if len(data) >= 2 && data[0] == 8 {
+				p.defaultCharset = charsets[data[1]]
+			}
+		case 1, 7, 10, 13:
+			if err := p.entry(data); err != nil {
+				return fmt.Errorf("read entry: %w", err)
+			}
+		case 11:
+			if err := p.entry11(data); err != nil {
+				return fmt.Errorf("read entry: %w", err)
+			}
+		case 2:
+			if len(data) == 0 || len(data) < 1+int(data[0]) {
+				return errors.New("read resource: unexpected end of block")
+			}
+			p.d.Resources[string(data[1:1+data[0]])] = data[1+data[0]:]
+		case 3:
+			if len(data) >= 2 {
+				p.info(binary.BigEndian.Uint16(data), data[2:])
+			}
+		case 4:
+			p.buf = nil // end
+		}
+	}
+
+	for _, e := range p.entries {
+		x := &Entry{Headword: p.decode(e.word, p.sourceCharset)}
+		for _, a := range e.alts {
+			x.Alternates = append(x.Alternates, p.decode(a, p.sourceCharset))
+		}
+		defi, pos, trans := splitDefinition(e.defi)
+		x.Definition = p.decode(defi, p.targetCharset)
+		x.PartOfSpeech = partsOfSpeech[pos]
+		x.Transcription = p.decode(trans, p.targetCharset)
+		p.d.Entries = append(p.d.Entries, x)
+	}
+
+	p.d.Title = p.decode([]byte(p.d.Title), p.sourceCharset)
+	p.d.Author = p.decode([]byte(p.d.Author), p.sourceCharset)
+	p.d.Email = p.decode([]byte(p.d.Email), p.sourceCharset)
+	p.d.Copyright = p.decode([]byte(p.d.Copyright), p.sourceCharset)
+	p.d.Description = p.decode([]byte(p.d.Description), p.sourceCharset)
+	return nil
+}
+
+// block reads a block. The high nibble of the first byte is the size of the
+// length (minus one) if less than 4, or the length itself (plus 4), and the
+// low nibble is the type.
+func (p *parser) block() (typ byte, data []byte, err error) {
+	typ, n := p.buf[0]&0xF, int(p.buf[0]>>4)
+	p.buf = p.buf[1:]
+	if n < 4 {
+		if len(p.buf) < n+1 {
+			return 0, nil, errors.New("unexpected end of data")
+		}
+		n, p.buf = int(uintBE(p.buf[:n+1])), p.buf[n+1:]
+	} else {
+		n -= 4
+	}
+	if len(p.buf) < n {
+		return 0, nil, errors.New("unexpected end of data")
+	}
+	data, p.buf = p.buf[:n], p.buf[n:]
+	return typ, data, nil
+}
+
+// entry reads an entry block (types 1, 7, 10, and 13), which consists of the
+// word (with a 1-byte length), the definition (with a 2-byte length), and the
+// alternates (each with a 1-byte length).
+func (p *parser) entry(data []byte) error {
+	var e rawEntry
+	var ok bool
+	if e.word, data, ok = field(data, 1); !ok {
+		return errors.New("unexpected end of block (word)")
+	}
+	if e.defi, data, ok = field(data, 2); !ok {
+		return fmt.Errorf("word %q: unexpected end of block (definition)", e.word)
+	}
+	for len(data) != 0 {
+		var alt []byte
+		if alt, data, ok = field(data, 1); !ok {
+			return fmt.Errorf("word %q: unexpected end of block (alternate)", e.word)
+		}
+		e.alts = append(e.alts, alt)
+	}
+	p.entries = append(p.entries, e)
+	return nil
+}
+
+// entry11 reads an entry block in the newer format (type 11), which consists
+// of the word (with a 5-byte length), the number of alternates (4 bytes), the
+// alternates (each with a 4-byte length), and the definition (with a 4-byte
+// length).
+func (p *parser) entry11(data []byte) error {
+	var e rawEntry
+	var ok bool
+	if e.word, data, ok = field(data, 5); !ok {
+		return errors.New("unexpected end of block (word)")
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("word %q: unexpected end of block (alternates)", e.word)
+	}
+	n := uintBE(data[:4])
+	data = data[4:]
+	for i := uint64(0); i < n; i++ {
+		var alt []byte
+		if alt, data, ok = field(data, 4); !ok {
+			return fmt.Errorf("word %q: unexpected end of block (alternate)", e.word)
+		}
+		e.alts = append(e.alts, alt)
+	}
+	if e.defi, _, ok = field(data, 4); !ok {
+		return fmt.Errorf("word %q: unexpected end of block (definition)", e.word)
+	}
+	p.entries = append(p.entries, e)
+	return nil
+}
+
+// info reads a metadata block.
+func (p *parser) info(code uint16, v []byte) {
+	switch code {
+	case 0x01:
+		p.d.Title = string(v)
+	case 0x02:
+		p.d.Author = string(v)
+	case 0x03:
+		p.d.Email = string(v)
+	case 0x04:
+		p.d.Copyright = string(v)
+	case 0x07:
+		p.d.SourceLanguage = language(v)
+	case 0x08:
+		p.d.TargetLanguage = language(v)
+	case 0x09:
+		p.d.Description = string(v)
+	case 0x11:
+		p.utf8 = len(v) != 0 && uintBE(v)&0x8000 != 0
+	case 0x1A:
+		if len(v) != 0 {
+			p.sourceCharset = charsets[v[0]]
+		}
+	case 0x1B:
+		if len(v) != 0 {
+			p.targetCharset = charsets[v[0]]
+		}
+	}
+}
+
+// decode decodes text using the specified charset, falling back to the
+// default one. If the dictionary uses UTF-8 or the text is valid UTF-8, it is
+// returned as-is.
+func (p *parser) decode(b []byte, cs encoding.Encoding) string {
+	if p.utf8 || utf8.Valid(b) {
+		return string(b)
+	}
+	if cs == nil {
+		if cs = p.defaultCharset; cs == nil {
+			cs = charmap.Windows1252
+		}
+	}
+	if s, err := cs.NewDecoder().Bytes(b); err == nil {
+		return string(s)
+	}
+	return string(bytes.ToValidUTF8(b, []byte("�")))
+}
+
+// splitDefinition splits the HTML of the definition from the fields after it
+// (which are each prefixed by 0x14), returning the part of speech code and
+// transcription if present. Unknown fields are ignored.
+func splitDefinition(b []byte) (defi []byte, pos byte, trans []byte) {
+	i := bytes.IndexByte(b, 0x14)
+	if i == -1 {
+		return b, 0, nil
+	}
+	defi, b = b[:i], b[i+1:]
+
+	// skip skips n bytes, returning false if there aren't enough
+	skip := func(n int) bool {
+		if len(b) < n {
+			b = nil
+			return false
+		}
+		b = b[n:]
+		return true
+	}
+	for len(b) != 0 {
+		switch b[0] {
+		case 0x14:
+			skip(1)
+		case 0x02: // part of speech
+			if len(b) >= 2 {
+				pos = b[1]
+			}
+			skip(2)
+		case 0x06:
+			skip(2)
+		case 0x07:
+			skip(3)
+		case 0x18, 0x1A: // title
+			if len(b) >= 2 {
+				skip(2 + int(b[1]))
+			} else {
+				b = nil
+			}
+		case 0x28:
+			if len(b) >= 3 {
+				skip(3 + int(binary.BigEndian.Uint16(b[1:])))
+			} else {
+				b = nil
+			}
+		case 0x50: // transcription (code, 1-byte length)
+			if len(b) >= 3 && len(b) >= 3+int(b[2]) {
+				trans = b[3 : 3+b[2]]
+				skip(3 + int(b[2]))
+			} else {
+				b = nil
+			}
+		case 0x60: // transcription (code, 2-byte length)
+			if n := 0; len(b) >= 4 {
+				if n = int(binary.BigEndian.Uint16(b[2:])); len(b) >= 4+n {
+					trans = b[4 : 4+n]
+				}
+				skip(4 + n)
+			} else {
+				b = nil
+			}
+		default:
+			b = nil
+		}
+	}
+	return defi, pos, trans
+}
+
+// field reads a field prefixed by an n-byte length.
+func field(b []byte, n int) (v, rest []byte, ok bool) {
+	if len(b) < n {
+		return nil, nil, false
+	}
+	l := uintBE(b[:n])
+	if uint64(len(b)-n) < l {
+		return nil, nil, false
+	}
+	return b[n : n+int(l)], b[n+int(l):], true
+}
+
+func uintBE(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// charsets maps the charset codes to the encodings.
+var charsets = map[byte]encoding.Encoding{
+	0x41: charmap.Windows1252, // default
+	0x42: charmap.Windows1252, // latin
+	0x43: charmap.Windows1250, // eastern european
+	0x44: charmap.Windows1251, // cyrillic
+	0x45: japanese.ShiftJIS,
+	0x46: traditionalchinese.Big5,
+	0x47: simplifiedchinese.GBK,
+	0x48: charmap.Windows1257, // baltic
+	0x49: charmap.Windows1253, // greek
+	0x4A: korean.EUCKR,
+	0x4B: charmap.Windows1254, // turkish
+	0x4C: charmap.Windows1255, // hebrew
+	0x4D: charmap.Windows1256, // arabic
+	0x4E: charmap.Windows874,  // thai
+}
+
+// partsOfSpeech maps the part of speech codes to the names.
+var partsOfSpeech = map[byte]string{
+	0x30: "noun",
+	0x31: "adjective",
+	0x32: "verb",
+	0x33: "adverb",
+	0x34: "interjection",
+	0x35: "pronoun",
+	0x36: "preposition",
+	0x37: "conjunction",
+	0x38: "suffix",
+	0x39: "prefix",
+	0x3A: "article",
+}
+
+// languages maps the language codes to ISO 639-1 codes. Only the first ones
+// are included, since the rest are mostly regional variants of other
+// languages or rarely used.
+var languages = []string{"en", "fr", "it", "es", "nl", "pt", "de", "ru", "ja", "zh", "zh", "el", "ko", "tr", "he", "ar", "th"}
+
+func language(v []byte) string {
+	if n := uintBE(v); n < uint64(len(languages)) {
+		return languages[n]
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package bgl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+func TestParse(t *testing.T) {
+	var blocks bytes.Buffer
+	block := func(typ byte, data ...[]byte) {
+		b := bytes.Join(data, nil)
+		if len(b) < 12 {
+			blocks.WriteByte(byte(len(b)+4)<<4 | typ)
+		} else {
+			blocks.WriteByte(1<<4 | typ)
+			binary.Write(&blocks, binary.BigEndian, uint16(len(b)))
+		}
+		blocks.Write(b)
+	}
+	u16 := func(v int) []byte { return []byte{byte(v >> 8), byte(v)} }
+	u32 := func(v int) []byte { return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+	str := func(n int, s string) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(len(s) >> (8 * (n - 1 - i)))
+		}
+		return append(b, s...)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+
+	block(0, []byte{8, 0x44})
+	block(3, u16(0x01), []byte("Test <b>Dict</b>"))
+	block(3, u16(0x02), []byte("Someone"))
+	block(3, u16(0x07), u32(0))
+	block(3, u16(0x08), u32(7))
+	block(2, str(1, "A.PNG"), img.Bytes())
+	block(1, str(1, "cat$1$"), str(2, "A small\nanimal & <charset c=T>0041;0042;</charset>.\x14\x02\x30\x50\x00\x04k\xc3\xa6t"), str(1, "cats"), str(1, "cat"), str(1, "<b>kitty</b>"), str(1, "cat$2$"))
+	block(1, str(1, "\xea\xee\xf2"), str(2, "\xea\xee\xf8\xea\xe0 <IMG SRC=a.png>"))
+	block(11, str(5, "dog"), u32(1), str(4, "dogs"), str(4, "<b>an animal</b>"))
+	block(1, str(1, "$2$"), str(2, "blank"))
+	block(4)
+
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	zw.Write(blocks.Bytes())
+	zw.Close()
+
+	d, err := Parse(bytes.NewReader(append([]byte{0x12, 0x34, 0x00, 0x01, 0x00, 0x06}, zbuf.Bytes()...)))
+	if err != nil {
+		t.Fatalf("parse bgl: %v", err)
+	}
+
+	if hdr := d.Header(); hdr.Title != "Test Dict" || hdr.Author != "Someone" || hdr.Locale != "en-ru" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+	if len(d.Entries) != 4 || len(d.Resources) != 1 {
+		t.Fatalf("expected 4 entries and 1 resource, got %d and %d", len(d.Entries), len(d.Resources))
+	}
+	if e := d.Entries[0]; e.PartOfSpeech != "noun" || e.Transcription != "kæt" || e.Definition != "A small\nanimal & <charset c=T>0041;0042;</charset>." {
+		t.Errorf("incorrect entry %+v", e)
+	}
+
+	act, warnings := d.DictFile(&dictgen.ImageHandlerBase64{MaxSize: image.Pt(2, 2)})
+	if len(act) == 3 {
+		if defi := act[1].Definition; !strings.HasPrefix(defi, "кошка <img ") || !strings.Contains(defi, `src="data:image/jpeg;base64,`) {
+			t.Errorf("expected embedded image in definition, got %q", defi)
+		}
+		act[1].Definition = ""
+	}
+	importtest.CheckWarnings(t, "", warnings, `word "$2$": skipping entry: headword must not be blank`)
+	exp := dictgen.DictFile{
+		{Headword: "cat", Variant: []string{"cats", "kitty"}, HeaderInfo: "[kæt] <i>noun</i>", RawHTML: true, Definition: "A small<br/>animal & AB."},
+		{Headword: "кот", RawHTML: true},
+		{Headword: "dog", Variant: []string{"dogs"}, RawHTML: true, Definition: "<b>an animal</b>"},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
+
+func TestMissingImage(t *testing.T) {
+	// the images should still be removed if one can't be read
+	d := &Dictionary{Entries: []*Entry{{Headword: "test", Definition: `a <img src="missing.png"> b`}}}
+	act, warnings := d.DictFile(&dictgen.ImageHandlerBase64{})
+	importtest.CheckWarnings(t, "", warnings, `removing images: transform image "missing.png": open file: resource "missing.png" not found`)
+	importtest.CheckDictFile(t, "", dictgen.DictFile{{Headword: "test", RawHTML: true, Definition: "a  b"}}, act)
+}
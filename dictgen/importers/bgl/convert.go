@@ -0,0 +1,157 @@
+package bgl
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Header returns a dictfile header with the metadata from the BGL.
+func (d *Dictionary) Header() *dictgen.DictFileHeader {
+	return &dictgen.DictFileHeader{
+		Title:   importutil.OneLineHTML(cleanText(d.Title)),
+		Author:  importutil.OneLineHTML(cleanText(d.Author)),
+		License: importutil.OneLineHTML(cleanText(d.Copyright)),
+		Locale:  importutil.Locale(d.SourceLanguage, d.TargetLanguage),
+	}
+}
+
+// ImageFunc returns an ImageFunc which reads the resources embedded in the
+// BGL. Names are matched case-insensitively, and directories are ignored.
+func (d *Dictionary) ImageFunc() dictgen.ImageFunc {
+	return func(src string) (io.Reader, error) {
+		if buf, ok := d.Resources[src]; ok {
+			return bytes.NewReader(buf), nil
+		}
+		for name, buf := range d.Resources {
+			if strings.EqualFold(name, src) || strings.EqualFold(path.Base(name), path.Base(src)) {
+				return bytes.NewReader(buf), nil
+			}
+		}
+		return nil, fmt.Errorf("resource %#v not found", src)
+	}
+}
+
+// DictFile converts the dictionary into a DictFile. Alternates are added as
+// variants, and the part of speech and transcription are added to the header
+// info. If ih is not nil, images are read from the embedded resources and
+// transformed with it (see DictFileEntry.TransformImages); if an image can't
+// be transformed, it is removed. If it is nil, the image paths are left as-is
+// (e.g. if the resources are extracted separately).
+//
+// The markup and the $n$ suffixes which distinguish homonyms are removed from
+// headwords and alternates, so homonyms become separate entries with the same
+// headword. Entries with nothing left of the headword, or which contain
+// characters which aren't allowed by dictgen, are skipped and returned as
+// warnings along with the skipped alternates.
+func (d *Dictionary) DictFile(ih dictgen.ImageHandler) (dictgen.DictFile, []error) {
+	var df dictgen.DictFile
+	var warnings []error
+	img := d.ImageFunc()
+	for _, e := range d.Entries {
+		dfe, err := d.convert(e, ih, img, func(err error) {
+			warnings = append(warnings, fmt.Errorf("word %#v: %w", e.Headword, err))
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping entry: %w", e.Headword, err))
+			continue
+		}
+		df = append(df, dfe)
+	}
+	return df, warnings
+}
+
+func (d *Dictionary) convert(e *Entry, ih dictgen.ImageHandler, img dictgen.ImageFunc, warn func(error)) (*dictgen.DictFileEntry, error) {
+	dfe := &dictgen.DictFileEntry{
+		Headword: cleanWord(e.Headword),
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("headword %w", err)
+	}
+
+	var alts []string
+	for _, a := range e.Alternates {
+		alts = append(alts, cleanWord(a))
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, alts, "alternate", warn)
+
+	var info []string
+	if t := strings.TrimSpace(cleanText(e.Transcription)); t != "" {
+		info = append(info, "["+html.EscapeString(t)+"]")
+	}
+	if e.PartOfSpeech != "" {
+		info = append(info, "<i>"+e.PartOfSpeech+"</i>")
+	}
+	dfe.HeaderInfo = strings.Join(info, " ")
+
+	defi := cleanText(e.Definition)
+	defi = strings.ReplaceAll(strings.ReplaceAll(defi, "\r\n", "\n"), "\n", "<br/>")
+	defi = imgRe.ReplaceAllStringFunc(defi, func(m string) string {
+		sm := imgRe.FindStringSubmatch(m)
+		return "<img" + sm[1] + `src="` + strings.ReplaceAll(sm[2]+sm[3]+sm[4], `"`, "&quot;") + `"`
+	})
+	dfe.Definition = dictgen.SanitizeHTML(defi)
+
+	if ih != nil {
+		if err := importutil.TransformImages(dfe, ih, img, warn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+var (
+	charsetTRe = regexp.MustCompile(`(?is)<charset\s+c\s*=\s*["']?t["']?\s*>(.*?)</charset>`)
+	charsetRe  = regexp.MustCompile(`(?is)</?charset\b[^>]*>`)
+	dollarRe   = regexp.MustCompile(`\$\d+\$?`)
+	tagRe      = regexp.MustCompile(`<[^>]*>`)
+	imgRe      = regexp.MustCompile(`(?i)<img\b([^>]*?\s)src\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// cleanText replaces <charset c=T> tags (which contain semicolon-terminated
+// hex code points) with the characters, removes other charset tags, and
+// removes control characters.
+func cleanText(s string) string {
+	s = charsetTRe.ReplaceAllStringFunc(s, func(m string) string {
+		var b strings.Builder
+		for _, x := range strings.Split(charsetTRe.FindStringSubmatch(m)[1], ";") {
+			if x = strings.TrimSpace(x); x == "" {
+				continue
+			}
+			if c, err := strconv.ParseUint(x, 16, 32); err == nil {
+				b.WriteString(html.EscapeString(string(rune(c))))
+			} else {
+				b.WriteString(x)
+			}
+		}
+		return b.String()
+	})
+	s = charsetRe.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// cleanWord cleans a headword or alternate, removing the markup and the $n$
+// suffixes used to distinguish homonyms.
+func cleanWord(s string) string {
+	s = dollarRe.ReplaceAllString(cleanText(s), "")
+	s = html.UnescapeString(tagRe.ReplaceAllString(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,545 @@
+package dsl
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Header returns a dictfile header with the metadata from the DSL.
+func (d *Dictionary) Header() *dictgen.DictFileHeader {
+	return &dictgen.DictFileHeader{
+		Title:  importutil.OneLine(d.Name),
+		Locale: importutil.Locale(languageCode(d.IndexLanguage), languageCode(d.ContentsLanguage)),
+	}
+}
+
+// ImageFunc returns an ImageFunc which reads the media from Res. Files in a zip
+// are matched case-insensitively, and directories are ignored. The zip is
+// opened and indexed on the first call, and is kept open until Close is
+// called.
+func (d *Dictionary) ImageFunc() dictgen.ImageFunc {
+	return func(src string) (io.Reader, error) {
+		switch {
+		case d.Res == "":
+			return dictgen.ImageFuncFilesystem(src)
+		case strings.EqualFold(filepath.Ext(d.Res), ".zip"):
+			zf, err := d.openZip()
+			if err != nil {
+				return nil, err
+			}
+			f, ok := zf[strings.ToLower(path.Base(src))]
+			if !ok {
+				return nil, fmt.Errorf("resource %#v not found", src)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			buf, err := ioutil.ReadAll(rc)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(buf), nil
+		default:
+			return os.Open(filepath.Join(d.Res, filepath.FromSlash(src)))
+		}
+	}
+}
+
+// openZip opens the zip in Res if it hasn't been opened yet, and returns the
+// files by their lowercase base name (the first one wins).
+func (d *Dictionary) openZip() (map[string]*zip.File, error) {
+	d.zmu.Lock()
+	defer d.zmu.Unlock()
+	if d.zname != d.Res {
+		d.closeZip()
+		d.zname = d.Res
+		if d.zr, d.zerr = zip.OpenReader(d.Res); d.zerr == nil {
+			d.zf = map[string]*zip.File{}
+			for _, f := range d.zr.File {
+				if k := strings.ToLower(path.Base(f.Name)); !f.FileInfo().IsDir() && d.zf[k] == nil {
+					d.zf[k] = f
+				}
+			}
+		}
+	}
+	return d.zf, d.zerr
+}
+
+func (d *Dictionary) closeZip() error {
+	var err error
+	if d.zr != nil {
+		err = d.zr.Close()
+	}
+	d.zname, d.zr, d.zf, d.zerr = "", nil, nil, nil
+	return err
+}
+
+// Close closes the media zip if it was opened by ImageFunc. The Dictionary can
+// still be used afterwards.
+func (d *Dictionary) Close() error {
+	d.zmu.Lock()
+	defer d.zmu.Unlock()
+	return d.closeZip()
+}
+
+// DictFile converts the dictionary into a DictFile. The first headword is used
+// as the headword, and the others are added as variants. Optional parts of
+// headwords ({...} and (...)) are expanded into variants with and without
+// them. References to other cards ([ref] and <<...>>) are converted into
+// cross-references if the target exists.
+//
+// If ih is not nil, images referenced by [s] tags are read with ImageFunc and
+// transformed with it (see DictFileEntry.TransformImages); if an image can't be
+// transformed, it is removed. If it is nil, the image paths are left as-is.
+// Other media (e.g. sounds) are removed.
+//
+// Warnings are returned with the line number of the card. Cards are skipped if
+// the first headword contains characters which aren't allowed by dictgen
+// (usually quotes, which DSL allows), and so are the forms of the other
+// headwords.
+func (d *Dictionary) DictFile(ih dictgen.ImageHandler) (dictgen.DictFile, []error) {
+	words := map[string]bool{}
+	for _, e := range d.Entries {
+		for _, hw := range e.Headwords {
+			for _, w := range headwordForms(hw) {
+				words[strings.ToLower(w)] = true
+			}
+		}
+	}
+
+	var df dictgen.DictFile
+	var warnings []error
+	img := d.ImageFunc()
+	for _, e := range d.Entries {
+		var hw string
+		if len(e.Headwords) != 0 {
+			hw = headwordText(e.Headwords[0])
+		}
+		dfe, err := d.convert(e, words, ih, img, func(err error) {
+			warnings = append(warnings, fmt.Errorf("line %d: word %#v: %w", e.Line, hw, err))
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("line %d: word %#v: skipping entry: %w", e.Line, hw, err))
+			continue
+		}
+		df = append(df, dfe)
+	}
+	return df, warnings
+}
+
+func (d *Dictionary) convert(e *Entry, words map[string]bool, ih dictgen.ImageHandler, img dictgen.ImageFunc, warn func(error)) (*dictgen.DictFileEntry, error) {
+	var forms []string
+	for _, hw := range e.Headwords {
+		forms = append(forms, headwordForms(hw)...)
+	}
+	if len(forms) == 0 {
+		return nil, errors.New("no headword")
+	}
+
+	dfe := &dictgen.DictFileEntry{
+		Headword: forms[0],
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("headword %w", err)
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, forms[1:], "headword", warn)
+
+	c := &card{
+		headword: headwordText(e.Headwords[0]),
+		ref: func(target string) bool {
+			return words[strings.ToLower(target)]
+		},
+	}
+	var b strings.Builder
+	for _, line := range e.Body {
+		b.WriteString(c.line(line))
+	}
+	dfe.Definition = b.String()
+
+	if ih != nil {
+		if err := importutil.TransformImages(dfe, ih, img, warn); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+// maxOptional is the maximum number of optional parts in a headword to expand
+// into all combinations. If there are more, only the forms with all or none of
+// them are used.
+const maxOptional = 4
+
+// headwordForms returns the forms of a headword line, expanding the optional
+// parts ({...} and (...)). The first one is the full form.
+func headwordForms(s string) []string {
+	var parts []string // alternating fixed and optional parts
+	var cur strings.Builder
+	var opt byte // the closing character of the current optional part
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			_, n := utf8.DecodeRuneInString(s[i+1:])
+			cur.WriteString(s[i+1 : i+1+n])
+			i += n
+		case c == '[':
+			if j := strings.IndexByte(s[i:], ']'); j != -1 {
+				i += j // markup (e.g. in the unsorted part)
+			}
+		case opt == 0 && (c == '{' || c == '('):
+			parts = append(parts, cur.String())
+			cur.Reset()
+			if opt = '}'; c == '(' {
+				opt = ')'
+			}
+		case opt != 0 && c == opt:
+			parts = append(parts, cur.String())
+			cur.Reset()
+			opt = 0
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	parts = append(parts, cur.String())
+
+	n := len(parts) / 2
+	var masks []int
+	if n <= maxOptional {
+		for m := 1<<n - 1; m >= 0; m-- {
+			masks = append(masks, m)
+		}
+	} else {
+		masks = []int{1<<n - 1, 0}
+	}
+
+	var forms []string
+	seen := map[string]bool{}
+	for _, m := range masks {
+		var b strings.Builder
+		for i, p := range parts {
+			if i%2 == 0 || m&(1<<(i/2)) != 0 {
+				b.WriteString(p)
+			}
+		}
+		if f := strings.Join(strings.Fields(b.String()), " "); f != "" && !seen[f] {
+			seen[f] = true
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+// headwordText returns the full form of a headword line.
+func headwordText(s string) string {
+	if f := headwordForms(s); len(f) != 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// card converts the body of a card to HTML.
+type card struct {
+	headword string                   // for ~
+	ref      func(target string) bool // whether a reference target exists
+}
+
+// line converts a body line to HTML. Each line is put in its own div (the [m]
+// tags set the indentation).
+func (c *card) line(s string) string {
+	if strings.HasPrefix(s, "@") {
+		// sub-entry
+		if t := strings.TrimSpace(c.text(s[1:])); t != "" {
+			return `<div class="sub"><b>` + html.EscapeString(t) + `</b></div>`
+		}
+		return ""
+	}
+
+	type elem struct {
+		name  string
+		close string
+	}
+	var b strings.Builder
+	var stack []elem
+	var block bool
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			_, n := utf8.DecodeRuneInString(s[i+1:])
+			b.WriteString(html.EscapeString(s[i+1 : i+1+n]))
+			i += 1 + n
+		case s[i] == '~':
+			b.WriteString(html.EscapeString(c.headword))
+			i++
+		case strings.HasPrefix(s[i:], "<<") && strings.Contains(s[i+2:], ">>"):
+			j := strings.Index(s[i+2:], ">>")
+			b.WriteString(c.reference(s[i+2 : i+2+j]))
+			i += j + 4
+		case s[i] == '[' && strings.IndexByte(s[i:], ']') != -1:
+			j := strings.IndexByte(s[i:], ']')
+			tag := s[i+1 : i+j]
+			i += j + 1
+
+			name, arg := tag, ""
+			if k := strings.IndexByte(tag, ' '); k != -1 {
+				name, arg = tag[:k], strings.TrimSpace(tag[k+1:])
+			}
+			if strings.HasPrefix(name, "/") {
+				name = tagName(name[1:])
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k].name == name {
+						for ; len(stack) > k; stack = stack[:len(stack)-1] {
+							b.WriteString(stack[len(stack)-1].close)
+						}
+						break
+					}
+				}
+				continue
+			}
+			name = tagName(name)
+
+			switch name {
+			case "ref", "url", "s":
+				// the contents are used as a whole
+				end := strings.Index(s[i:], "[/"+name+"]")
+				if end == -1 {
+					end = len(s) - i
+				}
+				content := s[i : i+end]
+				if i += end + len(name) + 3; i > len(s) {
+					i = len(s)
+				}
+				switch name {
+				case "ref":
+					b.WriteString(c.reference(content))
+				case "url":
+					u := html.EscapeString(c.text(content))
+					b.WriteString(`<a href="` + u + `">` + u + `</a>`)
+				case "s":
+					b.WriteString(c.media(content))
+				}
+				continue
+			case "br":
+				b.WriteString("<br/>")
+				continue
+			}
+
+			open, close := tagHTML(tag, name, arg)
+			if name == "m" {
+				block = true
+			}
+			b.WriteString(open)
+			stack = append(stack, elem{name, close})
+		default:
+			_, n := utf8.DecodeRuneInString(s[i:])
+			b.WriteString(html.EscapeString(s[i : i+n]))
+			i += n
+		}
+	}
+	for k := len(stack) - 1; k >= 0; k-- {
+		b.WriteString(stack[k].close)
+	}
+
+	if h := strings.TrimSpace(b.String()); h == "" {
+		return ""
+	} else if block {
+		return h
+	} else {
+		return "<div>" + h + "</div>"
+	}
+}
+
+// tagName normalizes a tag name (e.g. m1 is m).
+func tagName(name string) string {
+	if len(name) == 2 && name[0] == 'm' && name[1] >= '0' && name[1] <= '9' {
+		return "m"
+	}
+	return name
+}
+
+// tagHTML returns the HTML for a DSL tag. Unknown tags are removed, but their
+// contents are kept.
+func tagHTML(tag, name, arg string) (open, close string) {
+	switch name {
+	case "b", "i", "u", "sub", "sup":
+		return "<" + name + ">", "</" + name + ">"
+	case "c":
+		if arg == "" {
+			arg = "green"
+		}
+		return `<span style="color:` + html.EscapeString(arg) + `">`, "</span>"
+	case "m":
+		if n, _ := strconv.Atoi(strings.TrimPrefix(tag, "m")); n != 0 {
+			return `<div style="margin-left:` + strconv.Itoa(n) + `em">`, "</div>"
+		}
+		return "<div>", "</div>"
+	case "trn", "!trs", "trs":
+		return `<span class="trn">`, "</span>"
+	case "ex":
+		return `<i class="ex">`, "</i>"
+	case "com":
+		return `<span class="com">`, "</span>"
+	case "p":
+		return `<i class="p">`, "</i>"
+	case "t":
+		return `<span class="t">`, "</span>"
+	case "*":
+		return `<span class="sec">`, "</span>"
+	case "'":
+		return `<span class="stress">`, "\u0301</span>"
+	}
+	return "", ""
+}
+
+// reference converts the target of a [ref] or <<...>> into a cross-reference
+// if it exists, or into text otherwise.
+func (c *card) reference(s string) string {
+	t := strings.Join(strings.Fields(c.text(s)), " ")
+	if t != "" && !strings.ContainsAny(t, "[]|<>&") && c.ref(t) {
+		return "[[" + t + "]]"
+	}
+	return html.EscapeString(t)
+}
+
+// media converts the file referenced by an [s] tag into an image, or removes
+// it if it isn't one.
+func (c *card) media(s string) string {
+	src := strings.TrimSpace(c.text(s))
+	switch strings.ToLower(path.Ext(src)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".bmp":
+		return `<img src="` + html.EscapeString(src) + `"/>`
+	}
+	return ""
+}
+
+// text returns the text of DSL markup, with the tags removed and the escapes
+// and ~ replaced.
+func (c *card) text(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case s[i] == '~':
+			b.WriteString(c.headword)
+		case s[i] == '[' && strings.IndexByte(s[i:], ']') != -1:
+			i += strings.IndexByte(s[i:], ']')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// languageCode converts a DSL language name (e.g. English) into the ISO 639-1
+// code (e.g. en). If it is already a language code, it is normalized.
+func languageCode(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return ""
+	}
+	if c, ok := languages[strings.ToLower(s)]; ok {
+		return c
+	}
+	if b, err := language.ParseBase(strings.ToLower(s)); err == nil {
+		return b.String()
+	}
+	return ""
+}
+
+// languages maps the DSL language names to ISO 639-1 codes.
+var languages = map[string]string{
+	"afrikaans":              "af",
+	"albanian":               "sq",
+	"arabic":                 "ar",
+	"armenian":               "hy",
+	"azeri":                  "az",
+	"bashkir":                "ba",
+	"basque":                 "eu",
+	"belarusian":             "be",
+	"bulgarian":              "bg",
+	"catalan":                "ca",
+	"chinese":                "zh",
+	"chineseprc":             "zh",
+	"chinesetaiwan":          "zh",
+	"croatian":               "hr",
+	"czech":                  "cs",
+	"danish":                 "da",
+	"dutch":                  "nl",
+	"english":                "en",
+	"esperanto":              "eo",
+	"estonian":               "et",
+	"finnish":                "fi",
+	"french":                 "fr",
+	"georgian":               "ka",
+	"german":                 "de",
+	"germannewspelling":      "de",
+	"greek":                  "el",
+	"greekmodern":            "el",
+	"hebrew":                 "he",
+	"hungarian":              "hu",
+	"icelandic":              "is",
+	"indonesian":             "id",
+	"irish":                  "ga",
+	"italian":                "it",
+	"japanese":               "ja",
+	"kazakh":                 "kk",
+	"korean":                 "ko",
+	"kyrgyz":                 "ky",
+	"latin":                  "la",
+	"latvian":                "lv",
+	"lithuanian":             "lt",
+	"malay":                  "ms",
+	"mongolian":              "mn",
+	"norwegian":              "no",
+	"norwegianbokmal":        "nb",
+	"norwegiannynorsk":       "nn",
+	"persian":                "fa",
+	"polish":                 "pl",
+	"portuguese":             "pt",
+	"portuguesestandard":     "pt",
+	"portuguesebrazilian":    "pt",
+	"romanian":               "ro",
+	"russian":                "ru",
+	"serbian":                "sr",
+	"serbiancyrillic":        "sr",
+	"slovak":                 "sk",
+	"slovenian":              "sl",
+	"spanish":                "es",
+	"spanishmodernsort":      "es",
+	"spanishtraditionalsort": "es",
+	"swahili":                "sw",
+	"swedish":                "sv",
+	"tajik":                  "tg",
+	"tatar":                  "tt",
+	"thai":                   "th",
+	"turkish":                "tr",
+	"turkmen":                "tk",
+	"ukrainian":              "uk",
+	"uzbek":                  "uz",
+	"uzbekcyrillic":          "uz",
+	"vietnamese":             "vi",
+	"welsh":                  "cy",
+	"yiddish":                "yi",
+}
@@ -0,0 +1,229 @@
+// Package dsl reads ABBYY Lingvo DSL dictionary sources and converts them into
+// dictfiles.
+//
+// A DSL file starts with header lines (beginning with #), followed by the
+// cards, which consist of one or more unindented headword lines followed by
+// the indented body lines. The body is formatted with tags in square brackets
+// (e.g. [b] and [/b]), and {{...}} is a comment. Files are usually UTF-16, but
+// UTF-8 and legacy code pages (as specified by #SOURCE_CODE_PAGE) are also
+// supported, as are dictzip-compressed (.dsl.dz) files.
+package dsl
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Dictionary is a parsed DSL dictionary.
+type Dictionary struct {
+	Name             string // #NAME
+	IndexLanguage    string // #INDEX_LANGUAGE (e.g. English)
+	ContentsLanguage string // #CONTENTS_LANGUAGE (e.g. Russian)
+
+	Entries []*Entry
+
+	// Res is the directory or zip file containing the media referenced by [s]
+	// tags (set by Open). If empty, media is loaded relative to the current
+	// directory.
+	Res string
+
+	zmu   sync.Mutex
+	zname string               // the zip which zr was opened from
+	zr    *zip.ReadCloser      // opened by ImageFunc
+	zf    map[string]*zip.File // by lowercase base name
+	zerr  error
+}
+
+// Entry is a card from the dictionary. The comments have been removed, but the
+// text is otherwise as in the DSL.
+type Entry struct {
+	Line      int      // the line number of the first headword
+	Headwords []string // the headword lines
+	Body      []string // the body lines, with the indentation removed
+}
+
+// Open parses a DSL file (e.g. dict.dsl or dict.dsl.dz). The media is loaded
+// from the first one which exists of dict.dsl.files.zip, dict.files.zip,
+// dict.dsl.files, dict.files, or the directory containing the DSL.
+func Open(name string) (*Dictionary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(strings.ToLower(name), ".dz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("decompress: %w", err)
+		}
+		r = zr
+	}
+
+	d, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base := name[:len(name)-len(filepath.Ext(name))]
+	if strings.HasSuffix(strings.ToLower(name), ".dz") {
+		base = base[:len(base)-len(filepath.Ext(base))]
+	}
+	d.Res = filepath.Dir(name)
+	for _, res := range []string{base + ".dsl.files.zip", base + ".files.zip", base + ".dsl.files", base + ".files"} {
+		if _, err := os.Stat(res); err == nil {
+			d.Res = res
+			break
+		}
+	}
+	return d, nil
+}
+
+// Parse parses a DSL dictionary.
+func Parse(r io.Reader) (*Dictionary, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := decode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	d := new(Dictionary)
+	var e *Entry
+	for i, line := range strings.Split(removeComments(s), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case e == nil && strings.HasPrefix(line, "#"):
+			d.directive(line)
+		case strings.TrimSpace(line) == "":
+			// cards are separated by the headword lines, so empty lines don't matter
+		case line[0] == ' ' || line[0] == '\t':
+			if e != nil {
+				e.Body = append(e.Body, strings.TrimLeft(line, " \t"))
+			}
+		default:
+			if e == nil || len(e.Body) != 0 {
+				e = &Entry{Line: i + 1}
+				d.Entries = append(d.Entries, e)
+			}
+			e.Headwords = append(e.Headwords, line)
+		}
+	}
+	return d, nil
+}
+
+// directive parses a header line.
+func (d *Dictionary) directive(line string) {
+	spl := strings.SplitN(strings.TrimPrefix(line, "#"), " ", 2)
+	if len(spl) != 2 {
+		return
+	}
+	v := strings.TrimSpace(spl[1])
+	if u, err := strconv.Unquote(v); err == nil {
+		v = u
+	} else {
+		v = strings.Trim(v, `"`)
+	}
+	switch strings.ToUpper(spl[0]) {
+	case "NAME":
+		d.Name = v
+	case "INDEX_LANGUAGE":
+		d.IndexLanguage = v
+	case "CONTENTS_LANGUAGE":
+		d.ContentsLanguage = v
+	}
+}
+
+// decode decodes a DSL file. UTF-16 and UTF-8 are detected using the BOM (or
+// the null bytes for UTF-16 without one). Otherwise, if it isn't valid UTF-8,
+// the code page from #SOURCE_CODE_PAGE (or Windows-1252) is used.
+func decode(buf []byte) (string, error) {
+	var enc encoding.Encoding
+	switch {
+	case bytes.HasPrefix(buf, []byte{0xFF, 0xFE}), len(buf) >= 2 && buf[0] != 0 && buf[1] == 0:
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case bytes.HasPrefix(buf, []byte{0xFE, 0xFF}), len(buf) >= 2 && buf[0] == 0 && buf[1] != 0:
+		enc = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case utf8.Valid(buf):
+		return string(bytes.TrimPrefix(buf, []byte{0xEF, 0xBB, 0xBF})), nil
+	default:
+		enc = charmap.Windows1252
+		if i := bytes.Index(buf, []byte("#SOURCE_CODE_PAGE")); i != -1 {
+			line := buf[i:]
+			if j := bytes.IndexByte(line, '\n'); j != -1 {
+				line = line[:j]
+			}
+			for name, cs := range codePages {
+				if bytes.Contains(bytes.ToLower(line), []byte(name)) {
+					enc = cs
+					break
+				}
+			}
+		}
+	}
+	b, err := enc.NewDecoder().Bytes(buf)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// codePages maps the values of #SOURCE_CODE_PAGE to the charsets.
+var codePages = map[string]encoding.Encoding{
+	"latin":           charmap.Windows1252,
+	"easterneuropean": charmap.Windows1250,
+	"cyrillic":        charmap.Windows1251,
+	"greek":           charmap.Windows1253,
+	"turkish":         charmap.Windows1254,
+	"hebrew":          charmap.Windows1255,
+	"arabic":          charmap.Windows1256,
+	"baltic":          charmap.Windows1257,
+	"vietnamese":      charmap.Windows1258,
+	"thai":            charmap.Windows874,
+}
+
+// removeComments removes {{...}} comments, which may span multiple lines (the
+// newlines are kept so the line numbers stay the same). Escaped braces (\{)
+// are not treated as the start of a comment.
+func removeComments(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			b.WriteString(s[i : i+2])
+			i++
+		case strings.HasPrefix(s[i:], "{{"):
+			j := strings.Index(s[i+2:], "}}")
+			if j == -1 {
+				j = len(s) - i - 2
+			}
+			b.WriteString(strings.Repeat("\n", strings.Count(s[i+2:i+2+j], "\n")))
+			i += j + 3
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
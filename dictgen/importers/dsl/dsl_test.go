@@ -0,0 +1,146 @@
+package dsl
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+
+	src, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("" +
+		"#NAME \"Test Dict\"\r\n" +
+		"#INDEX_LANGUAGE \"English\"\r\n" +
+		"#CONTENTS_LANGUAGE \"Russian\"\r\n" +
+		"{{a comment\r\nspanning lines}}\r\n" +
+		"cat\r\n" +
+		"{the }kitty(-cat)\r\n" +
+		"\t[m1][p]n.[/p] [trn]кошка[/trn] {{note}}[c]~[/c][/m]\r\n" +
+		"\t[m2][ex][lang id=1033]a [b]black[/b] cat[/lang][/ex] — see [ref]dog[/ref], <<wolf>>[/m]\r\n" +
+		"\t[s]cat.png[/s][s]cat.wav[/s] \\[1\\] m[']o[/']loko\r\n" +
+		"\r\n" +
+		"dog\r\n" +
+		"\t[c red]an[/c] [i]animal[/i], not a [ref]kitty[/ref]\r\n" +
+		"{[c]}{[/c]}\r\n" +
+		"\tonly markup\r\n")
+	if err != nil {
+		t.Fatalf("encode dsl: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "test.dsl"), []byte(src), 0644); err != nil {
+		t.Fatalf("write dsl: %v", err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	if w, err := zw.Create("CAT.png"); err != nil {
+		t.Fatalf("write zip: %v", err)
+	} else {
+		w.Write(img.Bytes())
+	}
+	zw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "test.dsl.files.zip"), zbuf.Bytes(), 0644); err != nil {
+		t.Fatalf("write zip: %v", err)
+	}
+
+	d, err := Open(filepath.Join(dir, "test.dsl"))
+	if err != nil {
+		t.Fatalf("open dsl: %v", err)
+	}
+	if hdr := d.Header(); hdr.Title != "Test Dict" || hdr.Locale != "en-ru" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+	if d.Res != filepath.Join(dir, "test.dsl.files.zip") {
+		t.Errorf("incorrect resources %q", d.Res)
+	}
+	if len(d.Entries) != 3 || d.Entries[0].Line != 6 || !reflect.DeepEqual(d.Entries[0].Headwords, []string{"cat", "{the }kitty(-cat)"}) {
+		t.Fatalf("incorrect entries %+v", d.Entries)
+	}
+
+	act, warnings := d.DictFile(&dictgen.ImageHandlerBase64{MaxSize: image.Pt(2, 2)})
+	importtest.CheckWarnings(t, "", warnings, `line 14: word "": skipping entry: no headword`)
+	if len(act) == 2 {
+		if defi := act[0].Definition; !strings.Contains(defi, `<div><img `) || !strings.Contains(defi, `src="data:image/jpeg;base64,`) || !strings.HasSuffix(defi, "\"/> [1] m<span class=\"stress\">o\u0301</span>loko</div>") {
+			t.Errorf("expected embedded image in definition, got %q", defi)
+		} else {
+			act[0].Definition = defi[:strings.Index(defi, "<div><img")]
+		}
+	}
+	exp := dictgen.DictFile{
+		{Headword: "cat", Variant: []string{"the kitty-cat", "kitty-cat", "the kitty", "kitty"}, RawHTML: true, Definition: `<div style="margin-left:1em"><i class="p">n.</i> <span class="trn">кошка</span> <span style="color:green">cat</span></div><div style="margin-left:2em"><i class="ex">a <b>black</b> cat</i> — see [[dog]], wolf</div>`},
+		{Headword: "dog", RawHTML: true, Definition: `<div><span style="color:red">an</span> <i>animal</i>, not a [[kitty]]</div>`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+
+	imgf := d.ImageFunc()
+	for _, src := range []string{"cat.png", "sub/Cat.PNG"} {
+		if r, err := imgf(src); err != nil {
+			t.Errorf("image %q: unexpected error: %v", src, err)
+		} else if buf, _ := io.ReadAll(r); !bytes.Equal(buf, img.Bytes()) {
+			t.Errorf("image %q: incorrect contents", src)
+		}
+	}
+	if _, err := imgf("dog.png"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("image %q: expected not found error, got %v", "dog.png", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if _, err := imgf("cat.png"); err != nil {
+		t.Errorf("image %q after close: unexpected error: %v", "cat.png", err)
+	}
+	d.Close()
+}
+
+func TestHeadwordForms(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		exp []string
+	}{
+		{"cat", []string{"cat"}},
+		{"colo(u)r", []string{"colour", "color"}},
+		{"{to }go", []string{"to go", "go"}},
+		{"a\\(b\\) {[i]}c{[/i]}", []string{"a(b) c"}},
+		{"(a)(b)(c)(d)(e)x", []string{"abcdex", "x"}},
+	} {
+		if act := headwordForms(tc.in); !reflect.DeepEqual(act, tc.exp) {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.exp, act)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		in  []byte
+		exp string
+	}{
+		{[]byte("\xef\xbb\xbf#NAME \"x\"\n"), "#NAME \"x\"\n"},
+		{[]byte("\xff\xfe#\x00x\x00"), "#x"},
+		{[]byte("#\x00x\x00"), "#x"},
+		{[]byte("\xfe\xff\x00#\x00x"), "#x"},
+		{[]byte("#SOURCE_CODE_PAGE \"Cyrillic\"\n\xea\xee\xf2"), "#SOURCE_CODE_PAGE \"Cyrillic\"\nкот"},
+		{[]byte("caf\xe9"), "café"},
+	} {
+		if act, err := decode(tc.in); err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+		} else if act != tc.exp {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.exp, act)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package importtest contains helpers for testing the importers.
+package importtest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+)
+
+// CheckDictFile checks if the converted entries are the expected ones, showing
+// both as dictfiles if they aren't.
+func CheckDictFile(t testing.TB, name string, exp, act dictgen.DictFile) {
+	t.Helper()
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("%sexpected:\n%s\ngot:\n%s", prefix(name), dump(t, exp), dump(t, act))
+	}
+}
+
+// CheckWarnings checks if there is a warning containing each of the expected
+// strings, in order, and nothing else.
+func CheckWarnings(t testing.TB, name string, warnings []error, exp ...string) {
+	t.Helper()
+	ok := len(warnings) == len(exp)
+	for i := 0; ok && i < len(exp); i++ {
+		ok = strings.Contains(warnings[i].Error(), exp[i])
+	}
+	if !ok {
+		t.Errorf("%sexpected warnings containing %q, got %q", prefix(name), exp, warnings)
+	}
+}
+
+func prefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return name + ": "
+}
+
+func dump(t testing.TB, df dictgen.DictFile) string {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	if err := df.WriteDictFile(buf); err != nil {
+		t.Fatalf("write dictfile: %v", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,108 @@
+package importutil
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/pgaskin/dictutil/dictgen"
+)
+
+// Variants returns the words which can be used as variants of the headword,
+// skipping blank ones and duplicates. Words which aren't allowed by dictgen
+// are skipped with a warning, where kind describes them (e.g. synonym).
+func Variants(headword string, words []string, kind string, warn func(error)) []string {
+	var vs []string
+	seen := map[string]bool{headword: true}
+	for _, w := range words {
+		if w == "" || seen[w] {
+			continue
+		}
+		seen[w] = true
+		if err := dictgen.ValidateWord(w); err != nil {
+			warn(fmt.Errorf("skipping %s %#v: %w", kind, w, err))
+			continue
+		}
+		vs = append(vs, w)
+	}
+	return vs
+}
+
+// TransformImages transforms the images in the entry with ih (see
+// DictFileEntry.TransformImages). If they can't be transformed (e.g. if an
+// image doesn't exist), they are removed, and a warning is returned.
+func TransformImages(dfe *dictgen.DictFileEntry, ih dictgen.ImageHandler, img dictgen.ImageFunc, warn func(error)) error {
+	if err := dfe.TransformImages(ih, img); err != nil {
+		warn(fmt.Errorf("removing images: %w", err))
+		if err := dfe.TransformImages(new(dictgen.ImageHandlerRemove), func(string) (io.Reader, error) {
+			return strings.NewReader(""), nil // the image isn't needed to remove it (and it may not exist)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var imgSrcRe = regexp.MustCompile(`(?i)(<img\s[^>]*src=["'])([^"']+)(["'])`)
+
+// ResolveImages resolves relative image paths in HTML against the res
+// directory.
+func ResolveImages(s, res string) string {
+	if res == "" {
+		return s
+	}
+	return imgSrcRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := imgSrcRe.FindStringSubmatch(m)
+		src := html.UnescapeString(sm[2])
+		if strings.Contains(src, ":") || path.IsAbs(src) || filepath.IsAbs(src) {
+			return m
+		}
+		return sm[1] + html.EscapeString(filepath.Join(res, filepath.FromSlash(src))) + sm[3]
+	})
+}
+
+// OneLine collapses the whitespace in a plain text metadata value.
+func OneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var (
+	tagRe = regexp.MustCompile(`<[^>]*>`)
+	brRe  = regexp.MustCompile(`(?i)<br\s*/?>`)
+)
+
+// OneLineHTML converts an HTML metadata value to plain text on a single line.
+func OneLineHTML(s string) string {
+	return OneLine(html.UnescapeString(tagRe.ReplaceAllString(brRe.ReplaceAllString(s, " "), "")))
+}
+
+// NormalizeLanguage converts a language code (e.g. ENG, deu, or en_US) into
+// the ISO 639-1 code if possible (e.g. en).
+func NormalizeLanguage(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return ""
+	}
+	if b, err := language.ParseBase(strings.ToLower(strings.SplitN(strings.ReplaceAll(s, "_", "-"), "-", 2)[0])); err == nil {
+		return b.String()
+	}
+	return strings.ToLower(s)
+}
+
+// Locale returns the dictfile locale for the source and target languages
+// (which should already be normalized).
+func Locale(from, to string) string {
+	switch {
+	case from == "":
+		return ""
+	case to == "" || to == from:
+		return from
+	default:
+		return from + "-" + to
+	}
+}
@@ -0,0 +1,104 @@
+package importutil
+
+import (
+	"errors"
+	"html"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+)
+
+func TestVariants(t *testing.T) {
+	var warnings []string
+	vs := Variants("cat", []string{"cats", "", "cat", "Cat", "cats", "bad\"", "<var>"}, "synonym", func(err error) {
+		warnings = append(warnings, err.Error())
+	})
+	if exp := []string{"cats", "Cat"}; !reflect.DeepEqual(vs, exp) {
+		t.Errorf("expected variants %q, got %q", exp, vs)
+	}
+	if exp := []string{
+		`skipping synonym "bad\"": contains illegal string: must not contain "\""`,
+		`skipping synonym "<var>": contains illegal string: must not contain "<var"`,
+	}; !reflect.DeepEqual(warnings, exp) {
+		t.Errorf("expected warnings %q, got %q", exp, warnings)
+	}
+}
+
+func TestTransformImages(t *testing.T) {
+	dfe := &dictgen.DictFileEntry{Headword: "test", RawHTML: true, Definition: `a <img src="missing.png"/> b`}
+	var warnings []error
+	if err := TransformImages(dfe, new(dictgen.ImageHandlerEmbed), func(string) (io.Reader, error) {
+		return nil, errors.New("not found")
+	}, func(err error) {
+		warnings = append(warnings, err)
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a warning for the missing image, got %v", warnings)
+	}
+	if exp := "a  b"; dfe.Definition != exp {
+		t.Errorf("expected image to be removed (%q), got %q", exp, dfe.Definition)
+	}
+}
+
+func TestResolveImages(t *testing.T) {
+	res := filepath.Join("dict", "res")
+	for _, c := range []struct {
+		In, Out string
+	}{
+		{`<img src="a.png"/>`, `<img src="` + filepath.Join(res, "a.png") + `"/>`},
+		{`<IMG alt="x" SRC='sub/a&amp;b.png'>`, `<IMG alt="x" SRC='` + html.EscapeString(filepath.Join(res, "sub", "a&b.png")) + `'>`},
+		{`<img src="/a.png"/>`, `<img src="/a.png"/>`},
+		{`<img src="data:image/png;base64,AAAA"/>`, `<img src="data:image/png;base64,AAAA"/>`},
+	} {
+		if act := ResolveImages(c.In, res); act != c.Out {
+			t.Errorf("%q: expected %q, got %q", c.In, c.Out, act)
+		}
+	}
+	if act := ResolveImages(`<img src="a.png"/>`, ""); act != `<img src="a.png"/>` {
+		t.Errorf("expected images to be left as-is without res, got %q", act)
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	if act := OneLine(" a\n  b\tc "); act != "a b c" {
+		t.Errorf("expected %q, got %q", "a b c", act)
+	}
+	if act := OneLineHTML("Test <b>Dict</b><br/>by A&amp;B<BR>"); act != "Test Dict by A&B" {
+		t.Errorf("expected %q, got %q", "Test Dict by A&B", act)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for _, c := range []struct {
+		In, Out string
+	}{
+		{"", ""},
+		{"en", "en"},
+		{"ENG", "en"},
+		{"deu", "de"},
+		{"en_US", "en"},
+		{"pt-BR", "pt"},
+		{"Klingon", "klingon"},
+	} {
+		if act := NormalizeLanguage(c.In); act != c.Out {
+			t.Errorf("%q: expected %q, got %q", c.In, c.Out, act)
+		}
+	}
+	for _, c := range []struct {
+		From, To, Out string
+	}{
+		{"", "en", ""},
+		{"en", "", "en"},
+		{"en", "en", "en"},
+		{"en", "ru", "en-ru"},
+	} {
+		if act := Locale(c.From, c.To); act != c.Out {
+			t.Errorf("%q %q: expected %q, got %q", c.From, c.To, c.Out, act)
+		}
+	}
+}
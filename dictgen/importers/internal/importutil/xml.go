@@ -0,0 +1,71 @@
+// Package importutil contains code shared by the importers.
+package importutil
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// HTMLTags are the tags which are passed through as-is when converting XML
+// markup to HTML.
+var HTMLTags = map[string]bool{
+	"b": true, "i": true, "u": true, "s": true, "sub": true, "sup": true,
+	"big": true, "small": true, "tt": true, "blockquote": true,
+	"p": true, "div": true, "ul": true, "ol": true, "li": true,
+}
+
+// XMLTokens parses XML markup (which doesn't need to have a root element, and
+// can contain HTML entities).
+func XMLTokens(s string) ([]xml.Token, error) {
+	d := xml.NewDecoder(strings.NewReader("<root>" + s + "</root>"))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var ts []xml.Token
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		ts = append(ts, xml.CopyToken(t))
+	}
+	if len(ts) >= 2 {
+		ts = ts[1 : len(ts)-1] // the root
+	}
+	return ts, nil
+}
+
+// XMLText returns the text inside the element starting at ts[0], and the
+// number of tokens it spans.
+func XMLText(ts []xml.Token) (string, int) {
+	var b strings.Builder
+	var depth int
+	for i, t := range ts {
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth--; depth == 0 {
+				return b.String(), i + 1
+			}
+		case xml.CharData:
+			b.Write(t)
+		}
+	}
+	return b.String(), len(ts)
+}
+
+// XMLAttr returns the value of the attribute with the specified local name, or
+// an empty string if it doesn't exist.
+func XMLAttr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
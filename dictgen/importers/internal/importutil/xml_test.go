@@ -0,0 +1,31 @@
+package importutil
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestXMLTokens(t *testing.T) {
+	ts, err := XMLTokens(`a &amp; <k id="x">b <opt>c</opt></k>&eacute;<br>`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ts) != 10 {
+		t.Fatalf("expected 10 tokens, got %d: %#v", len(ts), ts)
+	}
+	if cd, ok := ts[0].(xml.CharData); !ok || string(cd) != "a & " {
+		t.Errorf("expected entities to be decoded, got %#v", ts[0])
+	}
+	if se, ok := ts[1].(xml.StartElement); !ok || XMLAttr(se, "id") != "x" || XMLAttr(se, "class") != "" {
+		t.Errorf("expected start element with id, got %#v", ts[1])
+	}
+	if text, n := XMLText(ts[1:]); text != "b c" || n != 6 {
+		t.Errorf("expected text %q spanning 6 tokens, got %q spanning %d", "b c", text, n)
+	}
+	if cd, ok := ts[7].(xml.CharData); !ok || string(cd) != "é" {
+		t.Errorf("expected html entities to be decoded, got %#v", ts[7])
+	}
+	if ee, ok := ts[9].(xml.EndElement); !ok || ee.Name.Local != "br" {
+		t.Errorf("expected auto-closed br, got %#v", ts[9])
+	}
+}
@@ -0,0 +1,222 @@
+package stardict
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+	"github.com/pgaskin/dictutil/dictgen/importers/xdxf"
+)
+
+// Header returns a dictfile header with the metadata from the ifo.
+func (d *Dictionary) Header() *dictgen.DictFileHeader {
+	return &dictgen.DictFileHeader{
+		Title:  importutil.OneLineHTML(d.BookName),
+		Author: importutil.OneLineHTML(d.Author),
+	}
+}
+
+// DictFile converts the dictionary into a DictFile. Synonyms are added as
+// variants, and the data for each entry is converted to HTML (h, m, l, x, g,
+// t, y, k, w, and r are supported, and other types, including binary ones,
+// are ignored). Links to other entries (bword://) are converted into
+// cross-references if the target exists, and relative image paths are
+// resolved against the res directory.
+//
+// Synonyms which are the same as the word or another synonym (after trimming
+// whitespace) are removed. Entries with data which can't be parsed (e.g.
+// invalid Pango markup), and entries and synonyms which contain characters
+// which aren't allowed by dictgen, are skipped and returned as warnings.
+func (d *Dictionary) DictFile() (dictgen.DictFile, []error) {
+	words := map[string]bool{}
+	for _, e := range d.Entries {
+		words[strings.ToLower(strings.TrimSpace(e.Word))] = true
+		for _, s := range e.Synonyms {
+			words[strings.ToLower(strings.TrimSpace(s))] = true
+		}
+	}
+
+	var df dictgen.DictFile
+	var warnings []error
+	for _, e := range d.Entries {
+		dfe, err := d.convert(e, words, func(err error) {
+			warnings = append(warnings, fmt.Errorf("word %#v: %w", e.Word, err))
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping entry: %w", e.Word, err))
+			continue
+		}
+		df = append(df, dfe)
+	}
+	return df, warnings
+}
+
+func (d *Dictionary) convert(e *Entry, words map[string]bool, warn func(error)) (*dictgen.DictFileEntry, error) {
+	dfe := &dictgen.DictFileEntry{
+		Headword: strings.TrimSpace(e.Word),
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("word %w", err)
+	}
+
+	var syns []string
+	for _, s := range e.Synonyms {
+		syns = append(syns, strings.TrimSpace(s))
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, syns, "synonym", warn)
+
+	var info []string
+	var buf strings.Builder
+	for _, x := range e.Data {
+		s := strings.ReplaceAll(string(x.Data), "\r\n", "\n")
+		switch x.Type {
+		case 'h':
+			buf.WriteString(s)
+		case 'm', 'l', 'w':
+			buf.WriteString("<p>" + textHTML(s) + "</p>")
+		case 't', 'y':
+			info = append(info, "["+html.EscapeString(strings.TrimSpace(s))+"]")
+		case 'x':
+			h, err := xdxf.ArticleHTML(s, func(target string) bool {
+				return words[strings.ToLower(target)]
+			})
+			if err != nil {
+				return nil, fmt.Errorf("convert xdxf: %w", err)
+			}
+			buf.WriteString(h)
+		case 'g':
+			h, err := pangoHTML(s)
+			if err != nil {
+				return nil, fmt.Errorf("convert pango markup: %w", err)
+			}
+			buf.WriteString(h)
+		case 'k':
+			h, err := xmlTextHTML(s)
+			if err != nil {
+				return nil, fmt.Errorf("convert kingsoft xml: %w", err)
+			}
+			buf.WriteString("<p>" + h + "</p>")
+		case 'r':
+			for _, line := range strings.Split(s, "\n") {
+				if spl := strings.SplitN(strings.TrimSpace(line), ":", 2); len(spl) == 2 && spl[0] == "img" {
+					buf.WriteString(`<p><img src="` + html.EscapeString(spl[1]) + `"/></p>`)
+				}
+			}
+		}
+	}
+	dfe.HeaderInfo = strings.Join(info, " ")
+	dfe.Definition = dictgen.SanitizeHTML(importutil.ResolveImages(convertLinks(buf.String(), words), d.Res))
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+// textHTML converts plain text to HTML.
+func textHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(strings.TrimSpace(s)), "\n", "<br/>")
+}
+
+// linkRe matches bword:// links (which point to other entries in the
+// dictionary).
+var linkRe = regexp.MustCompile(`(?is)<a\s[^>]*href=["']bword://([^"']*)["'][^>]*>(.*?)</a>`)
+
+// convertLinks converts links to other entries into cross-references, or
+// removes them if the target doesn't exist.
+func convertLinks(s string, words map[string]bool) string {
+	return linkRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := linkRe.FindStringSubmatch(m)
+		target, label := html.UnescapeString(sm[1]), sm[2]
+		if t, err := url.PathUnescape(target); err == nil {
+			target = t
+		}
+		target = strings.TrimSpace(target)
+		if !words[strings.ToLower(target)] || strings.ContainsAny(target, "[]|\n") || strings.ContainsAny(label, "[]\n") {
+			return label
+		}
+		if strings.TrimSpace(label) == target {
+			return "[[" + target + "]]"
+		}
+		return "[[" + target + "|" + label + "]]"
+	})
+}
+
+// xmlTextHTML converts the text of XML markup to HTML, ignoring the tags.
+func xmlTextHTML(s string) (string, error) {
+	ts, err := importutil.XMLTokens(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, t := range ts {
+		if t, ok := t.(xml.CharData); ok {
+			b.Write(t)
+		}
+	}
+	return textHTML(b.String()), nil
+}
+
+// pangoHTML converts Pango markup to HTML.
+func pangoHTML(s string) (string, error) {
+	ts, err := importutil.XMLTokens(s)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	var end []string
+	for _, t := range ts {
+		switch t := t.(type) {
+		case xml.StartElement:
+			var open, close string
+			switch n := t.Name.Local; {
+			case n == "span" || n == "font":
+				var style []string
+				for _, a := range t.Attr {
+					switch v := html.EscapeString(a.Value); a.Name.Local {
+					case "foreground", "fgcolor", "color":
+						style = append(style, "color:"+v)
+					case "background", "bgcolor":
+						style = append(style, "background-color:"+v)
+					case "weight":
+						style = append(style, "font-weight:"+v)
+					case "style":
+						style = append(style, "font-style:"+v)
+					case "font_family", "face":
+						style = append(style, "font-family:"+v)
+					case "underline":
+						if v != "none" {
+							style = append(style, "text-decoration:underline")
+						}
+					case "strikethrough":
+						if v == "true" {
+							style = append(style, "text-decoration:line-through")
+						}
+					}
+				}
+				if len(style) != 0 {
+					open, close = `<span style="`+strings.Join(style, ";")+`">`, `</span>`
+				}
+			case importutil.HTMLTags[n]:
+				open, close = "<"+n+">", "</"+n+">"
+			}
+			b.WriteString(open)
+			end = append(end, close)
+		case xml.EndElement:
+			if len(end) != 0 {
+				b.WriteString(end[len(end)-1])
+				end = end[:len(end)-1]
+			}
+		case xml.CharData:
+			b.WriteString(strings.ReplaceAll(html.EscapeString(string(t)), "\n", "<br/>"))
+		}
+	}
+	return "<p>" + strings.TrimSuffix(b.String(), "<br/>") + "</p>", nil
+}
@@ -0,0 +1,328 @@
+// Package stardict reads StarDict dictionaries (.ifo, .idx, .dict, and .syn
+// files) and converts them into dictfiles.
+//
+// The idx can optionally be gzipped (.idx.gz), and the dict can optionally be
+// compressed with dictzip (.dict.dz). Both 32 and 64-bit index offsets are
+// supported.
+package stardict
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Info contains the information from the .ifo file.
+type Info struct {
+	Version          string // 2.4.2 or 3.0.0
+	BookName         string
+	WordCount        int
+	SynWordCount     int
+	IdxFileSize      int64
+	IdxOffsetBits    int // 32 or 64
+	Author           string
+	Email            string
+	Website          string
+	Description      string
+	Date             string
+	SameTypeSequence string
+	DictType         string
+}
+
+// Dictionary is a StarDict dictionary.
+type Dictionary struct {
+	Info
+	Entries []*Entry
+
+	// Res is the path to the res directory containing the resources used by
+	// the entries (e.g. images), or empty if it doesn't exist.
+	Res string
+}
+
+// Entry is a single word from the idx.
+type Entry struct {
+	Word     string
+	Synonyms []string // from the syn
+	Data     []Data
+}
+
+// Data is a single field of an entry's data.
+type Data struct {
+	// Type is the type of data (see the StarDict file format documentation).
+	// Lowercase types are text (e.g. m for plain text, h for HTML), and
+	// uppercase ones are binary (e.g. P for a picture).
+	Type byte
+	Data []byte
+}
+
+// ParseInfo parses an .ifo file.
+func ParseInfo(r io.Reader) (*Info, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	if !sc.Scan() || strings.TrimPrefix(strings.TrimSpace(sc.Text()), "\ufeff") != "StarDict's dict ifo file" {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("not a StarDict ifo file")
+	}
+
+	info := &Info{IdxOffsetBits: 32}
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		spl := strings.SplitN(line, "=", 2)
+		if len(spl) != 2 {
+			return nil, fmt.Errorf("invalid line %#v: expected key=value", line)
+		}
+		key, value := strings.TrimSpace(spl[0]), spl[1]
+
+		var err error
+		switch key {
+		case "version":
+			info.Version = value
+		case "bookname":
+			info.BookName = value
+		case "wordcount":
+			info.WordCount, err = strconv.Atoi(value)
+		case "synwordcount":
+			info.SynWordCount, err = strconv.Atoi(value)
+		case "idxfilesize":
+			info.IdxFileSize, err = strconv.ParseInt(value, 10, 64)
+		case "idxoffsetbits":
+			if info.IdxOffsetBits, err = strconv.Atoi(value); err == nil && info.IdxOffsetBits != 32 && info.IdxOffsetBits != 64 {
+				err = errors.New("must be 32 or 64")
+			}
+		case "author":
+			info.Author = value
+		case "email":
+			info.Email = value
+		case "website":
+			info.Website = value
+		case "description":
+			info.Description = value
+		case "date":
+			info.Date = value
+		case "sametypesequence":
+			info.SameTypeSequence = value
+		case "dicttype":
+			info.DictType = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %#v for %s: %w", value, key, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if info.BookName == "" {
+		return nil, errors.New("missing bookname")
+	}
+	return info, nil
+}
+
+// Open reads a StarDict dictionary from the path to its ifo file. The other
+// files must be in the same directory with the same name.
+func Open(ifo string) (*Dictionary, error) {
+	base := strings.TrimSuffix(ifo, ".ifo")
+
+	f, err := os.Open(ifo)
+	if err != nil {
+		return nil, fmt.Errorf("read ifo: %w", err)
+	}
+	info, err := ParseInfo(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read ifo: %w", err)
+	}
+	d := &Dictionary{Info: *info}
+
+	idx, err := readFile(base+".idx", base+".idx.gz")
+	if err != nil {
+		return nil, fmt.Errorf("read idx: %w", err)
+	} else if idx == nil {
+		return nil, errors.New("read idx: not found")
+	}
+
+	dict, err := readFile(base+".dict", base+".dict.dz")
+	if err != nil {
+		return nil, fmt.Errorf("read dict: %w", err)
+	} else if dict == nil {
+		return nil, errors.New("read dict: not found")
+	}
+
+	if d.Entries, err = parseIdx(idx, dict, d.IdxOffsetBits, d.SameTypeSequence); err != nil {
+		return nil, fmt.Errorf("read idx: %w", err)
+	}
+
+	syn, err := readFile(base+".syn", base+".syn.dz")
+	if err != nil {
+		return nil, fmt.Errorf("read syn: %w", err)
+	} else if syn != nil {
+		if err := parseSyn(syn, d.Entries); err != nil {
+			return nil, fmt.Errorf("read syn: %w", err)
+		}
+	}
+
+	if res := filepath.Join(filepath.Dir(ifo), "res"); isDir(res) {
+		d.Res = res
+	}
+
+	return d, nil
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+// readFile reads the first file which exists, decompressing it if it is
+// gzipped (or dictzipped, which is compatible). If none exist, nil is
+// returned.
+func readFile(names ...string) ([]byte, error) {
+	for _, name := range names {
+		buf, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".dz") {
+			zr, err := gzip.NewReader(bytes.NewReader(buf))
+			if err != nil {
+				return nil, fmt.Errorf("decompress %s: %w", name, err)
+			}
+			if buf, err = ioutil.ReadAll(zr); err != nil {
+				return nil, fmt.Errorf("decompress %s: %w", name, err)
+			}
+		}
+		if buf == nil {
+			buf = []byte{}
+		}
+		return buf, nil
+	}
+	return nil, nil
+}
+
+// parseIdx parses the index and reads the data for each entry from dict.
+func parseIdx(idx, dict []byte, offsetBits int, sts string) ([]*Entry, error) {
+	var es []*Entry
+	for len(idx) != 0 {
+		i := bytes.IndexByte(idx, 0)
+		if i == -1 {
+			return nil, fmt.Errorf("entry %d: missing null terminator", len(es))
+		}
+		word := string(idx[:i])
+		idx = idx[i+1:]
+
+		var off, sz uint64
+		if offsetBits == 64 {
+			if len(idx) < 12 {
+				return nil, fmt.Errorf("word %#v: unexpected end of file", word)
+			}
+			off, sz = binary.BigEndian.Uint64(idx), uint64(binary.BigEndian.Uint32(idx[8:]))
+			idx = idx[12:]
+		} else {
+			if len(idx) < 8 {
+				return nil, fmt.Errorf("word %#v: unexpected end of file", word)
+			}
+			off, sz = uint64(binary.BigEndian.Uint32(idx)), uint64(binary.BigEndian.Uint32(idx[4:]))
+			idx = idx[8:]
+		}
+		if off+sz > uint64(len(dict)) {
+			return nil, fmt.Errorf("word %#v: data out of range of dict", word)
+		}
+
+		data, err := parseData(dict[off:off+sz], sts)
+		if err != nil {
+			return nil, fmt.Errorf("word %#v: %w", word, err)
+		}
+		es = append(es, &Entry{Word: word, Data: data})
+	}
+	return es, nil
+}
+
+// parseData parses the data for an entry. If sts (the sametypesequence) is
+// empty, each field is prefixed with its type.
+func parseData(buf []byte, sts string) ([]Data, error) {
+	var data []Data
+
+	// field reads the data for a field from buf, which is the last one if all
+	// is true (in which case it takes up the rest of the data)
+	field := func(t byte, all bool) error {
+		var b []byte
+		switch {
+		case all:
+			b, buf = buf, nil
+		case t >= 'a' && t <= 'z':
+			i := bytes.IndexByte(buf, 0)
+			if i == -1 {
+				return fmt.Errorf("field %c: missing null terminator", t)
+			}
+			b, buf = buf[:i], buf[i+1:]
+		case t >= 'A' && t <= 'Z':
+			if len(buf) < 4 {
+				return fmt.Errorf("field %c: unexpected end of data", t)
+			}
+			n := binary.BigEndian.Uint32(buf)
+			if uint64(n) > uint64(len(buf)-4) {
+				return fmt.Errorf("field %c: size out of range", t)
+			}
+			b, buf = buf[4:4+n], buf[4+n:]
+		default:
+			return fmt.Errorf("invalid field type %q", t)
+		}
+		data = append(data, Data{t, b})
+		return nil
+	}
+
+	if sts != "" {
+		for i := 0; i < len(sts); i++ {
+			if err := field(sts[i], i == len(sts)-1); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for len(buf) != 0 {
+			t := buf[0]
+			buf = buf[1:]
+			if err := field(t, false); err != nil {
+				// the null terminator is sometimes omitted for the last field
+				if t >= 'a' && t <= 'z' && bytes.IndexByte(buf, 0) == -1 {
+					data = append(data, Data{t, buf})
+					break
+				}
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// parseSyn parses the synonyms and adds them to the entries.
+func parseSyn(syn []byte, es []*Entry) error {
+	for len(syn) != 0 {
+		i := bytes.IndexByte(syn, 0)
+		if i == -1 || len(syn) < i+5 {
+			return errors.New("unexpected end of file")
+		}
+		word, n := string(syn[:i]), binary.BigEndian.Uint32(syn[i+1:])
+		if uint64(n) >= uint64(len(es)) {
+			return fmt.Errorf("synonym %#v: index %d out of range", word, n)
+		}
+		es[n].Synonyms = append(es[n].Synonyms, word)
+		syn = syn[i+5:]
+	}
+	return nil
+}
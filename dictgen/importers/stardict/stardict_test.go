@@ -0,0 +1,114 @@
+package stardict
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	df, err := dictgen.ParseDictFile(strings.NewReader("@ banana\n& Bananas\nA fruit, see [[apple|apples]].\n@ apple\n& apples\nA *fruit*.\n"))
+	if err != nil {
+		t.Fatalf("parse dictfile: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := df.WriteStarDict(dir, "test", new(dictgen.ImageHandlerRemove), dictgen.ImageFuncFilesystem, &dictgen.StarDictOptions{
+		BookName: "Test",
+		Author:   "Someone",
+	}); err != nil {
+		t.Fatalf("write stardict: %v", err)
+	}
+
+	d, err := Open(filepath.Join(dir, "test.ifo"))
+	if err != nil {
+		t.Fatalf("open stardict: %v", err)
+	}
+	if d.BookName != "Test" || d.WordCount != 2 || d.SynWordCount != 2 || d.SameTypeSequence != "h" {
+		t.Errorf("incorrect info %+v", d.Info)
+	}
+	if hdr := d.Header(); hdr.Title != "Test" || hdr.Author != "Someone" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+
+	act, warnings := d.DictFile()
+	importtest.CheckWarnings(t, "", warnings)
+	exp := dictgen.DictFile{
+		{Headword: "apple", Variant: []string{"apples"}, RawHTML: true, Definition: "<p><b>apple</b></p><p>A <em>fruit</em>.</p>"},
+		{Headword: "banana", Variant: []string{"Bananas"}, RawHTML: true, Definition: "<p><b>banana</b></p><p>A fruit, see [[apple|apples]].</p>"},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "res"), 0755); err != nil {
+		t.Fatalf("create res: %v", err)
+	}
+
+	var idx, dict bytes.Buffer
+	for _, e := range []struct {
+		word string
+		data string
+	}{
+		{"cat", "t/kæt/\x00m" + "A small\nanimal & pet.\x00"},
+		{"dog", "x<k>dog</k>\n<tr>dɒɡ</tr> <abr>n.</abr> an animal, see <kref>cat</kref> or <kref>wolf</kref>\n<ex>a good dog</ex>"}, // the last null terminator is sometimes omitted
+		{"mouse", "g<b>mouse</b> <span foreground=\"red\" weight=\"bold\">small</span>\x00r" + "img:mouse.png\nsnd:mouse.wav\x00"},
+		{" \t", "mBlank\x00"},
+		{"var", "h<html><a name=\"x\">X</a><var>v</var> <img src=\"v.png\"><wbr></html>\x00P\x00\x00\x00\x01x"},
+	} {
+		idx.WriteString(e.word + "\x00")
+		binary.Write(&idx, binary.BigEndian, uint32(dict.Len()))
+		binary.Write(&idx, binary.BigEndian, uint32(len(e.data)))
+		dict.WriteString(e.data)
+	}
+
+	var syn bytes.Buffer
+	for _, s := range []struct {
+		word  string
+		index uint32
+	}{{"cats", 0}, {"Cat", 0}, {" cat ", 0}, {" cats", 0}, {"doggie\"", 1}} {
+		syn.WriteString(s.word + "\x00")
+		binary.Write(&syn, binary.BigEndian, s.index)
+	}
+
+	for name, buf := range map[string][]byte{
+		"test.ifo":  []byte("StarDict's dict ifo file\nversion=2.4.2\nbookname=Test <b>Dict</b>\nwordcount=5\nsynwordcount=5\n"),
+		"test.idx":  idx.Bytes(),
+		"test.dict": dict.Bytes(),
+		"test.syn":  syn.Bytes(),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), buf, 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	d, err := Open(filepath.Join(dir, "test.ifo"))
+	if err != nil {
+		t.Fatalf("open stardict: %v", err)
+	}
+	if d.Header().Title != "Test Dict" {
+		t.Errorf("incorrect title %q", d.Header().Title)
+	}
+
+	act, warnings := d.DictFile()
+	importtest.CheckWarnings(t, "", warnings,
+		`word "dog": skipping synonym "doggie\"": contains illegal string`,
+		`word " \t": skipping entry: word must not be blank`,
+	)
+
+	res := filepath.Join(dir, "res")
+	exp := dictgen.DictFile{
+		{Headword: "cat", Variant: []string{"cats", "Cat"}, HeaderInfo: "[/kæt/]", RawHTML: true, Definition: "<p>A small<br/>animal &amp; pet.</p>"},
+		{Headword: "dog", RawHTML: true, Definition: `<span class="tr">[dɒɡ]</span> <i class="abr">n.</i> an animal, see [[cat]] or wolf<br/><i class="ex">a good dog</i>`},
+		{Headword: "mouse", RawHTML: true, Definition: `<p><b>mouse</b> <span style="color:red;font-weight:bold">small</span></p><p><img src="` + filepath.Join(res, "mouse.png") + `"/></p>`},
+		{Headword: "var", RawHTML: true, Definition: `<a id="x">X</a><i>v</i> <img src="` + filepath.Join(res, "v.png") + `">`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
@@ -0,0 +1,284 @@
+package tei
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+type teiEntry struct {
+	Forms   []teiForm    `xml:"form"`
+	GramGrp []teiGramGrp `xml:"gramGrp"`
+	Senses  []teiSense   `xml:"sense"`
+
+	// entries without senses
+	Cit   []teiCit   `xml:"cit"`
+	Trans []teiTrans `xml:"trans"`
+	Def   []teiText  `xml:"def"`
+	Note  []teiText  `xml:"note"`
+	Xr    []teiXr    `xml:"xr"`
+}
+
+type teiForm struct {
+	Orth    []teiText    `xml:"orth"`
+	Pron    []teiText    `xml:"pron"`
+	GramGrp []teiGramGrp `xml:"gramGrp"`
+	Forms   []teiForm    `xml:"form"`
+}
+
+type teiGramGrp struct {
+	Gram []struct {
+		teiText
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type teiSense struct {
+	GramGrp []teiGramGrp `xml:"gramGrp"`
+	Usg     []teiUsg     `xml:"usg"`
+	Cit     []teiCit     `xml:"cit"`
+	Trans   []teiTrans   `xml:"trans"` // P4
+	Def     []teiText    `xml:"def"`
+	Note    []teiText    `xml:"note"`
+	Xr      []teiXr      `xml:"xr"`
+	Senses  []teiSense   `xml:"sense"`
+}
+
+type teiUsg struct {
+	teiText
+	Type string `xml:"type,attr"`
+}
+
+type teiCit struct {
+	Type    string       `xml:"type,attr"`
+	Lang    string       `xml:"lang,attr"`
+	Quote   []teiText    `xml:"quote"`
+	GramGrp []teiGramGrp `xml:"gramGrp"`
+	Usg     []teiUsg     `xml:"usg"`
+	Cit     []teiCit     `xml:"cit"`
+}
+
+type teiTrans struct {
+	Tr []teiText `xml:"tr"`
+}
+
+type teiXr struct {
+	Type string    `xml:"type,attr"`
+	Ref  []teiText `xml:"ref"`
+}
+
+// orths returns the orthographic forms of the entry, in order.
+func (e *teiEntry) orths() []string {
+	var r []string
+	var walk func([]teiForm)
+	walk = func(fs []teiForm) {
+		for _, f := range fs {
+			r = append(r, texts(f.Orth)...)
+			walk(f.Forms)
+		}
+	}
+	walk(e.Forms)
+	return r
+}
+
+func (e *teiEntry) headword() string {
+	if o := e.orths(); len(o) != 0 {
+		return o[0]
+	}
+	return ""
+}
+
+// lang returns the language of the first translation.
+func (e *teiEntry) lang() string {
+	for _, sn := range e.allSenses() {
+		for _, c := range sn.Cit {
+			if isTrans(c.Type) && c.Lang != "" {
+				return c.Lang
+			}
+		}
+	}
+	return ""
+}
+
+// allSenses returns the senses, treating the entry itself as a sense if it
+// doesn't have any.
+func (e *teiEntry) allSenses() []teiSense {
+	if len(e.Senses) != 0 {
+		return e.Senses
+	}
+	if len(e.Cit) != 0 || len(e.Trans) != 0 || len(e.Def) != 0 || len(e.Note) != 0 || len(e.Xr) != 0 {
+		return []teiSense{{Cit: e.Cit, Trans: e.Trans, Def: e.Def, Note: e.Note, Xr: e.Xr}}
+	}
+	return nil
+}
+
+// convert converts the entry. The pronunciation and grammar are added to the
+// header info, the senses are added as an ordered list, and the other
+// orthographic forms are added as variants.
+func (e *teiEntry) convert(warn func(error)) (*dictgen.DictFileEntry, error) {
+	orths := e.orths()
+	if len(orths) == 0 {
+		return nil, errors.New("no headword")
+	}
+	dfe := &dictgen.DictFileEntry{
+		Headword: orths[0],
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("orth %w", err)
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, orths[1:], "orth", warn)
+
+	var info []string
+	var prons []string
+	gram := gramText(e.GramGrp)
+	for _, f := range e.Forms {
+		prons = append(prons, texts(f.Pron)...)
+		if gram == "" {
+			gram = gramText(f.GramGrp)
+		}
+	}
+	if len(prons) != 0 {
+		info = append(info, "["+html.EscapeString(strings.Join(prons, ", "))+"]")
+	}
+	if gram != "" {
+		info = append(info, "<i>"+html.EscapeString(gram)+"</i>")
+	}
+	dfe.HeaderInfo = strings.Join(info, " ")
+
+	var b strings.Builder
+	writeSenses(&b, e.allSenses())
+	dfe.Definition = b.String()
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+func writeSenses(b *strings.Builder, senses []teiSense) {
+	if len(senses) == 0 {
+		return
+	}
+	b.WriteString("<ol>")
+	for _, sn := range senses {
+		b.WriteString("<li>")
+		writeSense(b, sn)
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ol>")
+}
+
+func writeSense(b *strings.Builder, sn teiSense) {
+	var parts []string
+	if gram := gramText(sn.GramGrp); gram != "" {
+		parts = append(parts, "<i>"+html.EscapeString(gram)+"</i>")
+	}
+	if usg := usgText(sn.Usg); usg != "" {
+		parts = append(parts, `<span class="usg">(`+html.EscapeString(usg)+`)</span>`)
+	}
+
+	var trans []string
+	for _, c := range sn.Cit {
+		if isTrans(c.Type) {
+			trans = append(trans, citHTML(c))
+		}
+	}
+	for _, t := range sn.Trans {
+		for _, tr := range texts(t.Tr) {
+			trans = append(trans, html.EscapeString(tr))
+		}
+	}
+	if len(trans) != 0 {
+		parts = append(parts, strings.Join(trans, ", "))
+	}
+
+	for _, d := range texts(sn.Def) {
+		parts = append(parts, html.EscapeString(d))
+	}
+	for _, n := range texts(sn.Note) {
+		parts = append(parts, `<span class="note">(`+html.EscapeString(n)+`)</span>`)
+	}
+	b.WriteString(strings.Join(parts, " "))
+
+	for _, c := range sn.Cit {
+		if isTrans(c.Type) {
+			continue
+		}
+		q := strings.Join(texts(c.Quote), ", ")
+		if q == "" {
+			continue
+		}
+		b.WriteString(`<br/><i class="ex">` + html.EscapeString(q) + `</i>`)
+		var tr []string
+		for _, cc := range c.Cit {
+			if isTrans(cc.Type) {
+				tr = append(tr, citHTML(cc))
+			}
+		}
+		if len(tr) != 0 {
+			b.WriteString(" — " + strings.Join(tr, ", "))
+		}
+	}
+
+	for _, x := range sn.Xr {
+		if refs := texts(x.Ref); len(refs) != 0 {
+			label := "see"
+			switch x.Type {
+			case "syn":
+				label = "synonyms"
+			case "ant":
+				label = "antonyms"
+			}
+			b.WriteString(`<br/><span class="xr">` + label + ": " + html.EscapeString(strings.Join(refs, ", ")) + `</span>`)
+		}
+	}
+
+	writeSenses(b, sn.Senses)
+}
+
+// citHTML returns the quotes of a translation, followed by the grammar (e.g.
+// the gender) and usage if present.
+func citHTML(c teiCit) string {
+	s := html.EscapeString(strings.Join(texts(c.Quote), ", "))
+	if gram := gramText(c.GramGrp); gram != "" {
+		s += " <i>" + html.EscapeString(gram) + "</i>"
+	}
+	if usg := usgText(c.Usg); usg != "" {
+		s += ` <span class="usg">(` + html.EscapeString(usg) + `)</span>`
+	}
+	return s
+}
+
+func isTrans(typ string) bool {
+	return typ == "trans" || typ == "translation" || typ == "translationEquivalent"
+}
+
+// gramText returns the grammatical information (e.g. the part of speech and
+// gender) separated by commas.
+func gramText(gs []teiGramGrp) string {
+	var r []string
+	for _, g := range gs {
+		for _, x := range g.Gram {
+			if s := x.String(); s != "" {
+				r = append(r, s)
+			}
+		}
+	}
+	return strings.Join(r, ", ")
+}
+
+func usgText(us []teiUsg) string {
+	var r []string
+	for _, u := range us {
+		if s := u.String(); s != "" {
+			r = append(r, s)
+		}
+	}
+	return strings.Join(r, ", ")
+}
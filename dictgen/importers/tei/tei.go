@@ -0,0 +1,248 @@
+// Package tei reads bilingual dictionaries in TEI XML (e.g. the ones from
+// FreeDict) and converts them into dictfiles.
+//
+// The XML is streamed one entry at a time, so large dictionaries don't need to
+// fit in memory. Both TEI P5 (translations in <cit type="trans">) and the
+// older TEI P4 (translations in <trans><tr>) are supported.
+package tei
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Scanner reads the entries from a TEI dictionary one at a time, converting
+// them into dictfile entries.
+type Scanner struct {
+	d *xml.Decoder
+	c io.Closer
+
+	h        *dictgen.DictFileHeader
+	src, tgt string // languages (ISO 639-1 if possible)
+	fsrc     string // source language from the filename
+	ftgt     string // target language from the filename
+
+	cur      *dictgen.DictFileEntry
+	warnings []error
+	skipped  int
+	err      error
+}
+
+// NewScanner creates a new Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	d := xml.NewDecoder(r)
+	d.Strict = false // some dictionaries have HTML entities or other minor issues
+	d.Entity = xml.HTMLEntity
+	return &Scanner{d: d, h: new(dictgen.DictFileHeader)}
+}
+
+// Open opens a TEI file. If the name follows the FreeDict naming convention
+// (e.g. deu-eng.tei), the languages in it are used for the locale if they
+// aren't specified in the file itself.
+func Open(name string) (*Scanner, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := NewScanner(bufio.NewReader(f))
+	s.c = f
+	if m := freedictNameRe.FindStringSubmatch(filepath.Base(name)); m != nil {
+		s.fsrc, s.ftgt = importutil.NormalizeLanguage(m[1]), importutil.NormalizeLanguage(m[2])
+		s.updateLocale()
+	}
+	return s, nil
+}
+
+var freedictNameRe = regexp.MustCompile(`^([a-z]{2,3})-([a-z]{2,3})\b`)
+
+// Scan reads the next entry, which will be available through Entry. Entries
+// without an <orth>, or where the first one contains characters which aren't
+// allowed by dictgen, are skipped, and are returned by Warnings with the line
+// number of the <entry>. It returns false when there are no more entries or an
+// error occurs.
+func (s *Scanner) Scan() bool {
+	s.cur, s.warnings = nil, nil
+	if s.err != nil || s.d == nil {
+		return false
+	}
+	for {
+		tok, err := s.d.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.err = err
+			}
+			s.Close()
+			return false
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "TEI", "TEI.2", "text", "body":
+			if s.src == "" {
+				s.src = importutil.NormalizeLanguage(importutil.XMLAttr(se, "lang"))
+				s.updateLocale()
+			}
+		case "teiHeader":
+			var h teiHeader
+			if err := s.d.DecodeElement(&h, &se); err != nil {
+				s.err = fmt.Errorf("read header: %w", err)
+				s.Close()
+				return false
+			}
+			s.header(&h)
+		case "entry":
+			line, _ := s.d.InputPos()
+			var e teiEntry
+			if err := s.d.DecodeElement(&e, &se); err != nil {
+				s.err = fmt.Errorf("line %d: read entry: %w", line, err)
+				s.Close()
+				return false
+			}
+			if s.tgt == "" {
+				s.tgt = importutil.NormalizeLanguage(e.lang())
+				s.updateLocale()
+			}
+			dfe, err := e.convert(func(err error) {
+				s.warnings = append(s.warnings, fmt.Errorf("line %d: word %#v: %w", line, e.headword(), err))
+			})
+			if err != nil {
+				s.warnings = append(s.warnings, fmt.Errorf("line %d: word %#v: skipping entry: %w", line, e.headword(), err))
+				s.skipped++
+				continue
+			}
+			s.cur = dfe
+			return true
+		}
+	}
+}
+
+// Entry returns the entry read by the last call to Scan. It has been
+// validated.
+func (s *Scanner) Entry() *dictgen.DictFileEntry {
+	return s.cur
+}
+
+// Warnings returns the warnings for the entries and variants skipped during
+// the last call to Scan.
+func (s *Scanner) Warnings() []error {
+	return s.warnings
+}
+
+// Skipped returns the number of entries which have been skipped so far.
+func (s *Scanner) Skipped() int {
+	return s.skipped
+}
+
+// Header returns a dictfile header with the metadata from the TEI header. It
+// will be complete once the first entry has been read (or Scan returns false).
+// It will never be nil.
+func (s *Scanner) Header() *dictgen.DictFileHeader {
+	return s.h
+}
+
+// Err returns the first error encountered by Scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close closes the file opened by Open. It is not necessary to call it if Scan
+// returned false.
+func (s *Scanner) Close() error {
+	s.d = nil
+	if s.c != nil {
+		c := s.c
+		s.c = nil
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *Scanner) header(h *teiHeader) {
+	s.h.Title = first(h.Title)
+	if s.h.Author = strings.Join(texts(h.Author), ", "); s.h.Author == "" {
+		s.h.Author = strings.Join(texts(h.Resp), ", ")
+	}
+	s.h.Version = h.Edition.String()
+	for _, l := range h.Licence {
+		if s.h.License = l.String(); s.h.License == "" {
+			s.h.License = strings.TrimSpace(l.Target)
+		}
+		if s.h.License != "" {
+			break
+		}
+	}
+	if s.h.License == "" {
+		s.h.License = first(h.Availability)
+	}
+}
+
+func (s *Scanner) updateLocale() {
+	src, tgt := s.src, s.tgt
+	if src == "" {
+		src, tgt = s.fsrc, s.ftgt
+	} else if tgt == "" && src == s.fsrc {
+		tgt = s.ftgt
+	}
+	s.h.Locale = importutil.Locale(src, tgt)
+}
+
+// teiHeader contains the parts of the TEI header used for the dictfile header.
+type teiHeader struct {
+	Title        []teiText    `xml:"fileDesc>titleStmt>title"`
+	Author       []teiText    `xml:"fileDesc>titleStmt>author"`
+	Resp         []teiText    `xml:"fileDesc>titleStmt>respStmt>name"`
+	Edition      teiText      `xml:"fileDesc>editionStmt>edition"`
+	Licence      []teiLicence `xml:"fileDesc>publicationStmt>availability>licence"`
+	Availability []teiText    `xml:"fileDesc>publicationStmt>availability>p"`
+}
+
+type teiLicence struct {
+	teiText
+	Target string `xml:"target,attr"`
+}
+
+// teiText is the text content of an element, with any markup removed.
+type teiText struct {
+	Inner string `xml:",innerxml"`
+}
+
+var teiTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// String returns the text, with the whitespace collapsed.
+func (t teiText) String() string {
+	s := t.Inner
+	if strings.Contains(s, "<![CDATA[") {
+		s = strings.NewReplacer("<![CDATA[", "", "]]>", "").Replace(s)
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(teiTagRe.ReplaceAllString(s, ""))), " ")
+}
+
+func texts(ts []teiText) []string {
+	var r []string
+	for _, t := range ts {
+		if s := t.String(); s != "" {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func first(ts []teiText) string {
+	if r := texts(ts); len(r) != 0 {
+		return r[0]
+	}
+	return ""
+}
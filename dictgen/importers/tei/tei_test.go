@@ -0,0 +1,112 @@
+package tei
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+const testTEI = `<?xml version="1.0" encoding="UTF-8"?>
+<TEI xmlns="http://www.tei-c.org/ns/1.0">
+  <teiHeader>
+    <fileDesc>
+      <titleStmt>
+        <title>German-English FreeDict Dictionary</title>
+        <respStmt><resp>Maintainer</resp><name>Someone</name></respStmt>
+      </titleStmt>
+      <editionStmt><edition>0.3.5</edition></editionStmt>
+      <publicationStmt>
+        <availability status="free"><licence target="https://www.gnu.org/licenses/gpl-3.0.html"><p>GNU GPL 3</p></licence></availability>
+      </publicationStmt>
+    </fileDesc>
+  </teiHeader>
+  <text>
+    <body>
+      <entry>
+        <form><orth>Haus</orth><pron>haʊs</pron></form>
+        <form type="variant"><orth>Hauß</orth></form>
+        <gramGrp><pos>n</pos><gen>neut</gen></gramGrp>
+        <sense>
+          <usg type="dom">arch.</usg>
+          <cit type="trans" xml:lang="en"><quote>house</quote></cit>
+          <cit type="trans" xml:lang="en"><quote>home</quote><usg type="reg">fig.</usg></cit>
+          <cit type="example"><quote>ein großes Haus</quote><cit type="trans"><quote>a big house</quote></cit></cit>
+        </sense>
+        <sense>
+          <def>a &amp; b</def>
+          <note>rare</note>
+          <xr type="syn"><ref target="#x">Gebäude</ref></xr>
+        </sense>
+      </entry>
+      <entry>
+        <form><pron>haʊs</pron></form>
+        <sense><cit type="trans"><quote>no orth</quote></cit></sense>
+      </entry>
+      <entry>
+        <form><orth>gehen</orth><form type="infl"><orth>ging</orth><orth>gehen</orth></form><form type="infl"><orth>ging</orth></form></form>
+        <trans><tr>go</tr><tr>walk</tr></trans>
+      </entry>
+    </body>
+  </text>
+</TEI>
+`
+
+func TestScanner(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "deu-eng.tei")
+	if err := os.WriteFile(fn, []byte(testTEI), 0644); err != nil {
+		t.Fatalf("write tei: %v", err)
+	}
+
+	s, err := Open(fn)
+	if err != nil {
+		t.Fatalf("open tei: %v", err)
+	}
+	defer s.Close()
+
+	var act dictgen.DictFile
+	var warnings []error
+	for s.Scan() {
+		act = append(act, s.Entry())
+		warnings = append(warnings, s.Warnings()...)
+	}
+	warnings = append(warnings, s.Warnings()...)
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan tei: %v", err)
+	}
+
+	if hdr := *s.Header(); !reflect.DeepEqual(hdr, dictgen.DictFileHeader{
+		Title:   "German-English FreeDict Dictionary",
+		Locale:  "de-en",
+		Author:  "Someone",
+		License: "GNU GPL 3",
+		Version: "0.3.5",
+	}) {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+
+	importtest.CheckWarnings(t, "", warnings, `line 33: word "": skipping entry: no headword`)
+
+	exp := dictgen.DictFile{
+		{Headword: "Haus", Variant: []string{"Hauß"}, HeaderInfo: "[haʊs] <i>n, neut</i>", RawHTML: true, Definition: `<ol>` +
+			`<li><span class="usg">(arch.)</span> house, home <span class="usg">(fig.)</span><br/><i class="ex">ein großes Haus</i> — a big house</li>` +
+			`<li>a &amp; b <span class="note">(rare)</span><br/><span class="xr">synonyms: Gebäude</span></li>` +
+			`</ol>`},
+		{Headword: "gehen", Variant: []string{"ging"}, RawHTML: true, Definition: `<ol><li>go, walk</li></ol>`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
+
+func TestLocale(t *testing.T) {
+	s := NewScanner(strings.NewReader(`<TEI xml:lang="fra"><text><body><entry><form><orth>chat</orth></form><sense><cit type="trans" xml:lang="deu"><quote>Katze</quote></cit></sense></entry></body></text></TEI>`))
+	if !s.Scan() {
+		t.Fatalf("expected an entry, got error %v", s.Err())
+	}
+	if l := s.Header().Locale; l != "fr-de" {
+		t.Errorf("expected locale fr-de, got %q", l)
+	}
+}
@@ -0,0 +1,182 @@
+package wiktextract
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+type wiktEntry struct {
+	Word          string      `json:"word"`
+	Lang          string      `json:"lang"`
+	LangCode      string      `json:"lang_code"`
+	POS           string      `json:"pos"`
+	Sounds        []wiktSound `json:"sounds"`
+	Senses        []wiktSense `json:"senses"`
+	Forms         []wiktForm  `json:"forms"`
+	EtymologyText string      `json:"etymology_text"`
+}
+
+type wiktSound struct {
+	IPA string `json:"ipa"`
+}
+
+type wiktSense struct {
+	Glosses    []string      `json:"glosses"`
+	RawGlosses []string      `json:"raw_glosses"` // with the qualifiers, e.g. (transitive)
+	Tags       []string      `json:"tags"`
+	Examples   []wiktExample `json:"examples"`
+}
+
+type wiktExample struct {
+	Text        string `json:"text"`
+	English     string `json:"english"`
+	Translation string `json:"translation"`
+	Type        string `json:"type"` // example or quotation
+	Ref         string `json:"ref"`  // the source of a quotation
+}
+
+type wiktForm struct {
+	Form string   `json:"form"`
+	Tags []string `json:"tags"`
+}
+
+// partsOfSpeech contains the full names of the abbreviated parts of speech.
+var partsOfSpeech = map[string]string{
+	"adj":    "adjective",
+	"adv":    "adverb",
+	"conj":   "conjunction",
+	"det":    "determiner",
+	"intj":   "interjection",
+	"name":   "proper noun",
+	"num":    "numeral",
+	"prep":   "preposition",
+	"pron":   "pronoun",
+	"abbrev": "abbreviation",
+}
+
+// metaFormTags are the tags of forms which contain information about the
+// inflection table rather than actual forms.
+var metaFormTags = map[string]bool{
+	"table-tags":          true,
+	"inflection-template": true,
+	"class":               true,
+}
+
+// convert converts the entry. The IPA and part of speech are added to the
+// header info, the senses are added as an ordered list followed by the
+// etymology, and the forms (including the ones from the inflection tables)
+// are added as variants. If there aren't any senses left after filtering, it
+// returns nil.
+func (e *wiktEntry) convert(opt *Options, warn func(error)) (*dictgen.DictFileEntry, error) {
+	var senses []wiktSense
+	for _, sn := range e.Senses {
+		if len(sn.Glosses) == 0 && len(sn.RawGlosses) == 0 {
+			continue
+		}
+		if (opt.DropArchaic && hasTag(sn.Tags, "archaic")) || (opt.DropObsolete && hasTag(sn.Tags, "obsolete")) {
+			continue
+		}
+		senses = append(senses, sn)
+	}
+	if len(senses) == 0 {
+		return nil, nil
+	}
+
+	dfe := &dictgen.DictFileEntry{
+		Headword: strings.TrimSpace(e.Word),
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("word %w", err)
+	}
+
+	var forms []string
+	for _, f := range e.Forms {
+		if v := strings.TrimSpace(f.Form); v != "-" && !hasMetaTag(f.Tags) {
+			forms = append(forms, v) // - is used for missing forms in the tables
+		}
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, forms, "form", warn)
+
+	var info []string
+	for _, s := range e.Sounds {
+		if s.IPA != "" {
+			info = append(info, html.EscapeString(s.IPA))
+			break
+		}
+	}
+	if pos := e.POS; pos != "" {
+		if p, ok := partsOfSpeech[pos]; ok {
+			pos = p
+		}
+		info = append(info, "<i>"+html.EscapeString(pos)+"</i>")
+	}
+	dfe.HeaderInfo = strings.Join(info, " ")
+
+	var b strings.Builder
+	b.WriteString("<ol>")
+	for _, sn := range senses {
+		b.WriteString("<li>")
+		writeSense(&b, sn)
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ol>")
+	if et := strings.TrimSpace(e.EtymologyText); et != "" {
+		b.WriteString(`<p class="etym"><b>Etymology:</b> ` + strings.ReplaceAll(html.EscapeString(et), "\n", "<br/>") + `</p>`)
+	}
+	dfe.Definition = b.String()
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+// writeSense writes the gloss and examples of a sense. Since the glosses of
+// sub-senses start with the ones of the parent sense (which is also included
+// separately), only the last one is used. Quotations are not included since
+// there are often many of them.
+func writeSense(b *strings.Builder, sn wiktSense) {
+	gs := sn.RawGlosses
+	if len(gs) == 0 {
+		gs = sn.Glosses
+	}
+	b.WriteString(html.EscapeString(strings.TrimSpace(gs[len(gs)-1])))
+
+	for _, ex := range sn.Examples {
+		t := strings.TrimSpace(ex.Text)
+		if t == "" || ex.Type == "quotation" || ex.Ref != "" {
+			continue
+		}
+		b.WriteString(`<br/><i class="ex">` + html.EscapeString(t) + `</i>`)
+		tr := ex.Translation
+		if tr == "" {
+			tr = ex.English
+		}
+		if tr = strings.TrimSpace(tr); tr != "" {
+			b.WriteString(" — " + html.EscapeString(tr))
+		}
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMetaTag(tags []string) bool {
+	for _, t := range tags {
+		if metaFormTags[t] {
+			return true
+		}
+	}
+	return false
+}
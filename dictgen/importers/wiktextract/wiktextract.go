@@ -0,0 +1,196 @@
+// Package wiktextract reads Wiktionary dumps extracted by wiktextract (in the
+// JSON Lines format, with one word and part of speech per line) and converts
+// them into dictfiles.
+//
+// The dump is streamed one line at a time, so the full dumps (which are
+// several gigabytes) don't need to fit in memory. Gzip-compressed dumps are
+// also supported.
+package wiktextract
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+)
+
+// Options contains options for converting entries. A nil or zero value
+// converts all entries and senses.
+type Options struct {
+	// Lang only converts the entries for a language, matched against the
+	// language code (e.g. en) or the language name (e.g. English,
+	// case-insensitive).
+	Lang string
+
+	// DropArchaic drops senses tagged as archaic.
+	DropArchaic bool
+
+	// DropObsolete drops senses tagged as obsolete.
+	DropObsolete bool
+}
+
+// Scanner reads the entries from a wiktextract dump one at a time, converting
+// them into dictfile entries.
+type Scanner struct {
+	r   *bufio.Reader
+	c   []io.Closer
+	opt Options
+
+	h    *dictgen.DictFileHeader
+	line int
+
+	cur      *dictgen.DictFileEntry
+	warnings []error
+	skipped  int
+	err      error
+}
+
+// NewScanner creates a new Scanner reading from r.
+func NewScanner(r io.Reader, opt *Options) *Scanner {
+	s := &Scanner{
+		r: bufio.NewReaderSize(r, 1<<16),
+		h: &dictgen.DictFileHeader{
+			Title:   "Wiktionary",
+			Author:  "Wiktionary contributors",
+			License: "CC BY-SA 4.0 and GFDL",
+		},
+	}
+	if opt != nil {
+		s.opt = *opt
+	}
+	return s
+}
+
+// Open opens a wiktextract dump (e.g. kaikki.org-dictionary-English.jsonl). If
+// the name ends with .gz, it is decompressed.
+func Open(name string, opt *Options) (*Scanner, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	cs := []io.Closer{f}
+	if strings.HasSuffix(strings.ToLower(name), ".gz") {
+		zr, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("decompress: %w", err)
+		}
+		r = zr
+		cs = append([]io.Closer{zr}, cs...)
+	}
+	s := NewScanner(r, opt)
+	s.c = cs
+	return s, nil
+}
+
+// Scan reads the next entry, which will be available through Entry. Entries
+// for other languages, redirects, and entries without any senses left after
+// filtering are ignored. Lines which aren't valid JSON (e.g. if the dump was
+// truncated) and words which contain characters which aren't allowed by
+// dictgen are skipped, and are returned by Warnings with the line number. It
+// returns false when there are no more entries or an error occurs.
+func (s *Scanner) Scan() bool {
+	s.cur, s.warnings = nil, nil
+	if s.err != nil || s.r == nil {
+		return false
+	}
+	for {
+		buf, err := s.r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			s.err = err
+			s.Close()
+			return false
+		}
+		if len(buf) == 0 && err != nil {
+			s.Close()
+			return false
+		}
+		s.line++
+
+		if buf = bytes.TrimSpace(buf); len(buf) == 0 {
+			continue
+		}
+
+		var e wiktEntry
+		if err := json.Unmarshal(buf, &e); err != nil {
+			s.warnings = append(s.warnings, fmt.Errorf("line %d: skipping entry: %w", s.line, err))
+			s.skipped++
+			continue
+		}
+		if e.Word == "" || !s.match(&e) {
+			continue // other languages and redirects
+		}
+		if s.h.Locale == "" {
+			s.h.Title = "Wiktionary (" + e.Lang + ")"
+			s.h.Locale = e.LangCode
+		}
+
+		dfe, err := e.convert(&s.opt, func(err error) {
+			s.warnings = append(s.warnings, fmt.Errorf("line %d: word %#v: %w", s.line, e.Word, err))
+		})
+		if err != nil {
+			s.warnings = append(s.warnings, fmt.Errorf("line %d: word %#v: skipping entry: %w", s.line, e.Word, err))
+			s.skipped++
+			continue
+		}
+		if dfe == nil {
+			continue // all senses were dropped
+		}
+		s.cur = dfe
+		return true
+	}
+}
+
+func (s *Scanner) match(e *wiktEntry) bool {
+	return s.opt.Lang == "" || e.LangCode == s.opt.Lang || strings.EqualFold(e.Lang, s.opt.Lang)
+}
+
+// Entry returns the entry read by the last call to Scan. It has been
+// validated.
+func (s *Scanner) Entry() *dictgen.DictFileEntry {
+	return s.cur
+}
+
+// Warnings returns the warnings for the entries and variants skipped during
+// the last call to Scan.
+func (s *Scanner) Warnings() []error {
+	return s.warnings
+}
+
+// Skipped returns the number of entries which have been skipped so far.
+func (s *Scanner) Skipped() int {
+	return s.skipped
+}
+
+// Header returns a dictfile header for the dump. The title and locale are set
+// from the language of the first entry read. It will never be nil.
+func (s *Scanner) Header() *dictgen.DictFileHeader {
+	return s.h
+}
+
+// Err returns the first error encountered by Scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close closes the file opened by Open. It is not necessary to call it if Scan
+// returned false.
+func (s *Scanner) Close() error {
+	s.r = nil
+	var err error
+	for _, c := range s.c {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.c = nil
+	return err
+}
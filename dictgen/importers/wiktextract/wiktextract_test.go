@@ -0,0 +1,71 @@
+package wiktextract
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+const testDump = `{"word": "dog", "lang": "English", "lang_code": "en", "pos": "noun", "sounds": [{"enpr": "dôg"}, {"ipa": "/dɒɡ/", "tags": ["Received-Pronunciation"]}, {"ipa": "/dɔɡ/"}], "forms": [{"form": "dogs", "tags": ["plural"]}, {"form": "dog", "tags": ["singular"]}], "etymology_text": "From Middle English dogge.\nOf uncertain origin.", "senses": [{"glosses": ["A mammal."], "raw_glosses": ["(countable) A mammal."], "examples": [{"text": "The dog barked."}, {"text": "It was a dark night.", "ref": "1900, Someone", "type": "quotation"}]}, {"glosses": ["A man."], "tags": ["archaic"]}, {"glosses": ["A contemptible person.", "A fellow & friend."], "tags": ["obsolete"]}]}
+{"word": "Hund", "lang": "German", "lang_code": "de", "pos": "noun", "senses": [{"glosses": ["dog"], "examples": [{"text": "Der Hund bellt.", "english": "The dog barks."}]}]}
+{"word": "dog", "lang": "English", "lang_code": "en", "pos": "verb", "forms": [{"form": "en-conj", "tags": ["inflection-template"]}, {"form": "dogs", "tags": ["present", "singular", "third-person"]}, {"form": "dogged", "tags": ["past"]}, {"form": "-", "tags": ["participle"]}], "senses": [{"glosses": ["To follow."], "tags": ["archaic"]}, {"glosses": ["To pursue."]}]}
+{"word": "cur", "lang": "English", "lang_code": "en", "pos": "noun", "senses": [{"glosses": ["A dog."], "tags": ["obsolete"]}]}
+{"title": "Dogs", "redirect": "dog"}
+not json
+{"word": " ", "lang": "English", "lang_code": "en", "pos": "phrase", "senses": [{"glosses": ["Blank."]}]}
+{"word": "adj", "lang": "English", "lang_code": "en", "pos": "adj", "senses": [{"glosses": ["An adjective."]}]}`
+
+func TestScanner(t *testing.T) {
+	for _, tc := range []struct {
+		opt      *Options
+		exp      dictgen.DictFile
+		warnings []string
+		skipped  int
+		locale   string
+	}{
+		{
+			opt: &Options{Lang: "English", DropArchaic: true, DropObsolete: true},
+			exp: dictgen.DictFile{
+				{Headword: "dog", Variant: []string{"dogs"}, HeaderInfo: "/dɒɡ/ <i>noun</i>", RawHTML: true, Definition: `<ol><li>(countable) A mammal.<br/><i class="ex">The dog barked.</i></li></ol><p class="etym"><b>Etymology:</b> From Middle English dogge.<br/>Of uncertain origin.</p>`},
+				{Headword: "dog", Variant: []string{"dogs", "dogged"}, HeaderInfo: "<i>verb</i>", RawHTML: true, Definition: `<ol><li>To pursue.</li></ol>`},
+				{Headword: "adj", HeaderInfo: "<i>adjective</i>", RawHTML: true, Definition: `<ol><li>An adjective.</li></ol>`},
+			},
+			warnings: []string{`line 6: skipping entry`, `line 7: word " ": skipping entry: word must not be blank`},
+			skipped:  2,
+			locale:   "en",
+		},
+		{
+			opt: &Options{Lang: "de"},
+			exp: dictgen.DictFile{
+				{Headword: "Hund", HeaderInfo: "<i>noun</i>", RawHTML: true, Definition: `<ol><li>dog<br/><i class="ex">Der Hund bellt.</i> — The dog barks.</li></ol>`},
+			},
+			warnings: []string{`line 6: skipping entry`},
+			skipped:  1,
+			locale:   "de",
+		},
+	} {
+		s := NewScanner(strings.NewReader(testDump), tc.opt)
+
+		var act dictgen.DictFile
+		var warnings []error
+		for s.Scan() {
+			act = append(act, s.Entry())
+			warnings = append(warnings, s.Warnings()...)
+		}
+		warnings = append(warnings, s.Warnings()...)
+		if err := s.Err(); err != nil {
+			t.Fatalf("%s: scan: %v", tc.opt.Lang, err)
+		}
+
+		importtest.CheckWarnings(t, tc.opt.Lang, warnings, tc.warnings...)
+		if s.Skipped() != tc.skipped {
+			t.Errorf("%s: expected %d skipped, got %d", tc.opt.Lang, tc.skipped, s.Skipped())
+		}
+		if hdr := s.Header(); hdr.Locale != tc.locale {
+			t.Errorf("%s: incorrect header %+v", tc.opt.Lang, hdr)
+		}
+		importtest.CheckDictFile(t, tc.opt.Lang, tc.exp, act)
+	}
+}
@@ -0,0 +1,243 @@
+package wordnet
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Header returns a dictfile header for the database.
+func (db *Database) Header() *dictgen.DictFileHeader {
+	return &dictgen.DictFileHeader{
+		Title:   "WordNet",
+		Author:  "Princeton University",
+		Version: db.Version,
+		License: "WordNet License (https://wordnet.princeton.edu/license-and-commercial-use)",
+		Locale:  "en",
+	}
+}
+
+// lemma is a lemma with its synsets for each part of speech.
+type lemma struct {
+	key      string // from the index
+	headword string
+	synsets  map[POS][]SynsetID
+}
+
+// DictFile converts the database into a DictFile with an entry for each lemma.
+// The synsets are grouped by part of speech (in order of frequency), each with
+// the gloss, examples, synonyms, antonyms, and hypernyms. The synonyms,
+// antonyms, and hypernyms are cross-references. The irregular inflected forms
+// from the exception lists are added as variants.
+//
+// Lemmas which contain characters which aren't allowed by dictgen are skipped
+// and returned as warnings, and references to them are left as plain text.
+// Index entries pointing to missing synsets are also returned as warnings, and
+// lemmas without any other synsets are skipped.
+func (db *Database) DictFile() (dictgen.DictFile, []error) {
+	var warnings []error
+
+	lemmas := map[string]*lemma{}
+	for _, pos := range POSes {
+		for _, ie := range db.Index[pos] {
+			l, ok := lemmas[ie.Lemma]
+			if !ok {
+				l = &lemma{key: ie.Lemma, synsets: map[POS][]SynsetID{}}
+				lemmas[ie.Lemma] = l
+			}
+			l.synsets[pos] = append(l.synsets[pos], ie.Synsets...)
+		}
+	}
+
+	all := make([]string, 0, len(lemmas))
+	for key := range lemmas {
+		all = append(all, key)
+	}
+	sort.Strings(all)
+
+	keys := make([]string, 0, len(all))
+	words := map[string]bool{} // the valid headwords, for cross-references
+	for _, key := range all {
+		l := lemmas[key]
+		l.headword = db.headword(l)
+		if err := dictgen.ValidateWord(l.headword); err != nil {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping entry: lemma %w", l.headword, err))
+			continue
+		}
+		var n int
+		for _, pos := range POSes {
+			ids := l.synsets[pos][:0]
+			for _, id := range l.synsets[pos] {
+				if _, ok := db.Synsets[id]; ok {
+					ids = append(ids, id)
+				} else {
+					warnings = append(warnings, fmt.Errorf("word %#v: missing %s synset %d", l.headword, pos, id.Offset))
+				}
+			}
+			l.synsets[pos] = ids
+			n += len(ids)
+		}
+		if n == 0 {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping entry: no synsets", l.headword))
+			continue
+		}
+		keys = append(keys, key)
+		words[strings.ToLower(l.headword)] = true
+	}
+
+	var df dictgen.DictFile
+	for _, key := range keys {
+		l := lemmas[key]
+		dfe := &dictgen.DictFileEntry{
+			Headword: l.headword,
+			RawHTML:  true,
+		}
+
+		var forms []string
+		for _, pos := range POSes {
+			for _, v := range db.Exceptions[pos][key] {
+				forms = append(forms, word(v))
+			}
+		}
+		dfe.Variant = importutil.Variants(dfe.Headword, forms, "inflected form", func(err error) {
+			warnings = append(warnings, fmt.Errorf("word %#v: %w", l.headword, err))
+		})
+
+		var b strings.Builder
+		for _, pos := range POSes {
+			if len(l.synsets[pos]) == 0 {
+				continue
+			}
+			b.WriteString(`<p class="pos"><i>` + pos.String() + `</i></p><ol>`)
+			for _, id := range l.synsets[pos] {
+				b.WriteString("<li>")
+				db.writeSynset(&b, db.Synsets[id], key, words)
+				b.WriteString("</li>")
+			}
+			b.WriteString("</ol>")
+		}
+		dfe.Definition = b.String()
+
+		if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping entry: %w", l.headword, err))
+			continue
+		}
+		df = append(df, dfe)
+	}
+	return df, warnings
+}
+
+// headword returns the headword for a lemma, using the capitalization from
+// the synsets (e.g. Paris instead of paris).
+func (db *Database) headword(l *lemma) string {
+	for _, pos := range POSes {
+		for _, id := range l.synsets[pos] {
+			if ss, ok := db.Synsets[id]; ok {
+				for _, w := range ss.Words {
+					if strings.EqualFold(w, l.key) {
+						return word(w)
+					}
+				}
+			}
+		}
+	}
+	return word(l.key)
+}
+
+var exampleRe = regexp.MustCompile(`"([^"]*)"`)
+
+// writeSynset writes the gloss, examples, and relations of a synset for the
+// lemma key.
+func (db *Database) writeSynset(b *strings.Builder, ss *Synset, key string, words map[string]bool) {
+	defn, examples := ss.Gloss, ""
+	if i := strings.IndexByte(ss.Gloss, '"'); i != -1 {
+		defn, examples = ss.Gloss[:i], ss.Gloss[i:]
+	}
+	b.WriteString(html.EscapeString(strings.TrimRight(strings.TrimSpace(defn), ";")))
+	for _, m := range exampleRe.FindAllStringSubmatch(examples, -1) {
+		if ex := strings.TrimSpace(m[1]); ex != "" {
+			b.WriteString(`<br/><i class="ex">` + html.EscapeString(ex) + `</i>`)
+		}
+	}
+
+	ref := func(w string) string {
+		w = word(w)
+		if words[strings.ToLower(w)] && !strings.ContainsAny(w, "[]|<>&") {
+			return "[[" + w + "]]"
+		}
+		return html.EscapeString(w)
+	}
+
+	var src int // the index of the lemma in the synset (1-indexed)
+	var syns []string
+	for i, w := range ss.Words {
+		if strings.EqualFold(w, key) {
+			if src == 0 {
+				src = i + 1
+			}
+		} else {
+			syns = append(syns, ref(w))
+		}
+	}
+
+	var ants, hypers []string
+	for _, p := range ss.Pointers {
+		if p.Source != 0 && p.Source != src {
+			continue // a lexical relation for another word
+		}
+		t, ok := db.Synsets[p.Target]
+		if !ok {
+			continue
+		}
+		switch p.Symbol {
+		case "!":
+			if p.Word != 0 && p.Word <= len(t.Words) {
+				ants = append(ants, ref(t.Words[p.Word-1]))
+			} else {
+				for _, w := range t.Words {
+					ants = append(ants, ref(w))
+				}
+			}
+		case "@", "@i":
+			for _, w := range t.Words {
+				hypers = append(hypers, ref(w))
+			}
+		}
+	}
+
+	for _, r := range []struct {
+		class, label string
+		words        []string
+	}{
+		{"syn", "Synonyms", syns},
+		{"ant", "Antonyms", ants},
+		{"hyper", "Hypernyms", hypers},
+	} {
+		if len(r.words) != 0 {
+			b.WriteString(`<br/><span class="` + r.class + `">` + r.label + ": " + strings.Join(dedupe(r.words), ", ") + `</span>`)
+		}
+	}
+}
+
+// word converts a word from the database into the text form (i.e. underscores
+// are replaced with spaces).
+func word(w string) string {
+	return strings.ReplaceAll(w, "_", " ")
+}
+
+func dedupe(ss []string) []string {
+	var r []string
+	seen := map[string]bool{}
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			r = append(r, s)
+		}
+	}
+	return r
+}
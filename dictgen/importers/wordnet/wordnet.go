@@ -0,0 +1,305 @@
+// Package wordnet reads the Princeton WordNet database files and converts them
+// into a thesaurus-style dictfile.
+//
+// The database consists of a data file for each part of speech (data.noun,
+// data.verb, data.adj, and data.adv) containing the synsets (sets of
+// synonyms with a gloss and pointers to related synsets), an index file for
+// each (index.noun, etc.) listing the synsets for each lemma in order of
+// frequency, and the exception lists (noun.exc, etc.) for irregular inflected
+// forms (e.g. mice for mouse).
+package wordnet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// POS is a part of speech (n, v, a, or r).
+type POS byte
+
+// Parts of speech.
+const (
+	Noun      POS = 'n'
+	Verb      POS = 'v'
+	Adjective POS = 'a'
+	Adverb    POS = 'r'
+)
+
+// POSes are the parts of speech, in the order they are shown.
+var POSes = []POS{Noun, Verb, Adjective, Adverb}
+
+// String returns the name of the part of speech (e.g. noun).
+func (p POS) String() string {
+	switch p {
+	case Noun:
+		return "noun"
+	case Verb:
+		return "verb"
+	case Adjective:
+		return "adjective"
+	case Adverb:
+		return "adverb"
+	}
+	return string(p)
+}
+
+// file returns the suffix of the filenames for the part of speech.
+func (p POS) file() string {
+	switch p {
+	case Adjective:
+		return "adj"
+	case Adverb:
+		return "adv"
+	}
+	return p.String()
+}
+
+// SynsetID identifies a synset.
+type SynsetID struct {
+	POS    POS
+	Offset int64 // the byte offset in the data file
+}
+
+// Database is a parsed WordNet database.
+type Database struct {
+	Version string // e.g. 3.0, or empty if unknown
+
+	Synsets map[SynsetID]*Synset
+	Index   map[POS][]*IndexEntry // in the order of the index files
+
+	// Exceptions maps the base forms of lemmas to their irregular inflected
+	// forms for each part of speech (e.g. mouse to mice).
+	Exceptions map[POS]map[string][]string
+}
+
+// Synset is a set of synonyms.
+type Synset struct {
+	ID       SynsetID
+	Type     byte // n, v, a, s (adjective satellite), or r
+	Words    []string
+	Pointers []Pointer
+	Gloss    string // the definition and examples
+}
+
+// Pointer is a relation to another synset (or a word in it).
+type Pointer struct {
+	Symbol string // e.g. ! for antonyms, @ for hypernyms
+	Target SynsetID
+	Source int // the word in the synset (1-indexed), or 0 if the relation is between the synsets
+	Word   int // the word in the target synset (1-indexed), or 0 if the relation is between the synsets
+}
+
+// IndexEntry is an entry in an index file.
+type IndexEntry struct {
+	Lemma   string // lowercase, with underscores instead of spaces
+	Synsets []SynsetID
+}
+
+// Open reads a WordNet database from a directory containing the database
+// files (or the dict directory of a WordNet distribution).
+func Open(dir string) (*Database, error) {
+	if _, err := os.Stat(filepath.Join(dir, "dict", "data.noun")); err == nil {
+		dir = filepath.Join(dir, "dict")
+	}
+
+	db := &Database{
+		Synsets:    map[SynsetID]*Synset{},
+		Index:      map[POS][]*IndexEntry{},
+		Exceptions: map[POS]map[string][]string{},
+	}
+	var n int
+	for _, pos := range POSes {
+		if _, err := os.Stat(filepath.Join(dir, "data."+pos.file())); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		n++
+		if err := db.readData(filepath.Join(dir, "data."+pos.file()), pos); err != nil {
+			return nil, err
+		}
+		if err := db.readIndex(filepath.Join(dir, "index."+pos.file()), pos); err != nil {
+			return nil, err
+		}
+		if err := db.readExceptions(filepath.Join(dir, pos.file()+".exc"), pos); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no data files found in %#v", dir)
+	}
+	return db, nil
+}
+
+var versionRe = regexp.MustCompile(`WordNet (\d+(?:\.\d+)+)`)
+
+// readLines calls fn for each line of a file.
+func readLines(name string, fn func(line string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for i := 1; sc.Scan(); i++ {
+		if err := fn(sc.Text()); err != nil {
+			return fmt.Errorf("read %s: line %d: %w", filepath.Base(name), i, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+func (db *Database) readData(name string, pos POS) error {
+	return readLines(name, func(line string) error {
+		if strings.HasPrefix(line, "  ") {
+			if m := versionRe.FindStringSubmatch(line); m != nil && db.Version == "" {
+				db.Version = m[1]
+			}
+			return nil
+		}
+		ss, err := parseSynset(line, pos)
+		if err != nil {
+			return err
+		}
+		db.Synsets[ss.ID] = ss
+		return nil
+	})
+}
+
+// parseSynset parses a line of a data file:
+//
+//	offset lex_filenum ss_type w_cnt word lex_id [word lex_id...] p_cnt [ptr...] [frames...] | gloss
+func parseSynset(line string, pos POS) (*Synset, error) {
+	fields, gloss := line, ""
+	if i := strings.Index(line, " | "); i != -1 {
+		fields, gloss = line[:i], strings.TrimSpace(line[i+3:])
+	}
+	f := strings.Fields(fields)
+	next := func() string {
+		if len(f) == 0 {
+			return ""
+		}
+		v := f[0]
+		f = f[1:]
+		return v
+	}
+
+	ss := &Synset{Gloss: gloss}
+	off, err := strconv.ParseInt(next(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offset: %w", err)
+	}
+	ss.ID = SynsetID{pos, off}
+	next() // lex_filenum
+	if t := next(); len(t) == 1 {
+		ss.Type = t[0]
+	} else {
+		return nil, fmt.Errorf("invalid synset type %q", t)
+	}
+
+	wc, err := strconv.ParseUint(next(), 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid word count: %w", err)
+	}
+	for i := 0; i < int(wc); i++ {
+		w := next()
+		if j := strings.IndexByte(w, '('); j > 0 {
+			w = w[:j] // adjective syntactic marker, e.g. (a)
+		}
+		next() // lex_id
+		if w == "" {
+			return nil, errors.New("missing word")
+		}
+		ss.Words = append(ss.Words, w)
+	}
+
+	pc, err := strconv.Atoi(next())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pointer count: %w", err)
+	}
+	for i := 0; i < pc; i++ {
+		sym, off, p, st := next(), next(), next(), next()
+		o, err := strconv.ParseInt(off, 10, 64)
+		if err != nil || len(p) != 1 || len(st) != 4 {
+			return nil, fmt.Errorf("invalid pointer %d", i+1)
+		}
+		src, _ := strconv.ParseUint(st[:2], 16, 8)
+		tgt, _ := strconv.ParseUint(st[2:], 16, 8)
+		tp := POS(p[0])
+		if tp == 's' {
+			tp = Adjective
+		}
+		ss.Pointers = append(ss.Pointers, Pointer{
+			Symbol: sym,
+			Target: SynsetID{tp, o},
+			Source: int(src),
+			Word:   int(tgt),
+		})
+	}
+	return ss, nil
+}
+
+// readIndex parses an index file, where each line is:
+//
+//	lemma pos synset_cnt p_cnt [ptr_symbol...] sense_cnt tagsense_cnt synset_offset [synset_offset...]
+func (db *Database) readIndex(name string, pos POS) error {
+	return readLines(name, func(line string) error {
+		if strings.HasPrefix(line, "  ") {
+			return nil
+		}
+		f := strings.Fields(line)
+		if len(f) < 4 {
+			return errors.New("not enough fields")
+		}
+		sc, err := strconv.Atoi(f[2])
+		if err != nil {
+			return fmt.Errorf("invalid synset count: %w", err)
+		}
+		pc, err := strconv.Atoi(f[3])
+		if err != nil {
+			return fmt.Errorf("invalid pointer count: %w", err)
+		}
+		if len(f) != 4+pc+2+sc {
+			return errors.New("incorrect number of fields")
+		}
+
+		e := &IndexEntry{Lemma: f[0]}
+		for _, off := range f[4+pc+2:] {
+			o, err := strconv.ParseInt(off, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid offset: %w", err)
+			}
+			e.Synsets = append(e.Synsets, SynsetID{pos, o})
+		}
+		db.Index[pos] = append(db.Index[pos], e)
+		return nil
+	})
+}
+
+// readExceptions parses an exception list, where each line is:
+//
+//	inflected base [base...]
+func (db *Database) readExceptions(name string, pos POS) error {
+	exc := map[string][]string{}
+	if err := readLines(name, func(line string) error {
+		if f := strings.Fields(line); len(f) >= 2 {
+			for _, base := range f[1:] {
+				exc[base] = append(exc[base], f[0])
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	db.Exceptions[pos] = exc
+	return nil
+}
@@ -0,0 +1,94 @@
+package wordnet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+func TestDictFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dict")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	for name, lines := range map[string][]string{
+		"data.noun": {
+			"  1 This software and database is being provided to you, the LICENSEE, by  ",
+			"  2 Princeton University under the following license.  WordNet 3.0 Copyright 2006 by Princeton University.  ",
+			"00001000 05 n 02 dog 0 domestic_dog 0 002 @ 00002000 n 0000 ! 00003000 n 0101 | a member of the genus Canis; \"the dog barked all night\"  ",
+			"00002000 05 n 01 canine 0 001 ~ 00001000 n 0000 | a carnivore  ",
+			"00003000 05 n 01 cat 0 001 ! 00001000 n 0101 | a feline  ",
+			"00004000 05 n 02 mouse 0 Mickey_Mouse 0 000 | a rodent; \"a mouse squeaked\"; \"mice everywhere\"  ",
+		},
+		"index.noun": {
+			"  1 This software and database is being provided to you, the LICENSEE, by  ",
+			"canine n 1 1 ~ 1 0 00002000  ",
+			"cat n 1 1 ! 1 0 00003000  ",
+			"dog n 2 2 @ ! 2 0 00001000 00009000  ",
+			"domestic_dog n 1 1 @ 1 0 00001000  ",
+			"mickey_mouse n 1 0 1 0 00004000  ",
+			"mouse n 1 0 1 0 00004000  ",
+			"lion n 1 0 1 0 00009000  ",
+		},
+		"noun.exc": {
+			"mice mouse",
+		},
+		"data.verb": {
+			"00005000 29 v 01 dog 0 001 @ 00006000 v 0000 01 + 02 00 | go after with the intent to catch; \"The policeman dogged the mugger\"  ",
+			"00006000 29 v 01 pursue 0 000 01 + 01 00 | follow  ",
+		},
+		"index.verb": {
+			"dog v 1 1 @ 1 0 00005000  ",
+			"pursue v 1 0 1 0 00006000  ",
+		},
+		"verb.exc": {
+			"dogged dog",
+		},
+		"data.adj": {
+			"00007000 00 a 01 good(a) 0 001 ! 00008000 a 0101 | having desirable qualities  ",
+			"00008000 00 s 01 bad 0 001 ! 00007000 a 0101 | not good  ",
+		},
+		"index.adj": {
+			"bad a 1 1 ! 1 0 00008000  ",
+			"good a 1 1 ! 1 0 00007000  ",
+		},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	db, err := Open(filepath.Dir(dir))
+	if err != nil {
+		t.Fatalf("open wordnet: %v", err)
+	}
+	if hdr := db.Header(); hdr.Version != "3.0" || hdr.Locale != "en" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+
+	act, warnings := db.DictFile()
+	importtest.CheckWarnings(t, "", warnings,
+		`word "dog": missing noun synset 9000`,
+		`word "lion": missing noun synset 9000`,
+		`word "lion": skipping entry: no synsets`,
+	)
+	exp := dictgen.DictFile{
+		{Headword: "bad", RawHTML: true, Definition: `<p class="pos"><i>adjective</i></p><ol><li>not good<br/><span class="ant">Antonyms: [[good]]</span></li></ol>`},
+		{Headword: "canine", RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a carnivore</li></ol>`},
+		{Headword: "cat", RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a feline<br/><span class="ant">Antonyms: [[dog]]</span></li></ol>`},
+		{Headword: "dog", Variant: []string{"dogged"}, RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a member of the genus Canis<br/><i class="ex">the dog barked all night</i><br/><span class="syn">Synonyms: [[domestic dog]]</span><br/><span class="ant">Antonyms: [[cat]]</span><br/><span class="hyper">Hypernyms: [[canine]]</span></li></ol><p class="pos"><i>verb</i></p><ol><li>go after with the intent to catch<br/><i class="ex">The policeman dogged the mugger</i><br/><span class="hyper">Hypernyms: [[pursue]]</span></li></ol>`},
+		{Headword: "domestic dog", RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a member of the genus Canis<br/><i class="ex">the dog barked all night</i><br/><span class="syn">Synonyms: [[dog]]</span><br/><span class="hyper">Hypernyms: [[canine]]</span></li></ol>`},
+		{Headword: "good", RawHTML: true, Definition: `<p class="pos"><i>adjective</i></p><ol><li>having desirable qualities<br/><span class="ant">Antonyms: [[bad]]</span></li></ol>`},
+		{Headword: "Mickey Mouse", RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a rodent<br/><i class="ex">a mouse squeaked</i><br/><i class="ex">mice everywhere</i><br/><span class="syn">Synonyms: [[mouse]]</span></li></ol>`},
+		{Headword: "mouse", Variant: []string{"mice"}, RawHTML: true, Definition: `<p class="pos"><i>noun</i></p><ol><li>a rodent<br/><i class="ex">a mouse squeaked</i><br/><i class="ex">mice everywhere</i><br/><span class="syn">Synonyms: [[Mickey Mouse]]</span></li></ol>`},
+		{Headword: "pursue", RawHTML: true, Definition: `<p class="pos"><i>verb</i></p><ol><li>follow</li></ol>`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+	if err := act.CheckReferences(); err != nil {
+		t.Errorf("unexpected dangling references: %v", err)
+	}
+}
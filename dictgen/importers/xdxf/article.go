@@ -0,0 +1,183 @@
+package xdxf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// ArticleKeys returns the keys (<k>) of an XDXF article (the contents of an
+// <ar> element). If a key has an optional part (<opt>), it is returned both
+// with and without it. Parts which aren't used for searching (<nu>) are
+// removed.
+func ArticleKeys(s string) ([]string, error) {
+	ts, err := importutil.XMLTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	seen := map[string]bool{}
+	add := func(k string) {
+		if k = strings.Join(strings.Fields(k), " "); k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for i := 0; i < len(ts); i++ {
+		if se, ok := ts[i].(xml.StartElement); ok {
+			if _, n := importutil.XMLText(ts[i:]); se.Name.Local == "k" {
+				var full, short strings.Builder
+				var skip string // the element being skipped in short or both
+				var depth, skipDepth int
+				for _, t := range ts[i+1 : i+n-1] {
+					switch t := t.(type) {
+					case xml.StartElement:
+						if depth++; skip == "" && (t.Name.Local == "opt" || t.Name.Local == "nu") {
+							skip, skipDepth = t.Name.Local, depth
+						}
+					case xml.EndElement:
+						if skip != "" && depth == skipDepth {
+							skip = ""
+						}
+						depth--
+					case xml.CharData:
+						switch skip {
+						case "":
+							full.Write(t)
+							short.Write(t)
+						case "opt":
+							full.Write(t)
+						}
+					}
+				}
+				add(full.String())
+				add(short.String())
+				i += n - 1
+			} else {
+				i += n - 1 // keys are only direct children of the article
+			}
+		}
+	}
+	return keys, nil
+}
+
+// ArticleHTML converts an XDXF article (the contents of an <ar> element) to
+// HTML. Both the visual format (where the text is formatted with tags like
+// <tr>, <abr>, and <ex>, and newlines are significant) and the logical one
+// (where the article is structured into <def> elements) are supported. The
+// keys are removed.
+//
+// References to other articles (<kref>) are converted into dictgen
+// cross-references ([[target]]) if ref is nil or returns true for the target,
+// and are left as plain text otherwise. Resources (<rref>) are converted into
+// images if they have an image extension, and are ignored otherwise.
+func ArticleHTML(s string, ref func(target string) bool) (string, error) {
+	ts, err := importutil.XMLTokens(s)
+	if err != nil {
+		return "", err
+	}
+
+	// in the logical format, whitespace isn't significant
+	var logical bool
+	for _, t := range ts {
+		if se, ok := t.(xml.StartElement); ok && se.Name.Local == "def" {
+			logical = true
+			break
+		}
+	}
+
+	var b strings.Builder
+	var end []string
+	for i := 0; i < len(ts); i++ {
+		switch t := ts[i].(type) {
+		case xml.StartElement:
+			var open, close string
+			switch n := t.Name.Local; {
+			case n == "k":
+				// the headword
+				_, skip := importutil.XMLText(ts[i:])
+				i += skip - 1
+				if i+1 < len(ts) {
+					if cd, ok := ts[i+1].(xml.CharData); ok {
+						ts[i+1] = xml.CharData(bytes.TrimLeft(cd, "\n"))
+					}
+				}
+				continue
+			case n == "kref":
+				text, skip := importutil.XMLText(ts[i:])
+				i += skip - 1
+				text = strings.Join(strings.Fields(text), " ")
+				if text != "" && !strings.ContainsAny(text, "[]|<>&") && (ref == nil || ref(text)) {
+					b.WriteString("[[" + text + "]]")
+				} else {
+					b.WriteString(html.EscapeString(text))
+				}
+				continue
+			case n == "rref":
+				text, skip := importutil.XMLText(ts[i:])
+				i += skip - 1
+				switch strings.ToLower(path.Ext(text)) {
+				case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".bmp":
+					b.WriteString(`<img src="` + html.EscapeString(text) + `"/>`)
+				}
+				continue
+			case n == "br":
+				open = "<br/>"
+			case n == "tr":
+				open, close = `<span class="tr">[`, `]</span>`
+			case n == "abr" || n == "abbr":
+				open, close = `<i class="abr">`, `</i>`
+			case n == "ex":
+				open, close = `<i class="ex">`, `</i>`
+			case n == "ex_tran":
+				open, close = ` — <span class="ex_tran">`, `</span>`
+			case n == "gr":
+				open, close = `<i class="gr">`, `</i>`
+			case n == "co" || n == "dtrn" || n == "etm" || n == "categ":
+				open, close = `<span class="`+n+`">`, `</span>`
+			case n == "mrkd":
+				open, close = `<b>`, `</b>`
+			case n == "c":
+				c := importutil.XMLAttr(t, "c")
+				if c == "" {
+					c = "green"
+				}
+				open, close = `<span style="color:`+html.EscapeString(c)+`">`, `</span>`
+			case n == "iref":
+				open, close = `<a href="`+html.EscapeString(importutil.XMLAttr(t, "href"))+`">`, `</a>`
+			case n == "def" || n == "sr":
+				open, close = `<div class="`+n+`">`, `</div>`
+			case importutil.HTMLTags[n]:
+				open, close = "<"+n+">", "</"+n+">"
+			}
+			b.WriteString(open)
+			end = append(end, close)
+		case xml.EndElement:
+			if len(end) != 0 {
+				b.WriteString(end[len(end)-1])
+				end = end[:len(end)-1]
+			}
+		case xml.CharData:
+			if logical {
+				b.WriteString(spaceRe.ReplaceAllString(html.EscapeString(string(t)), " "))
+			} else {
+				b.WriteString(strings.ReplaceAll(html.EscapeString(string(t)), "\n", "<br/>"))
+			}
+		}
+	}
+	if logical {
+		return strings.TrimSpace(blockSpaceRe.ReplaceAllString(b.String(), "$1")), nil
+	}
+	return strings.TrimSuffix(b.String(), "<br/>"), nil
+}
+
+var (
+	spaceRe      = regexp.MustCompile(`\s+`)
+	blockSpaceRe = regexp.MustCompile(` *(</?div[^>]*>) *`)
+)
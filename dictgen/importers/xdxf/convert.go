@@ -0,0 +1,84 @@
+package xdxf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Header returns a dictfile header with the metadata from the XDXF. The
+// description isn't included, since dictfile headers don't have a field for
+// it.
+func (d *Dictionary) Header() *dictgen.DictFileHeader {
+	return &dictgen.DictFileHeader{
+		Title:   d.Title,
+		Author:  strings.Join(d.Authors, ", "),
+		Version: d.Version,
+		Locale:  importutil.Locale(importutil.NormalizeLanguage(d.LangFrom), importutil.NormalizeLanguage(d.LangTo)),
+	}
+}
+
+// DictFile converts the dictionary into a DictFile. The first key of each
+// article is used as the headword, and the others are added as variants.
+// References to other articles are converted into cross-references if the
+// target exists.
+//
+// Articles without any keys (e.g. ones only containing a <nu> key), and
+// articles and keys which contain characters which aren't allowed by dictgen,
+// are skipped and returned as warnings.
+func (d *Dictionary) DictFile() (dictgen.DictFile, []error) {
+	words := map[string]bool{}
+	for _, a := range d.Articles {
+		for _, k := range a.Keys {
+			words[strings.ToLower(k)] = true
+		}
+	}
+
+	var df dictgen.DictFile
+	var warnings []error
+	for _, a := range d.Articles {
+		var hw string
+		if len(a.Keys) != 0 {
+			hw = a.Keys[0]
+		}
+		dfe, err := d.convert(a, words, func(err error) {
+			warnings = append(warnings, fmt.Errorf("word %#v: %w", hw, err))
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("word %#v: skipping article: %w", hw, err))
+			continue
+		}
+		df = append(df, dfe)
+	}
+	return df, warnings
+}
+
+func (d *Dictionary) convert(a *Article, words map[string]bool, warn func(error)) (*dictgen.DictFileEntry, error) {
+	if len(a.Keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	dfe := &dictgen.DictFileEntry{
+		Headword: a.Keys[0],
+		RawHTML:  true,
+	}
+	if err := dictgen.ValidateWord(dfe.Headword); err != nil {
+		return nil, fmt.Errorf("key %w", err)
+	}
+	dfe.Variant = importutil.Variants(dfe.Headword, a.Keys[1:], "key", warn)
+
+	h, err := ArticleHTML(a.Body, func(target string) bool {
+		return words[strings.ToLower(target)]
+	})
+	if err != nil {
+		return nil, fmt.Errorf("convert article: %w", err)
+	}
+	dfe.Definition = importutil.ResolveImages(h, d.Res)
+
+	if err := (dictgen.DictFile{dfe}).Validate(); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
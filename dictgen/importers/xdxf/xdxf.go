@@ -0,0 +1,170 @@
+// Package xdxf reads XDXF (XML Dictionary eXchange Format) dictionaries and
+// converts them into dictfiles.
+//
+// Both the visual format (the original one, where articles are formatted text)
+// and the logical one (XDXF 034+, where articles are structured into <def>
+// elements) are supported. To write XDXF dictionaries, see
+// dictgen.DictFile.WriteXDXF.
+package xdxf
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importutil"
+)
+
+// Dictionary is a parsed XDXF dictionary.
+type Dictionary struct {
+	Format   string // visual or logical (as specified in the file)
+	LangFrom string // ISO 639-2 code (e.g. ENG)
+	LangTo   string // ISO 639-2 code (e.g. ENG)
+
+	Title       string // full_name (visual), or full_title or title (logical)
+	Description string
+	Authors     []string // logical only
+	Version     string   // file_ver (logical only)
+
+	Articles []*Article
+
+	Res string // the directory to resolve relative resource references against (set by Open)
+}
+
+// Article is an article from the dictionary.
+type Article struct {
+	Keys []string // see ArticleKeys
+	Body string   // the raw contents of the <ar> element, including the keys
+}
+
+// Open parses an XDXF file (e.g. dict.xdxf). Relative resource references are
+// resolved against the directory containing it.
+func Open(name string) (*Dictionary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := Parse(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	d.Res = filepath.Dir(name)
+	return d, nil
+}
+
+// Parse parses an XDXF dictionary. The raw contents of every article are kept
+// in memory, but they are only parsed when converted.
+func Parse(r io.Reader) (*Dictionary, error) {
+	xd := xml.NewDecoder(r)
+	xd.Entity = xml.HTMLEntity
+
+	d := new(Dictionary)
+	var root bool
+	for {
+		tok, err := xd.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if !root {
+					return nil, errors.New("not an xdxf dictionary (missing root element)")
+				}
+				return d, nil
+			}
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "xdxf":
+			root = true
+			for _, a := range se.Attr {
+				switch a.Name.Local {
+				case "format":
+					d.Format = a.Value
+				case "lang_from":
+					d.LangFrom = a.Value
+				case "lang_to":
+					d.LangTo = a.Value
+				}
+			}
+		case "full_name":
+			var v xmlInner
+			if err := xd.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("read full_name: %w", err)
+			}
+			d.Title = v.text()
+		case "description":
+			var v xmlInner
+			if err := xd.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("read description: %w", err)
+			}
+			d.Description = v.text()
+		case "meta_info":
+			var v struct {
+				Title       xmlInner   `xml:"title"`
+				FullTitle   xmlInner   `xml:"full_title"`
+				Description xmlInner   `xml:"description"`
+				Authors     []xmlInner `xml:"authors>author"`
+				FileVer     xmlInner   `xml:"file_ver"`
+			}
+			if err := xd.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("read meta_info: %w", err)
+			}
+			if d.Title = v.FullTitle.text(); d.Title == "" {
+				d.Title = v.Title.text()
+			}
+			d.Description = v.Description.text()
+			for _, a := range v.Authors {
+				if s := a.text(); s != "" {
+					d.Authors = append(d.Authors, s)
+				}
+			}
+			d.Version = v.FileVer.text()
+		case "abbreviations":
+			if err := xd.Skip(); err != nil {
+				return nil, fmt.Errorf("read abbreviations: %w", err)
+			}
+		case "ar":
+			line, _ := xd.InputPos()
+			var v xmlInner
+			if err := xd.DecodeElement(&v, &se); err != nil {
+				return nil, fmt.Errorf("line %d: read article: %w", line, err)
+			}
+			keys, err := ArticleKeys(v.Inner)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: read article keys: %w", line, err)
+			}
+			d.Articles = append(d.Articles, &Article{
+				Keys: keys,
+				Body: v.Inner,
+			})
+		}
+	}
+}
+
+type xmlInner struct {
+	Inner string `xml:",innerxml"`
+}
+
+// text returns the text of the element with the markup removed and the
+// whitespace collapsed.
+func (x xmlInner) text() string {
+	ts, err := importutil.XMLTokens(x.Inner)
+	if err != nil {
+		return ""
+	}
+	var b []byte
+	for _, t := range ts {
+		if cd, ok := t.(xml.CharData); ok {
+			b = append(b, cd...)
+		}
+	}
+	return importutil.OneLine(string(b))
+}
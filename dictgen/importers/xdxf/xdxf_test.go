@@ -0,0 +1,135 @@
+package xdxf
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/internal/importtest"
+)
+
+func TestVisual(t *testing.T) {
+	d, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE xdxf SYSTEM "http://xdxf.sourceforge.net/xdxf_lousy.dtd">
+<xdxf lang_from="ENG" lang_to="RUS" format="visual">
+<full_name>Test
+ Dict</full_name>
+<description>A <b>test</b>.</description>
+<abbreviations><abr_def><k>n.</k><v>noun</v></abr_def></abbreviations>
+<ar><k>cat</k>
+<k>cat<opt>s</opt></k>
+<tr>kæt</tr> <abr>n.</abr>
+a small animal &amp; pet, see <kref>dog</kref> or <kref>wolf</kref>
+<ex>a black cat</ex> <rref>cat.png</rref><rref>cat.wav</rref></ar>
+<ar><k>dog<nu>, the</nu></k>
+<c c="red">an</c> <i>animal</i></ar>
+<ar><k><nu>x</nu></k>
+no keys</ar>
+</xdxf>
+`))
+	if err != nil {
+		t.Fatalf("parse xdxf: %v", err)
+	}
+	d.Res = "res"
+
+	if hdr := d.Header(); hdr.Title != "Test Dict" || hdr.Locale != "en-ru" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+	if d.Description != "A test." {
+		t.Errorf("incorrect description %q", d.Description)
+	}
+
+	act, warnings := d.DictFile()
+	importtest.CheckWarnings(t, "", warnings, `word "": skipping article: no keys`)
+	exp := dictgen.DictFile{
+		{Headword: "cat", Variant: []string{"cats"}, RawHTML: true, Definition: `<span class="tr">[kæt]</span> <i class="abr">n.</i><br/>a small animal &amp; pet, see [[dog]] or wolf<br/><i class="ex">a black cat</i> <img src="` + filepath.Join("res", "cat.png") + `"/>`},
+		{Headword: "dog", RawHTML: true, Definition: `<span style="color:red">an</span> <i>animal</i>`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
+
+func TestLogical(t *testing.T) {
+	d, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<xdxf lang_from="fra" lang_to="eng" format="logical" revision="034">
+<meta_info>
+<title>Test</title>
+<full_title>Test Dictionary</full_title>
+<authors><author role="author">Someone</author><author>Someone Else</author></authors>
+<file_ver>1.2</file_ver>
+</meta_info>
+<lexicon>
+<ar>
+  <k>chat</k>
+  <def>
+    <gr><abbr>n.</abbr></gr>
+    <def><deftext>cat</deftext></def>
+    <def><deftext>chat</deftext> <sr><kref type="syn">discussion</kref></sr></def>
+  </def>
+</ar>
+<ar><k>discussion</k><def><deftext>discussion</deftext></def></ar>
+</lexicon>
+</xdxf>
+`))
+	if err != nil {
+		t.Fatalf("parse xdxf: %v", err)
+	}
+
+	if hdr := d.Header(); hdr.Title != "Test Dictionary" || hdr.Author != "Someone, Someone Else" || hdr.Version != "1.2" || hdr.Locale != "fr-en" {
+		t.Errorf("incorrect header %+v", hdr)
+	}
+
+	act, warnings := d.DictFile()
+	importtest.CheckWarnings(t, "", warnings)
+	exp := dictgen.DictFile{
+		{Headword: "chat", RawHTML: true, Definition: `<div class="def"><i class="gr"><i class="abr">n.</i></i><div class="def">cat</div><div class="def">chat<div class="sr">[[discussion]]</div></div></div>`},
+		{Headword: "discussion", RawHTML: true, Definition: `<div class="def">discussion</div>`},
+	}
+	importtest.CheckDictFile(t, "", exp, act)
+}
+
+func TestRoundTrip(t *testing.T) {
+	df, err := dictgen.ParseDictFile(strings.NewReader("@ banana\n& Bananas\nA fruit, see [[apple|apples]].\n@ apple\n& apples\nA *fruit*.\n"))
+	if err != nil {
+		t.Fatalf("parse dictfile: %v", err)
+	}
+
+	for _, visual := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := df.WriteXDXF(&buf, &dictgen.XDXFOptions{
+			Title:  "Test",
+			Author: "Someone",
+			Locale: "en",
+			Visual: visual,
+		}); err != nil {
+			t.Fatalf("write xdxf: %v", err)
+		}
+
+		d, err := Parse(&buf)
+		if err != nil {
+			t.Fatalf("visual=%t: parse xdxf: %v", visual, err)
+		}
+		if hdr := d.Header(); hdr.Title != "Test" || hdr.Locale != "en" {
+			t.Errorf("visual=%t: incorrect header %+v", visual, hdr)
+		}
+
+		act, warnings := d.DictFile()
+		importtest.CheckWarnings(t, fmt.Sprintf("visual=%t", visual), warnings)
+		var hw [][]string
+		for _, dfe := range act {
+			hw = append(hw, append([]string{dfe.Headword}, dfe.Variant...))
+			if !strings.Contains(dfe.Definition, "fruit") {
+				t.Errorf("visual=%t: word %q: missing definition: %q", visual, dfe.Headword, dfe.Definition)
+			}
+		}
+		if exp := [][]string{{"banana", "Bananas"}, {"apple", "apples"}}; !reflect.DeepEqual(hw, exp) {
+			t.Errorf("visual=%t: expected keys %q, got %q", visual, exp, hw)
+		}
+		if !strings.Contains(act[0].Definition, "[[apple]]") {
+			t.Errorf("visual=%t: expected cross-reference to be kept, got %q", visual, act[0].Definition)
+		}
+	}
+}
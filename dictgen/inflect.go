@@ -0,0 +1,53 @@
+package dictgen
+
+import (
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// Inflector adds the inflected forms of headwords as variants. This is useful
+// for forms which won't be matched by nickel's prefix fallback (which only
+// handles added suffixes, e.g. "tests" matching "test"), like "went" for "go".
+type Inflector struct {
+	// Forms returns the inflected forms of a headword (e.g.
+	// (*hunspell.Dictionary).Forms).
+	Forms func(headword string) []string
+	// Max is the maximum number of inflected forms to add to a single entry. If
+	// zero, it defaults to 32.
+	Max int
+}
+
+// Apply adds the inflected forms of the headword of each entry in the DictFile
+// as variants. Forms which are the same as the headword of any entry, or as an
+// existing variant of the entry (after normalization) are skipped. Since the
+// forms are added to the entries, they will be placed in the correct dicthtml
+// files by Prefixed.
+func (in *Inflector) Apply(df DictFile) {
+	max := in.Max
+	if max == 0 {
+		max = 32
+	}
+
+	headwords := map[string]bool{}
+	for _, dfe := range df {
+		headwords[kobodict.NormalizeWordReference(dfe.Headword, true)] = true
+	}
+
+	for _, dfe := range df {
+		seen := map[string]bool{}
+		for _, v := range dfe.Variant {
+			seen[kobodict.NormalizeWordReference(v, true)] = true
+		}
+
+		var n int
+		for _, f := range in.Forms(dfe.Headword) {
+			if n >= max {
+				break
+			}
+			if nf := kobodict.NormalizeWordReference(f, true); nf != "" && !headwords[nf] && !seen[nf] {
+				seen[nf] = true
+				dfe.Variant = append(dfe.Variant, f)
+				n++
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package dictgen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInflector(t *testing.T) {
+	forms := map[string][]string{
+		"go":    {"goes", "went", "gone", "going"},
+		"test":  {"tests", "tested", "testing"},
+		"mouse": {"mice", "Mice"},
+	}
+	df := DictFile{
+		{Headword: "go", Variant: []string{"Went"}},
+		{Headword: "gone"},
+		{Headword: "test"},
+		{Headword: "mouse"},
+		{Headword: "other"},
+	}
+	(&Inflector{
+		Forms: func(hw string) []string { return forms[hw] },
+		Max:   2,
+	}).Apply(df)
+
+	for i, exp := range [][]string{
+		{"Went", "goes", "going"},
+		nil,
+		{"tests", "tested"},
+		{"mice"},
+		nil,
+	} {
+		if !reflect.DeepEqual(df[i].Variant, exp) {
+			t.Errorf("%s: expected variants %#v, got %#v", df[i].Headword, exp, df[i].Variant)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package dictgen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/russross/blackfriday/v2"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Renderer renders the Markdown in definitions to HTML. It is available to
+// entry templates as the md function. It must be safe for concurrent use.
+type Renderer interface {
+	Render(md string) (string, error)
+}
+
+// ParseRenderer parses a renderer specification: blackfriday, goldmark, or
+// goldmark:extensions (see ParseRendererGoldmark).
+func ParseRenderer(spec string) (Renderer, error) {
+	switch name, exts, _ := strings.Cut(spec, ":"); name {
+	case "blackfriday":
+		if exts != "" {
+			return nil, fmt.Errorf("blackfriday renderer does not support extensions")
+		}
+		return new(RendererBlackfriday), nil
+	case "goldmark":
+		return ParseRendererGoldmark(exts)
+	default:
+		return nil, fmt.Errorf("unknown renderer %#v", name)
+	}
+}
+
+// RendererBlackfriday renders Markdown using blackfriday with the default
+// settings. It is the default renderer.
+type RendererBlackfriday struct{}
+
+// Render implements Renderer.
+func (*RendererBlackfriday) Render(md string) (string, error) {
+	return strings.TrimSpace(string(blackfriday.Run([]byte(md)))), nil
+}
+
+// RendererGoldmark renders CommonMark using goldmark with the specified
+// extensions. Raw HTML is passed through as-is. The output is minified to a
+// single line (see MinifyHTML).
+type RendererGoldmark struct {
+	// Tables enables GFM tables.
+	Tables bool
+	// Strikethrough enables GFM strikethrough (~~text~~).
+	Strikethrough bool
+	// Linkify automatically links URLs.
+	Linkify bool
+	// Footnotes enables PHP Markdown Extra footnotes. Since multiple entries
+	// are shown together, the IDs are prefixed with a unique number for each
+	// definition.
+	Footnotes bool
+	// DefinitionLists enables PHP Markdown Extra definition lists.
+	DefinitionLists bool
+	// Typographer replaces quotes, dashes, and ellipses with their
+	// typographic equivalents (i.e. smart quotes).
+	Typographer bool
+	// LinkFunc, if not nil, is called to rewrite the destination of each link
+	// (e.g. to point to other entries).
+	LinkFunc func(dest string) string
+
+	once sync.Once
+	md   goldmark.Markdown
+	n    uint64
+}
+
+// ParseRendererGoldmark returns a goldmark renderer with a comma-separated
+// list of extensions enabled (table, strikethrough, linkify, footnote,
+// deflist, typographer, or all).
+func ParseRendererGoldmark(extensions string) (*RendererGoldmark, error) {
+	r := new(RendererGoldmark)
+	for _, x := range strings.Split(extensions, ",") {
+		switch strings.TrimSpace(x) {
+		case "table":
+			r.Tables = true
+		case "strikethrough":
+			r.Strikethrough = true
+		case "linkify":
+			r.Linkify = true
+		case "footnote":
+			r.Footnotes = true
+		case "deflist":
+			r.DefinitionLists = true
+		case "typographer":
+			r.Typographer = true
+		case "all":
+			r.Tables, r.Strikethrough, r.Linkify, r.Footnotes, r.DefinitionLists, r.Typographer = true, true, true, true, true, true
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown goldmark extension %#v", x)
+		}
+	}
+	return r, nil
+}
+
+const rendererGoldmarkFootnotePrefix = "dictgen-footnote-prefix"
+
+// init initializes the goldmark instance. The options must not be changed
+// afterwards.
+func (r *RendererGoldmark) init() goldmark.Markdown {
+	var exts []goldmark.Extender
+	if r.Tables {
+		exts = append(exts, extension.Table)
+	}
+	if r.Strikethrough {
+		exts = append(exts, extension.Strikethrough)
+	}
+	if r.Linkify {
+		exts = append(exts, extension.Linkify)
+	}
+	if r.Footnotes {
+		exts = append(exts, extension.NewFootnote(extension.WithFootnoteIDPrefixFunction(func(n ast.Node) []byte {
+			if v, ok := n.OwnerDocument().Meta()[rendererGoldmarkFootnotePrefix].([]byte); ok {
+				return v
+			}
+			return nil
+		})))
+	}
+	if r.DefinitionLists {
+		exts = append(exts, extension.DefinitionList)
+	}
+	if r.Typographer {
+		exts = append(exts, extension.Typographer)
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+}
+
+// Render implements Renderer. Note that the options are read the first time
+// Render is called, and changes afterwards will have no effect.
+func (r *RendererGoldmark) Render(md string) (string, error) {
+	r.once.Do(func() {
+		r.md = r.init()
+	})
+
+	src := []byte(md)
+	doc := r.md.Parser().Parse(text.NewReader(src))
+
+	if r.LinkFunc != nil {
+		if err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if l, ok := n.(*ast.Link); ok && entering {
+				l.Destination = []byte(r.LinkFunc(string(l.Destination)))
+			}
+			return ast.WalkContinue, nil
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	if r.Footnotes {
+		doc.OwnerDocument().AddMeta(rendererGoldmarkFootnotePrefix, []byte("d"+strconv.FormatUint(atomic.AddUint64(&r.n, 1), 10)+"-"))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := r.md.Renderer().Render(buf, src, doc); err != nil {
+		return "", err
+	}
+	return MinifyHTML(buf.String()), nil
+}
+
+// MinifyHTML converts HTML to a single line by removing newlines between
+// block-level tags (e.g. </p> and <ul>) and replacing the rest with spaces.
+// Newlines within pre tags are replaced with <br>.
+func MinifyHTML(h string) string {
+	h = strings.TrimSpace(h)
+
+	var b strings.Builder
+	b.Grow(len(h))
+
+	var pre int
+	for i := 0; i < len(h); i++ {
+		switch c := h[i]; c {
+		case '<':
+			if t := strings.ToLower(h[i:min(i+6, len(h))]); strings.HasPrefix(t, "<pre") && (len(t) == 4 || t[4] == '>' || t[4] == ' ') {
+				pre++
+			} else if strings.HasPrefix(t, "</pre>") && pre > 0 {
+				pre--
+			}
+			b.WriteByte(c)
+		case '\r':
+		case '\n':
+			switch {
+			case pre > 0:
+				if !strings.HasPrefix(h[i+1:], "</code></pre>") && !strings.HasPrefix(h[i+1:], "</pre>") {
+					b.WriteString("<br>")
+				}
+			case minifyBlockBefore(h[:i]) && minifyBlockAfter(h[i+1:]):
+			case strings.HasSuffix(b.String(), " "):
+			default:
+				b.WriteByte(' ')
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// minifyBlockTags are the tags which newlines can be removed around.
+var minifyBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"body": true, "br": true, "dd": true, "details": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true,
+	"footer": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "head": true, "header": true, "hr": true,
+	"html": true, "li": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "style": true, "summary": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "tr": true, "ul": true,
+}
+
+// minifyBlockBefore checks if h ends with a block-level tag, ignoring trailing
+// whitespace.
+func minifyBlockBefore(h string) bool {
+	h = strings.TrimRight(h, " \t\r\n")
+	if !strings.HasSuffix(h, ">") {
+		return false
+	}
+	i := strings.LastIndexByte(h, '<')
+	if i == -1 {
+		return false
+	}
+	return minifyBlockTags[minifyTagName(h[i+1:])]
+}
+
+// minifyBlockAfter checks if h starts with a block-level tag, ignoring leading
+// whitespace.
+func minifyBlockAfter(h string) bool {
+	h = strings.TrimLeft(h, " \t\r\n")
+	if !strings.HasPrefix(h, "<") {
+		return false
+	}
+	return minifyBlockTags[minifyTagName(h[1:])]
+}
+
+// minifyTagName returns the lowercase name of the tag starting at t (after the
+// <, and optionally a /).
+func minifyTagName(t string) string {
+	t = strings.TrimPrefix(t, "/")
+	n := strings.IndexFunc(t, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if n == -1 {
+		n = len(t)
+	}
+	return strings.ToLower(t[:n])
+}
@@ -0,0 +1,66 @@
+package dictgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRendererGoldmark(t *testing.T) {
+	r, err := ParseRendererGoldmark("all")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.LinkFunc = func(dest string) string {
+		return strings.TrimPrefix(dest, "entry:")
+	}
+
+	for _, tc := range [][2]string{
+		{"Test *test*.", `<p>Test <em>test</em>.</p>`},
+		{"Line 1\nline 2.\n\n- A\n- B", `<p>Line 1 line 2.</p><ul><li>A</li><li>B</li></ul>`},
+		{"| A | B |\n|---|---|\n| 1 | 2 |", `<table><thead><tr><th>A</th><th>B</th></tr></thead><tbody><tr><td>1</td><td>2</td></tr></tbody></table>`},
+		{"Term\n: Definition", `<dl><dt>Term</dt><dd>Definition</dd></dl>`},
+		{`"Quoted" -- ~~struck~~`, `<p>&ldquo;Quoted&rdquo; &ndash; <del>struck</del></p>`},
+		{"[link](entry:test)", `<p><a href="test">link</a></p>`},
+		{"<b>raw</b>", `<p><b>raw</b></p>`},
+		{"    code\n    block", `<pre><code>code<br>block</code></pre>`},
+		{"This is *emphasized*\nand continued.", `<p>This is <em>emphasized</em> and continued.</p>`},
+		{"a `code`\nb", `<p>a <code>code</code> b</p>`},
+		{"> quote\n\n1. one\n2. two", `<blockquote><p>quote</p></blockquote><ol><li>one</li><li>two</li></ol>`},
+	} {
+		if act, err := r.Render(tc[0]); err != nil {
+			t.Errorf("%q: unexpected error: %v", tc[0], err)
+		} else if act != tc[1] {
+			t.Errorf("%q: expected %q, got %q", tc[0], tc[1], act)
+		}
+	}
+
+	a, _ := r.Render("Test[^1].\n\n[^1]: Note.")
+	b, _ := r.Render("Test[^1].\n\n[^1]: Note.")
+	if !strings.Contains(a, `-fn:1"`) || a == b {
+		t.Errorf("expected unique footnote ids, got %q and %q", a, b)
+	}
+	if strings.Contains(a, "\n") {
+		t.Errorf("expected output to be minified, got %q", a)
+	}
+
+	for _, tc := range [][2]string{
+		{"<p>a</p>\n\n<ul>\n<li>b</li>\n</ul>", `<p>a</p><ul><li>b</li></ul>`},
+		{"<b>a</b>\n<i>b</i>", `<b>a</b> <i>b</i>`},
+		{"a\r\n\r\nb", `a b`},
+		{"a<br />\nb", `a<br /> b`},
+		{"<pre>a\nb\n</pre>", `<pre>a<br>b</pre>`},
+	} {
+		if act := MinifyHTML(tc[0]); act != tc[1] {
+			t.Errorf("minify %q: expected %q, got %q", tc[0], tc[1], act)
+		}
+	}
+
+	if _, err := ParseRenderer("goldmark:unknown"); err == nil {
+		t.Errorf("expected error for unknown extension")
+	}
+	if r, err := ParseRenderer("blackfriday"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if _, ok := r.(*RendererBlackfriday); !ok {
+		t.Errorf("expected blackfriday renderer, got %T", r)
+	}
+}
@@ -0,0 +1,478 @@
+package dictgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// DictFileScanner reads the entries from a dictfile one at a time, so large
+// dictfiles can be processed without loading them into memory. Include
+// directives are followed as they are encountered. See ParseDictFile for
+// details about the format.
+type DictFileScanner struct {
+	stack []*dictFileFrame // the files currently being read
+	h     *DictFileHeader
+	dfe   *DictFileEntry // the entry currently being read
+	cur   *DictFileEntry // the last entry returned by Scan
+	err   error
+
+	comment int // the line of the first comment within the definition content of the current entry
+
+	raw  bool     // keep comments and include directives instead of following them (for formatting)
+	pre  []string // raw mode: comment and include lines before the next entry
+	hpre []string // raw mode: comment lines before the header
+}
+
+// dictFileFrame is a file being read by a DictFileScanner.
+type dictFileFrame struct {
+	br      *bufio.Scanner
+	c       io.Closer       // nil if not opened by the scanner
+	file    string          // empty if not read from a file
+	abs     string          // for include cycle detection
+	line    int             // the current line
+	started bool            // whether the header has ended
+	h       *DictFileHeader // nil if headers are not allowed (i.e. for included files)
+	pending []string        // included files which haven't been read yet
+}
+
+// NewDictFileScanner creates a new DictFileScanner reading from r. Include
+// directives are resolved relative to the current directory.
+func NewDictFileScanner(r io.Reader) *DictFileScanner {
+	s := &DictFileScanner{h: new(DictFileHeader)}
+	s.push(r, nil, "", "")
+	return s
+}
+
+// OpenDictFileScanner creates a new DictFileScanner reading from the specified
+// file. Include directives are resolved relative to the directory containing
+// the file, and errors will contain the filename. The scanner must be closed
+// if it isn't read until the end.
+func OpenDictFileScanner(name string) (*DictFileScanner, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &DictFileScanner{h: new(DictFileHeader)}
+	s.push(f, f, name, abs)
+	return s, nil
+}
+
+// NewDictFileScannerName is like NewDictFileScanner, but the dictfile is
+// treated as if it was read from the specified file (e.g. for a file which
+// is being edited but hasn't been saved). Include directives are resolved
+// relative to the directory containing it, and errors will contain the name.
+func NewDictFileScannerName(r io.Reader, name string) *DictFileScanner {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		abs = name
+	}
+	s := &DictFileScanner{h: new(DictFileHeader)}
+	s.push(r, nil, name, abs)
+	return s
+}
+
+// newDictFileScannerRaw creates a new DictFileScanner which doesn't follow
+// include directives and keeps comments (see FormatDictFile). The name is only
+// used for errors.
+func newDictFileScannerRaw(r io.Reader, name string) *DictFileScanner {
+	s := &DictFileScanner{h: new(DictFileHeader), raw: true}
+	s.push(r, nil, name, "")
+	return s
+}
+
+func (s *DictFileScanner) push(r io.Reader, c io.Closer, file, abs string) {
+	br := bufio.NewScanner(r)
+	br.Buffer(make([]byte, 64*1024), 2048*1024) // start with a 64KiB buffer, but allow up to 2MiB (for dictfiles with long lines of raw HTML)
+	fr := &dictFileFrame{br: br, c: c, file: file, abs: abs}
+	if len(s.stack) == 0 {
+		fr.h = s.h
+	}
+	s.stack = append(s.stack, fr)
+}
+
+func (s *DictFileScanner) pop() {
+	if fr := s.stack[len(s.stack)-1]; fr.c != nil {
+		fr.c.Close()
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+// Scan reads the next entry, which will be available through Entry. It returns
+// false when there are no more entries or an error occurs.
+func (s *DictFileScanner) Scan() bool {
+	s.cur = nil
+	if s.err != nil {
+		return false
+	}
+	for len(s.stack) != 0 {
+		fr := s.stack[len(s.stack)-1]
+
+		// open the next included file, if any
+		if len(fr.pending) != 0 {
+			name := fr.pending[0]
+			fr.pending = fr.pending[1:]
+			if s.err = s.include(name, fr); s.err != nil {
+				s.Close()
+				return false
+			}
+			continue
+		}
+
+		// read the next line
+		if !fr.br.Scan() {
+			if err := fr.br.Err(); err != nil {
+				s.err = err
+				s.Close()
+				return false
+			}
+
+			// finish the last entry at the end of each file
+			done, err := s.finish()
+			s.pop()
+			if err != nil {
+				s.err = err
+				s.Close()
+				return false
+			}
+			if done != nil {
+				s.cur = done
+				return true
+			}
+			continue
+		}
+		fr.line++
+
+		done, err := s.processLine(fr, fr.br.Bytes())
+		if err != nil {
+			s.err = err
+			s.Close()
+			return false
+		}
+		if done != nil {
+			s.cur = done
+			return true
+		}
+	}
+	return false
+}
+
+// Entry returns the entry read by the last call to Scan. The entries are not
+// validated.
+func (s *DictFileScanner) Entry() *DictFileEntry {
+	return s.cur
+}
+
+// Header returns the header of the dictfile. It will be complete once the
+// first entry has been read (or Scan returns false). It will never be nil.
+func (s *DictFileScanner) Header() *DictFileHeader {
+	return s.h
+}
+
+// Err returns the first error encountered by Scan.
+func (s *DictFileScanner) Err() error {
+	return s.err
+}
+
+// Close closes any files opened by the scanner. It is not necessary to call it
+// if Scan returned false.
+func (s *DictFileScanner) Close() error {
+	for len(s.stack) != 0 {
+		s.pop()
+	}
+	return nil
+}
+
+// finish finishes and returns the current entry, if any.
+func (s *DictFileScanner) finish() (*DictFileEntry, error) {
+	dfe := s.dfe
+	if dfe == nil {
+		return nil, nil
+	}
+	s.dfe, s.comment = nil, 0
+	if s.raw && dfe.comments {
+		// move trailing comments out of the definition, since they are more
+		// likely to be about the following lines (and comments can't be
+		// followed by more of the definition)
+		lines := strings.Split(strings.TrimRight(dfe.Definition, "\n"), "\n")
+		n := len(lines)
+		for n != 0 && (strings.TrimSpace(lines[n-1]) == "" || strings.HasPrefix(lines[n-1], "//")) {
+			n--
+		}
+		var post []string
+		for _, line := range lines[n:] {
+			if line != "" {
+				post = append(post, line)
+			}
+		}
+		s.pre = append(post, s.pre...)
+
+		dfe.Definition, dfe.comments = strings.Join(lines[:n], "\n"), false
+	}
+	if err := finishDictFileEntry(dfe); err != nil {
+		return nil, err
+	}
+	return dfe, nil
+}
+
+// resolve resolves the path or glob in an include directive.
+func (s *DictFileScanner) resolve(pattern string, fr *dictFileFrame) ([]string, error) {
+	if len(pattern) == 0 {
+		return nil, &DictFileError{fr.file, fr.line, fmt.Errorf("no path after include directive (#include)")}
+	}
+
+	dir := "."
+	if fr.file != "" {
+		dir = filepath.Dir(fr.file)
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	m, err := filepath.Glob(pattern) // note: this is sorted
+	if err != nil {
+		return nil, &DictFileError{fr.file, fr.line, fmt.Errorf("include %#v: %w", pattern, err)}
+	} else if len(m) == 0 {
+		return nil, &DictFileError{fr.file, fr.line, fmt.Errorf("include %#v: no files matched", pattern)}
+	}
+	return m, nil
+}
+
+// include opens an included file.
+func (s *DictFileScanner) include(name string, from *dictFileFrame) error {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return &DictFileError{from.file, from.line, fmt.Errorf("resolve path %#v: %w", name, err)}
+	}
+	for _, fr := range s.stack {
+		if fr.abs == abs {
+			return &DictFileError{from.file, from.line, fmt.Errorf("include cycle: %s includes itself", name)}
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return &DictFileError{from.file, from.line, fmt.Errorf("include %#v: %w", name, err)}
+	}
+	s.push(f, f, name, abs)
+	return nil
+}
+
+// processLine processes a single line, returning the previous entry if it was
+// finished.
+func (s *DictFileScanner) processLine(fr *dictFileFrame, buf []byte) (*DictFileEntry, error) {
+	dfe := s.dfe
+
+	errorf := func(format string, a ...interface{}) error {
+		return &DictFileError{fr.file, fr.line, fmt.Errorf(format, a...)}
+	}
+
+	if len(buf) == 0 {
+		// if in a block and after the metadata (in the definition),
+		// preserve the blank line
+		if dfe != nil && len(dfe.Definition) != 0 {
+			dfe.Definition += "\n"
+		}
+		return nil, nil
+	}
+
+	// comments are ignored entirely, but since lines starting with // used to
+	// be part of the definition, comments within the definition content must
+	// have a space after the // and can't be followed by more of the
+	// definition (so existing dictfiles don't silently lose content)
+	if bytes.HasPrefix(buf, []byte("//")) {
+		if dfe != nil && len(dfe.Definition) != 0 {
+			if len(buf) > 2 && buf[2] != ' ' && buf[2] != '\t' {
+				return nil, errorf("comment (//) without a space after it within definition content (prepend a space if this was intended to be part of the definition itself)")
+			}
+			if s.comment == 0 {
+				s.comment = fr.line
+			}
+		}
+		if s.raw {
+			switch {
+			case dfe == nil && !fr.started && s.h.IsZero():
+				s.hpre = append(s.hpre, string(buf))
+			case dfe == nil:
+				s.pre = append(s.pre, string(buf))
+			case len(dfe.Definition) == 0:
+				dfe.pre = append(dfe.pre, string(buf)) // moved before the entry
+			default:
+				dfe.Definition += string(buf) + "\n"
+				dfe.comments = true
+			}
+		}
+		return nil, nil
+	}
+
+	switch buf[0] {
+	case '#':
+		// if it isn't an include directive, it's part of the definition
+		if !bytes.HasPrefix(buf, []byte("#include")) || (len(buf) > 8 && buf[8] != ' ' && buf[8] != '\t') {
+			goto definition
+		}
+
+		// finish the current entry, since any lines after the include
+		// wouldn't belong to it
+		done, err := s.finish()
+		if err != nil {
+			return nil, err
+		}
+
+		// and queue the included files (or keep the directive as-is)
+		fr.started = true
+		if s.raw {
+			s.pre = append(s.pre, string(buf))
+			return done, nil
+		}
+		if fr.pending, err = s.resolve(strings.TrimSpace(string(buf[8:])), fr); err != nil {
+			return nil, err
+		}
+		return done, nil
+	case '@':
+		// finish the last one
+		done, err := s.finish()
+		if err != nil {
+			return nil, err
+		}
+
+		// start another one
+		dfe = new(DictFileEntry)
+		fr.started = true
+
+		// add the headword and line info
+		dfe.Headword = strings.TrimSpace(string(buf[1:]))
+		dfe.file = fr.file
+		dfe.line = fr.line
+		dfe.pre, s.pre = s.pre, nil
+
+		// but error if the headword is blank (note that duplicates are
+		// acceptable, and encouraged in some cases; Kobo will merge it;
+		// try looking up 'be' in the English dictionary)
+		if len(dfe.Headword) == 0 {
+			return nil, errorf("empty headword after @")
+		}
+
+		// otherwise, make it the current one, and return the last one
+		s.dfe = dfe
+		return done, nil
+	case ':':
+		// if not in a block (before the first @), return an error
+		if dfe == nil {
+			return nil, errorf("header info (: or ::) specified before word (@)")
+		}
+
+		// if already after the metadata (in the definition), return an error
+		if len(dfe.Definition) != 0 {
+			return nil, errorf("header info (: or ::) specified within definition content (prepend a space if this was intended to be part of the definition itself)")
+		}
+
+		// if already seen the header info (a line starting with :)
+		if dfe.NoHeader || len(dfe.HeaderInfo) != 0 {
+			return nil, errorf("multiple header infos (: or ::) specified in definition block")
+		}
+
+		// put the trimmed text in the header info, or disable the header if
+		// it is ::
+		if len(buf) >= 2 {
+			if buf[1] == ':' {
+				if len(strings.TrimSpace(string(buf[2:]))) != 0 {
+					return nil, errorf("extra data after no header specified (::)")
+				}
+				dfe.NoHeader = true
+			} else {
+				dfe.HeaderInfo = strings.TrimSpace(string(buf[1:]))
+			}
+		} else {
+			dfe.HeaderInfo = ""
+		}
+		return nil, nil
+	case '&':
+		// if not in a block, error
+		if dfe == nil {
+			return nil, errorf("variant (&) specified before word (@)")
+		}
+
+		// if already after the metadata (in the definition), error
+		if len(dfe.Definition) != 0 {
+			return nil, errorf("variant (&) specified within definition content (prepend a space if this was intended to be part of the definition itself)")
+		}
+
+		// trim the rest of the line (error if nothing left)
+		v := strings.TrimSpace(string(buf[1:]))
+		if len(v) == 0 {
+			return nil, errorf("no word after variant specifier (&)")
+		}
+
+		// and add it to the variant list
+		dfe.Variant = append(dfe.Variant, v)
+		return nil, nil
+	case '%':
+		// if not in a block, error
+		if dfe == nil {
+			return nil, errorf("attribute (%%) specified before word (@)")
+		}
+
+		// if already after the metadata (in the definition), it's part of
+		// the definition (for compatibility with existing dictfiles)
+		if len(dfe.Definition) != 0 {
+			goto definition
+		}
+
+		// split the key from the value (which may be empty)
+		k, v := strings.TrimSpace(string(buf[1:])), ""
+		if i := strings.IndexFunc(k, unicode.IsSpace); i != -1 {
+			k, v = k[:i], strings.TrimSpace(k[i:])
+		}
+		if len(k) == 0 {
+			return nil, errorf("no key after attribute specifier (%%)")
+		}
+		if !attrKeyRe.MatchString(k) {
+			return nil, errorf("invalid attribute key %#v: must start with a letter and only contain letters, digits, -, and _ (prepend a space if this was intended to be part of the definition itself)", k)
+		}
+
+		// and add it to the attributes
+		if dfe.Attr == nil {
+			dfe.Attr = map[string][]string{}
+		}
+		dfe.Attr[k] = append(dfe.Attr[k], v)
+		return nil, nil
+	}
+
+definition:
+	// if not in a block, it's either part of the header, or an error
+	if dfe == nil {
+		if fr.started {
+			return nil, errorf("definition specified before word (@)")
+		}
+		if fr.h == nil {
+			return nil, errorf("header or definition specified before word (@) (note: headers are not allowed in included dictfiles)")
+		}
+		if err := fr.h.parseLine(string(buf)); err != nil {
+			return nil, errorf("header: %w (note: definitions must not be specified before a word (@))", err)
+		}
+		return nil, nil
+	}
+
+	// error if it's after a comment within the definition content
+	if s.comment != 0 {
+		return nil, &DictFileError{fr.file, s.comment, fmt.Errorf("comment (//) followed by more definition content (prepend a space if this was intended to be part of the definition itself)")}
+	}
+
+	// append the line to the definition
+	dfe.Definition += string(buf) + "\n"
+	return nil, nil
+}
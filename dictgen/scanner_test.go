@@ -0,0 +1,72 @@
+package dictgen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDictFileScanner(t *testing.T) {
+	dir := t.TempDir()
+	for fn, buf := range map[string]string{
+		"main.df":  "title: Test\n\n@ a\nA.\n#include inc/*.df\n@ d\nD.\n",
+		"inc/b.df": "@ b\nB.\n",
+		"inc/c.df": "// c\n\n@ c\n& cc\nC.\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, fn)), 0755); err != nil {
+			t.Fatalf("write test file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(buf), 0644); err != nil {
+			t.Fatalf("write test file: %v", err)
+		}
+	}
+
+	s, err := OpenDictFileScanner(filepath.Join(dir, "main.df"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	var act []string
+	for s.Scan() {
+		dfe := s.Entry()
+		file, line := dfe.Position()
+		rel, _ := filepath.Rel(dir, file)
+		act = append(act, fmt.Sprintf("%s:%s:%d:%q", dfe.Headword, filepath.ToSlash(rel), line, dfe.Definition))
+		if s.Header().Title != "Test" {
+			t.Errorf("expected header to be parsed before the first entry")
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp := []string{`a:main.df:3:"A."`, `b:inc/b.df:1:"B."`, `c:inc/c.df:3:"C."`, `d:main.df:6:"D."`}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("expected entries %q, got %q", exp, act)
+	}
+
+	s = NewDictFileScannerName(strings.NewReader("@ x\n#include inc/b.df\n"), filepath.Join(dir, "unsaved.df"))
+	act = nil
+	for s.Scan() {
+		file, line := s.Entry().Position()
+		act = append(act, fmt.Sprintf("%s:%s:%d", s.Entry().Headword, filepath.Base(file), line))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp := []string{"x:unsaved.df:1", "b:b.df:1"}; !reflect.DeepEqual(act, exp) {
+		t.Errorf("expected entries %q, got %q", exp, act)
+	}
+
+	s = NewDictFileScanner(strings.NewReader("@ a\nA.\n@ b\n:: invalid\n"))
+	if !s.Scan() || s.Entry().Headword != "a" {
+		t.Fatalf("expected first entry to be scanned before the error")
+	}
+	if s.Scan() {
+		t.Errorf("expected scan to fail")
+	} else if err := s.Err(); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected error on line 4, got %v", err)
+	}
+}
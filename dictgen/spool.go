@@ -0,0 +1,181 @@
+package dictgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// spoolBufferSize is the maximum amount of entry data buffered in memory by a
+// Spooler before it is written to the spool files.
+const spoolBufferSize = 16 * 1024 * 1024
+
+// Spooler writes entries to a dictzip without keeping all of them in memory
+// (e.g. when used with DictFileScanner). Since each dicthtml file must contain
+// all entries for a prefix, the entries are spooled to temporary files by
+// prefix, and each prefix is only loaded into memory while its dicthtml file is
+// being generated. Note that the word index is still kept in memory by the
+// kobodict.Writer.
+type Spooler struct {
+	dw    *kobodict.Writer
+	dir   string
+	files map[string]string        // prefix -> spool file
+	buf   map[string]*bytes.Buffer // prefix -> buffered entries
+	size  int
+}
+
+// spoolEntry is the serialized form of an entry in a spool file.
+type spoolEntry struct {
+	*DictFileEntry
+	File string `json:",omitempty"`
+	Line int    `json:",omitempty"`
+}
+
+// NewSpooler creates a new Spooler writing to a kobodict.Writer, which should
+// not have been used yet. The entries are sharded using the writer's prefix
+// function. The spool files are created in a new temporary directory inside
+// dir (or the default one if empty), which is removed by Close.
+func NewSpooler(dw *kobodict.Writer, dir string) (*Spooler, error) {
+	tmp, err := os.MkdirTemp(dir, "dictgen-spool-")
+	if err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	return &Spooler{
+		dw:    dw,
+		dir:   tmp,
+		files: map[string]string{},
+		buf:   map[string]*bytes.Buffer{},
+	}, nil
+}
+
+// Add validates an entry, adds its headword and variants to the index, and
+// spools it for each of its prefixes. The entry can be reused after Add
+// returns.
+func (s *Spooler) Add(dfe *DictFileEntry) error {
+	if err := (DictFile{dfe}).Validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(spoolEntry{dfe, dfe.file, dfe.line})
+	if err != nil {
+		return fmt.Errorf("word %#v: encode entry: %w", dfe.Headword, err)
+	}
+
+	pfx := map[string]bool{}
+	if err := s.dw.AddWord(dfe.Headword); err != nil {
+		return fmt.Errorf("add word %#v: %w", dfe.Headword, err)
+	}
+	pfx[s.dw.Prefix(dfe.Headword)] = true
+	for _, v := range dfe.Variant {
+		if err := s.dw.AddWord(v); err != nil {
+			return fmt.Errorf("add variant %#v: %w", v, err)
+		}
+		pfx[s.dw.Prefix(v)] = true
+	}
+
+	for p := range pfx {
+		b, ok := s.buf[p]
+		if !ok {
+			b = bytes.NewBuffer(nil)
+			s.buf[p] = b
+		}
+		b.Write(buf)
+		b.WriteByte('\n')
+		s.size += len(buf) + 1
+	}
+
+	if s.size > spoolBufferSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush appends the buffered entries to the spool files.
+func (s *Spooler) flush() error {
+	for p, b := range s.buf {
+		fn, ok := s.files[p]
+		if !ok {
+			fn = filepath.Join(s.dir, strconv.Itoa(len(s.files)))
+			s.files[p] = fn
+		}
+		if err := func() error {
+			f, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(b.Bytes()); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}(); err != nil {
+			return fmt.Errorf("write spool file for %s: %w", p, err)
+		}
+		delete(s.buf, p)
+	}
+	s.size = 0
+	return nil
+}
+
+// WriteDictzip writes the dicthtml files for the spooled entries. The writer is
+// not closed automatically. See DictFile.WriteDictzipOptions for details about
+// the arguments.
+func (s *Spooler) WriteDictzip(ih ImageHandler, img ImageFunc, opt *KoboHTMLOptions) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for pfx := range s.files {
+		prefixes = append(prefixes, pfx)
+	}
+	sort.Strings(prefixes)
+
+	hbuf := bytes.NewBuffer(nil)
+	for _, pfx := range prefixes {
+		df, err := readSpoolFile(s.files[pfx])
+		if err != nil {
+			return fmt.Errorf("read spool file for %s: %w", pfx, err)
+		}
+		if err := writeDicthtml(s.dw, pfx, df, hbuf, ih, img, opt); err != nil {
+			return err
+		}
+		if err := os.Remove(s.files[pfx]); err != nil {
+			return fmt.Errorf("remove spool file for %s: %w", pfx, err)
+		}
+		delete(s.files, pfx)
+	}
+	return nil
+}
+
+// Close removes the spool files.
+func (s *Spooler) Close() error {
+	s.buf, s.files, s.size = map[string]*bytes.Buffer{}, map[string]string{}, 0
+	return os.RemoveAll(s.dir)
+}
+
+func readSpoolFile(fn string) (DictFile, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var df DictFile
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		e := spoolEntry{DictFileEntry: new(DictFileEntry)}
+		if err := dec.Decode(&e); err != nil {
+			return nil, err
+		}
+		e.DictFileEntry.file, e.DictFileEntry.line = e.File, e.Line
+		df = append(df, e.DictFileEntry)
+	}
+	return df, nil
+}
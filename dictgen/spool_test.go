@@ -0,0 +1,85 @@
+package dictgen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+func TestSpooler(t *testing.T) {
+	const in = "@ apple\n& Apples\nA fruit.\n@ banana\n& ba\nAnother fruit.\n@ apricot\n<html><p>Also a fruit.</p>\n@ ap\nAn abbreviation.\n"
+
+	df, err := ParseDictFile(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse dictfile: %v", err)
+	}
+
+	exp := bytes.NewBuffer(nil)
+	dw := kobodict.NewWriter(exp)
+	if err := df.WriteDictzip(dw, new(ImageHandlerRemove), ImageFuncFilesystem); err != nil {
+		t.Fatalf("write dictzip: %v", err)
+	} else if err := dw.Close(); err != nil {
+		t.Fatalf("write dictzip: %v", err)
+	}
+
+	act := bytes.NewBuffer(nil)
+	dw = kobodict.NewWriter(act)
+	sp, err := NewSpooler(dw, t.TempDir())
+	if err != nil {
+		t.Fatalf("create spooler: %v", err)
+	}
+	defer sp.Close()
+
+	s := NewDictFileScanner(strings.NewReader(in))
+	for s.Scan() {
+		if err := sp.Add(s.Entry()); err != nil {
+			t.Fatalf("spool entry: %v", err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan dictfile: %v", err)
+	}
+	if err := sp.WriteDictzip(new(ImageHandlerRemove), ImageFuncFilesystem, nil); err != nil {
+		t.Fatalf("write spooled dictzip: %v", err)
+	} else if err := dw.Close(); err != nil {
+		t.Fatalf("write spooled dictzip: %v", err)
+	}
+
+	er, err := kobodict.NewReader(bytes.NewReader(exp.Bytes()), int64(exp.Len()))
+	if err != nil {
+		t.Fatalf("read dictzip: %v", err)
+	}
+	ar, err := kobodict.NewReader(bytes.NewReader(act.Bytes()), int64(act.Len()))
+	if err != nil {
+		t.Fatalf("read spooled dictzip: %v", err)
+	}
+
+	if len(er.Dicthtml) != len(ar.Dicthtml) || len(er.Dicthtml) == 0 {
+		t.Fatalf("expected %d dicthtml files, got %d", len(er.Dicthtml), len(ar.Dicthtml))
+	}
+	for i := range er.Dicthtml {
+		eb, ab := readDicthtml(t, er.Dicthtml[i]), readDicthtml(t, ar.Dicthtml[i])
+		if er.Dicthtml[i].Prefix != ar.Dicthtml[i].Prefix || !bytes.Equal(eb, ab) {
+			t.Errorf("dicthtml %d: expected %s (%s), got %s (%s)", i, er.Dicthtml[i].Prefix, eb, ar.Dicthtml[i].Prefix, ab)
+		}
+	}
+	if strings.Join(er.Word, ",") != strings.Join(ar.Word, ",") {
+		t.Errorf("expected words %q, got %q", er.Word, ar.Word)
+	}
+}
+
+func readDicthtml(t *testing.T, f *kobodict.ReaderDicthtml) []byte {
+	r, err := f.Open()
+	if err != nil {
+		t.Fatalf("open dicthtml %s: %v", f.Name, err)
+	}
+	defer r.Close()
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read dicthtml %s: %v", f.Name, err)
+	}
+	return buf
+}
@@ -0,0 +1,326 @@
+package dictgen
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// StarDictOptions contains options for generating a StarDict dictionary. A nil
+// or zero value uses the defaults.
+type StarDictOptions struct {
+	BookName    string // the name of the dictionary (defaults to the name of the files)
+	Author      string
+	Description string
+
+	Uncompressed bool // write a .dict instead of a .dict.dz
+	NoSynonyms   bool // don't write a .syn with the variants
+
+	// HTML contains the options for generating the HTML of each entry. The
+	// same templates are used as for the dicthtml, but the parts only used by
+	// nickel (the <w>, the <a name="..." /> for the headword, and the <var>)
+	// are removed.
+	HTML *KoboHTMLOptions
+}
+
+// WriteStarDict validates the DictFile and writes it as a StarDict dictionary
+// (name.ifo, name.idx, name.dict.dz or name.dict, and name.syn) to dir, which
+// must already exist. Existing files are overwritten. Each entry is stored as
+// HTML (the h type), and the variants are stored as synonyms. Cross-references
+// are rendered as bword:// links, which are supported by most StarDict
+// readers.
+//
+// Images are handled like WriteDictzip, but ImageHandlerEmbed is not supported
+// since StarDict doesn't have an equivalent to dict:/// URLs.
+func (df DictFile) WriteStarDict(dir, name string, ih ImageHandler, img ImageFunc, opt *StarDictOptions) error {
+	if err := df.Validate(); err != nil {
+		return err
+	}
+	if opt == nil {
+		opt = new(StarDictOptions)
+	}
+	if _, ok := ih.(*ImageHandlerEmbed); ok {
+		return errors.New("embedded images are not supported for StarDict dictionaries")
+	}
+
+	tmpl, check, err := opt.HTML.template()
+	if err != nil {
+		return err
+	}
+
+	// must be sorted in the order used by StarDict for the binary search
+	dfs := append(DictFile(nil), df...)
+	sort.SliceStable(dfs, func(i, j int) bool {
+		return starDictLess(dfs[i].Headword, dfs[j].Headword)
+	})
+
+	type synonym struct {
+		word  string
+		index uint32
+	}
+	var syns []synonym
+
+	idx, dict := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	buf := bytes.NewBuffer(nil)
+	for i, dfe := range dfs {
+		if err := checkStarDictWord(dfe.Headword); err != nil {
+			return fmt.Errorf("word %#v: %w", dfe.Headword, err)
+		}
+
+		e := *dfe
+		e.Definition = renderStarDictReferences(e.Definition)
+
+		buf.Reset()
+		if err := tmpl.Execute(buf, e); err != nil {
+			return fmt.Errorf("word %#v: execute template: %w", dfe.Headword, err)
+		}
+		if check {
+			if err := checkKoboHTMLEntry(e, buf.String()); err != nil {
+				return fmt.Errorf("word %#v: invalid template output: %w", dfe.Headword, err)
+			}
+		}
+
+		html := []byte(stripKoboHTMLEntry(e, buf.String()))
+		if ih != nil {
+			if html, err = transformHTMLImages(ih, nil, html, img); err != nil {
+				return fmt.Errorf("word %#v: transform images: %w", dfe.Headword, err)
+			}
+		}
+
+		if dict.Len()+len(html) > 1<<32-1 {
+			return errors.New("dictionary too large (the .dict must be smaller than 4 GB)")
+		}
+		idx.WriteString(dfe.Headword)
+		idx.WriteByte(0)
+		binary.Write(idx, binary.BigEndian, uint32(dict.Len()))
+		binary.Write(idx, binary.BigEndian, uint32(len(html)))
+		dict.Write(html)
+
+		if !opt.NoSynonyms {
+			for _, v := range dfe.Variant {
+				if v == dfe.Headword {
+					continue
+				}
+				if err := checkStarDictWord(v); err != nil {
+					return fmt.Errorf("word %#v: variant %#v: %w", dfe.Headword, v, err)
+				}
+				syns = append(syns, synonym{v, uint32(i)})
+			}
+		}
+	}
+
+	sort.SliceStable(syns, func(i, j int) bool {
+		return starDictLess(syns[i].word, syns[j].word)
+	})
+	syn := bytes.NewBuffer(nil)
+	for _, s := range syns {
+		syn.WriteString(s.word)
+		syn.WriteByte(0)
+		binary.Write(syn, binary.BigEndian, s.index)
+	}
+
+	bookname := opt.BookName
+	if bookname == "" {
+		bookname = name
+	}
+
+	var ifo strings.Builder
+	ifo.WriteString("StarDict's dict ifo file\n")
+	ifo.WriteString("version=2.4.2\n")
+	ifo.WriteString("bookname=" + starDictIfoValue(bookname) + "\n")
+	ifo.WriteString("wordcount=" + strconv.Itoa(len(dfs)) + "\n")
+	if len(syns) != 0 {
+		ifo.WriteString("synwordcount=" + strconv.Itoa(len(syns)) + "\n")
+	}
+	ifo.WriteString("idxfilesize=" + strconv.Itoa(idx.Len()) + "\n")
+	if opt.Author != "" {
+		ifo.WriteString("author=" + starDictIfoValue(opt.Author) + "\n")
+	}
+	if opt.Description != "" {
+		ifo.WriteString("description=" + starDictIfoValue(opt.Description) + "\n")
+	}
+	ifo.WriteString("sametypesequence=h\n")
+
+	base := filepath.Join(dir, name)
+	if err := os.WriteFile(base+".ifo", []byte(ifo.String()), 0644); err != nil {
+		return fmt.Errorf("write ifo: %w", err)
+	}
+	if err := os.WriteFile(base+".idx", idx.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write idx: %w", err)
+	}
+	if opt.Uncompressed {
+		if err := os.WriteFile(base+".dict", dict.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write dict: %w", err)
+		}
+	} else {
+		f, err := os.OpenFile(base+".dict.dz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("write dict: %w", err)
+		}
+		if err := writeDictDz(f, dict.Bytes()); err != nil {
+			f.Close()
+			return fmt.Errorf("write dict: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("write dict: %w", err)
+		}
+	}
+	if len(syns) != 0 {
+		if err := os.WriteFile(base+".syn", syn.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write syn: %w", err)
+		}
+	} else if err := os.Remove(base + ".syn"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove old syn: %w", err)
+	}
+	return nil
+}
+
+// renderStarDictReferences is like renderReferences, but renders the
+// cross-references as bword:// links.
+func renderStarDictReferences(s string) string {
+	if !strings.Contains(s, "[[") {
+		return s
+	}
+	return xrefRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := xrefRe.FindStringSubmatch(m)
+		target, label := strings.TrimSpace(sm[1]), strings.TrimSpace(sm[2])
+		if label == "" {
+			label = target
+		}
+		return `<a class="xref" href="bword://` + strings.ReplaceAll(target, `"`, "&quot;") + `">` + label + `</a>`
+	})
+}
+
+// stripKoboHTMLEntry removes the parts of the HTML for an entry which are only
+// used by nickel. The HTML must have been checked by checkKoboHTMLEntry (or
+// generated by the default template).
+func stripKoboHTMLEntry(dfe DictFileEntry, html string) string {
+	html = strings.TrimSuffix(strings.TrimPrefix(html, "<w>"), "</w>")
+	html = strings.Replace(html, `<a name="`+kobodict.NormalizeWordReference(dfe.Headword, false)+`" />`, "", 1)
+	if i := strings.Index(html, "<var>"); i != -1 {
+		if j := strings.Index(html[i:], "</var>"); j != -1 {
+			html = html[:i] + html[i+j+len("</var>"):]
+		}
+	}
+	return html
+}
+
+// checkStarDictWord checks if a word can be stored in a StarDict index.
+func checkStarDictWord(word string) error {
+	if len(word) >= 256 {
+		return errors.New("too long for StarDict (must be less than 256 bytes)")
+	}
+	if strings.ContainsRune(word, 0) {
+		return errors.New("contains a null byte")
+	}
+	return nil
+}
+
+// starDictIfoValue makes a value safe for the ifo, which is line-based.
+func starDictIfoValue(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(s), "\r", ""), "\n", "<br>")
+}
+
+// starDictLess sorts words in the same order as stardict_strcmp, i.e. an ASCII
+// case-insensitive comparison, then a byte-wise one for ties.
+func starDictLess(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if x, y := asciiLower(a[i]), asciiLower(b[i]); x != y {
+			return x < y
+		}
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func asciiLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// dictDzChunkLen is the size of the uncompressed chunks in a .dict.dz (this is
+// the same as the one used by dictzip).
+const dictDzChunkLen = 58315
+
+// writeDictDz writes data in the dictzip format, which is a gzip file where
+// the data is compressed in independent chunks, with an extra header field
+// (RA) containing the compressed size of each chunk to allow random access.
+func writeDictDz(w io.Writer, data []byte) error {
+	n := (len(data) + dictDzChunkLen - 1) / dictDzChunkLen
+	if n == 0 {
+		n = 1
+	}
+	if 10+2*n > 0xFFFF {
+		return errors.New("data too large for dictzip")
+	}
+
+	zbuf := bytes.NewBuffer(nil)
+	zw, err := flate.NewWriter(zbuf, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	sizes := make([]int, n)
+	for i := 0; i < n; i++ {
+		start := zbuf.Len()
+		chunk := data[min(i*dictDzChunkLen, len(data)):min((i+1)*dictDzChunkLen, len(data))]
+
+		// reset the compressor so the chunk doesn't reference earlier ones,
+		// then flush it so it ends on a byte boundary
+		zw.Reset(zbuf)
+		if _, err := zw.Write(chunk); err != nil {
+			return err
+		}
+		if i == n-1 {
+			err = zw.Close()
+		} else {
+			err = zw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		if sizes[i] = zbuf.Len() - start; sizes[i] > 0xFFFF {
+			return fmt.Errorf("compressed chunk %d too large", i)
+		}
+	}
+
+	extra := make([]byte, 0, 10+2*n)
+	extra = append(extra, 'R', 'A')
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(6+2*n))
+	extra = binary.LittleEndian.AppendUint16(extra, 1) // version
+	extra = binary.LittleEndian.AppendUint16(extra, dictDzChunkLen)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(n))
+	for _, sz := range sizes {
+		extra = binary.LittleEndian.AppendUint16(extra, uint16(sz))
+	}
+
+	hdr := []byte{0x1f, 0x8b, 8, 1 << 2, 0, 0, 0, 0, 2, 3} // deflate, FEXTRA, no mtime, max compression, unix
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(len(extra)))
+	hdr = append(hdr, extra...)
+
+	tlr := binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	tlr = binary.LittleEndian.AppendUint32(tlr, uint32(len(data)))
+
+	for _, b := range [][]byte{hdr, zbuf.Bytes(), tlr} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package dictgen
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteStarDict(t *testing.T) {
+	df, err := ParseDictFile(strings.NewReader("@ banana\n& Bananas\n& banana\nA fruit, see [[apple|apples]].\n@ Apple\n& apples\nA *fruit*.\n@ apple\nA company.\n@ _b\nAn underscore.\n"))
+	if err != nil {
+		t.Fatalf("parse dictfile: %v", err)
+	}
+
+	for _, uncompressed := range []bool{false, true} {
+		dir := t.TempDir()
+		if err := df.WriteStarDict(dir, "test", new(ImageHandlerRemove), ImageFuncFilesystem, &StarDictOptions{
+			Author:       "Someone",
+			Description:  "Line 1\nLine 2",
+			Uncompressed: uncompressed,
+		}); err != nil {
+			t.Fatalf("write stardict: %v", err)
+		}
+
+		var dict []byte
+		if uncompressed {
+			dict = readFile(t, dir, "test.dict")
+		} else {
+			zr, err := gzip.NewReader(bytes.NewReader(readFile(t, dir, "test.dict.dz")))
+			if err != nil {
+				t.Fatalf("read dict.dz: %v", err)
+			}
+			if dict, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("read dict.dz: %v", err)
+			}
+		}
+
+		idx := readFile(t, dir, "test.idx")
+		if exp := "StarDict's dict ifo file\nversion=2.4.2\nbookname=test\nwordcount=4\nsynwordcount=2\nidxfilesize=" + strconv.Itoa(len(idx)) + "\nauthor=Someone\ndescription=Line 1<br>Line 2\nsametypesequence=h\n"; string(readFile(t, dir, "test.ifo")) != exp {
+			t.Errorf("expected ifo:\n%s\ngot:\n%s", exp, readFile(t, dir, "test.ifo"))
+		}
+
+		var words, defs []string
+		for len(idx) != 0 {
+			i := bytes.IndexByte(idx, 0)
+			off, sz := binary.BigEndian.Uint32(idx[i+1:]), binary.BigEndian.Uint32(idx[i+5:])
+			words = append(words, string(idx[:i]))
+			defs = append(defs, string(dict[off:off+sz]))
+			idx = idx[i+9:]
+		}
+		if exp := []string{"_b", "Apple", "apple", "banana"}; !reflect.DeepEqual(words, exp) {
+			t.Errorf("expected words %q, got %q", exp, words)
+		}
+		if exp := `<p><b>banana</b></p><p>A fruit, see <a class="xref" href="bword://apple">apples</a>.</p>`; defs[3] != exp {
+			t.Errorf("expected definition %q, got %q", exp, defs[3])
+		}
+
+		var syns []string
+		syn := readFile(t, dir, "test.syn")
+		for len(syn) != 0 {
+			i := bytes.IndexByte(syn, 0)
+			syns = append(syns, string(syn[:i])+"="+words[binary.BigEndian.Uint32(syn[i+1:])])
+			syn = syn[i+5:]
+		}
+		if exp := []string{"apples=Apple", "Bananas=banana"}; !reflect.DeepEqual(syns, exp) {
+			t.Errorf("expected synonyms %q, got %q", exp, syns)
+		}
+	}
+}
+
+func TestWriteDictDz(t *testing.T) {
+	data := make([]byte, dictDzChunkLen*2+1234)
+	rand.New(rand.NewSource(0)).Read(data[:dictDzChunkLen]) // incompressible
+	copy(data[dictDzChunkLen:], strings.Repeat("compressible ", len(data)/13))
+
+	buf := bytes.NewBuffer(nil)
+	if err := writeDictDz(buf, data); err != nil {
+		t.Fatalf("write dict.dz: %v", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("read dict.dz: %v", err)
+	}
+	if b, err := io.ReadAll(zr); err != nil {
+		t.Fatalf("read dict.dz: %v", err)
+	} else if !bytes.Equal(b, data) {
+		t.Errorf("decompressed data doesn't match")
+	}
+
+	// each chunk must be decompressible by itself
+	extra := zr.Header.Extra
+	if string(extra[:2]) != "RA" || binary.LittleEndian.Uint16(extra[6:]) != dictDzChunkLen || binary.LittleEndian.Uint16(extra[8:]) != 3 {
+		t.Fatalf("invalid RA header %x", extra)
+	}
+	off := 12 + len(extra)
+	for i := 0; i < 3; i++ {
+		sz := int(binary.LittleEndian.Uint16(extra[10+2*i:]))
+		exp := data[i*dictDzChunkLen : min((i+1)*dictDzChunkLen, len(data))]
+		b := make([]byte, len(exp))
+		if _, err := io.ReadFull(flate.NewReader(bytes.NewReader(buf.Bytes()[off:off+sz])), b); err != nil {
+			t.Errorf("chunk %d: decompress: %v", i, err)
+		} else if !bytes.Equal(b, exp) {
+			t.Errorf("chunk %d: decompressed data doesn't match", i)
+		}
+		off += sz
+	}
+}
+
+func readFile(t *testing.T, dir, name string) []byte {
+	buf, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return buf
+}
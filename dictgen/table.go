@@ -0,0 +1,455 @@
+package dictgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TableFormat is a format for tabular data which can be read by a
+// TableScanner.
+type TableFormat string
+
+// Table formats.
+const (
+	TableCSV   TableFormat = "csv"   // comma-separated values, where the first row contains the column names
+	TableTSV   TableFormat = "tsv"   // tab-separated values, where the first row contains the column names
+	TableJSON  TableFormat = "json"  // an array of objects
+	TableJSONL TableFormat = "jsonl" // an object on each line (JSON Lines)
+)
+
+// TableFormatFor returns the table format for a filename based on the
+// extension, or false if it isn't one.
+func TableFormatFor(name string) (TableFormat, bool) {
+	switch f := TableFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))); f {
+	case TableCSV, TableTSV, TableJSON, TableJSONL:
+		return f, true
+	}
+	return "", false
+}
+
+// TableMapping specifies which columns (or object keys, for JSON) of tabular
+// data are used for the fields of dictfile entries.
+type TableMapping struct {
+	Headword   string   // required
+	Variant    []string // optional
+	VariantSep string   // if not empty, the values of the variant columns are split on it (JSON arrays are always split)
+	HeaderInfo string   // optional
+	Definition string   // required
+	HTML       bool     // the definition is raw HTML instead of Markdown
+}
+
+// ParseTableMapping parses a mapping spec, which is a comma-separated list of
+// key=value pairs, where the key is headword, variant (can be specified
+// multiple times), variant-sep, info, definition, or format (markdown or
+// html). Pairs containing commas or quotes can be quoted like CSV fields (e.g.
+// "variant-sep=,").
+func ParseTableMapping(spec string) (*TableMapping, error) {
+	cr := csv.NewReader(strings.NewReader(spec))
+	cr.TrimLeadingSpace = true
+	pairs, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("parse mapping: %w", err)
+	}
+
+	m := new(TableMapping)
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		spl := strings.SplitN(pair, "=", 2)
+		if len(spl) != 2 {
+			return nil, fmt.Errorf("invalid pair %#v: expected key=value", pair)
+		}
+		switch k, v := strings.TrimSpace(spl[0]), spl[1]; k {
+		case "headword":
+			m.Headword = v
+		case "variant":
+			m.Variant = append(m.Variant, v)
+		case "variant-sep":
+			m.VariantSep = v
+		case "info":
+			m.HeaderInfo = v
+		case "definition":
+			m.Definition = v
+		case "format":
+			switch v {
+			case "markdown":
+				m.HTML = false
+			case "html":
+				m.HTML = true
+			default:
+				return nil, fmt.Errorf("unknown definition format %#v (expected markdown or html)", v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %#v", k)
+		}
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *TableMapping) validate() error {
+	if m.Headword == "" {
+		return errors.New("no headword column specified")
+	}
+	if m.Definition == "" {
+		return errors.New("no definition column specified")
+	}
+	return nil
+}
+
+// columns returns the mapped columns.
+func (m *TableMapping) columns() []string {
+	cs := []string{m.Headword, m.Definition}
+	if m.HeaderInfo != "" {
+		cs = append(cs, m.HeaderInfo)
+	}
+	return append(cs, m.Variant...)
+}
+
+// TableScanner reads dictfile entries from tabular data (e.g. a glossary
+// exported from a spreadsheet) one record at a time. The position of each
+// entry is the row number for CSV and TSV (where the column names are row 1),
+// or the line number for JSON and JSON Lines, so errors can be traced back to
+// the record. JSON arrays are read into memory in full first (to find the line
+// numbers), but the other formats are streamed.
+//
+// The mapped columns must be present in the CSV/TSV header row, and the
+// headword and definition keys must be present in every JSON/JSONL object
+// (null is allowed).
+type TableScanner struct {
+	m    TableMapping
+	file string
+	c    io.Closer // nil if not opened by the scanner
+	next func() (map[string][]string, int, error)
+
+	h   *DictFileHeader
+	cur *DictFileEntry
+	err error
+}
+
+// NewTableScanner creates a new TableScanner reading from r.
+func NewTableScanner(r io.Reader, format TableFormat, m *TableMapping) (*TableScanner, error) {
+	return newTableScanner(r, nil, "", format, m)
+}
+
+// OpenTableScanner creates a new TableScanner reading from the specified file,
+// with the format based on the extension (see TableFormatFor). Errors will
+// contain the filename. The scanner must be closed if it isn't read until the
+// end.
+func OpenTableScanner(name string, m *TableMapping) (*TableScanner, error) {
+	format, ok := TableFormatFor(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown table format for %#v", name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newTableScanner(f, f, name, format, m)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newTableScanner(r io.Reader, c io.Closer, file string, format TableFormat, m *TableMapping) (*TableScanner, error) {
+	if m == nil {
+		return nil, errors.New("no mapping specified")
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	s := &TableScanner{m: *m, file: file, c: c, h: new(DictFileHeader)}
+
+	var err error
+	switch format {
+	case TableCSV:
+		s.next, err = s.readCSV(r, ',')
+	case TableTSV:
+		s.next, err = s.readCSV(r, '\t')
+	case TableJSON:
+		s.next, err = s.readJSON(r)
+	case TableJSONL:
+		s.next, err = s.readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown table format %#v", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Scan reads the next entry, which will be available through Entry. Records
+// where all of the mapped columns are empty are ignored. It returns false when
+// there are no more entries or an error occurs.
+func (s *TableScanner) Scan() bool {
+	s.cur = nil
+	if s.err != nil || s.next == nil {
+		return false
+	}
+	for {
+		rec, line, err := s.next()
+		if err == io.EOF {
+			s.Close()
+			return false
+		} else if err != nil {
+			s.err = &DictFileError{s.file, line, err}
+			s.Close()
+			return false
+		}
+
+		var empty = true
+		for _, c := range s.m.columns() {
+			for _, v := range rec[c] {
+				if strings.TrimSpace(v) != "" {
+					empty = false
+				}
+			}
+		}
+		if empty {
+			continue
+		}
+
+		dfe := &DictFileEntry{
+			Headword:   strings.TrimSpace(strings.Join(rec[s.m.Headword], " ")),
+			HeaderInfo: strings.TrimSpace(strings.Join(rec[s.m.HeaderInfo], " ")),
+			RawHTML:    s.m.HTML,
+			Definition: strings.Join(rec[s.m.Definition], "\n"),
+			file:       s.file,
+			line:       line,
+		}
+		for _, c := range s.m.Variant {
+			for _, v := range rec[c] {
+				vs := []string{v}
+				if s.m.VariantSep != "" {
+					vs = strings.Split(v, s.m.VariantSep)
+				}
+				for _, v := range vs {
+					if v = strings.TrimSpace(v); v != "" {
+						dfe.Variant = append(dfe.Variant, v)
+					}
+				}
+			}
+		}
+		if err := finishDictFileEntry(dfe); err != nil {
+			s.err = err
+			s.Close()
+			return false
+		}
+		s.cur = dfe
+		return true
+	}
+}
+
+// Entry returns the entry read by the last call to Scan. The entries are not
+// validated.
+func (s *TableScanner) Entry() *DictFileEntry {
+	return s.cur
+}
+
+// Header returns an empty header, since tabular data doesn't have one. It is
+// only provided for consistency with DictFileScanner, and will never be nil.
+func (s *TableScanner) Header() *DictFileHeader {
+	return s.h
+}
+
+// Err returns the first error encountered by Scan.
+func (s *TableScanner) Err() error {
+	return s.err
+}
+
+// Close closes the file opened by the scanner. It is not necessary to call it
+// if Scan returned false.
+func (s *TableScanner) Close() error {
+	s.next = nil
+	if s.c != nil {
+		err := s.c.Close()
+		s.c = nil
+		return err
+	}
+	return nil
+}
+
+// readCSV reads the column names from the first row, and returns a function
+// which reads the next record.
+func (s *TableScanner) readCSV(r io.Reader, comma rune) (func() (map[string][]string, int, error), error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.LazyQuotes = comma == '\t' // quotes usually aren't escaped in TSV
+	cr.ReuseRecord = true
+
+	hdr, err := cr.Read()
+	if err == io.EOF {
+		return func() (map[string][]string, int, error) { return nil, 0, io.EOF }, nil
+	} else if err != nil {
+		return nil, s.wrapErr(fmt.Errorf("read column names: %w", err))
+	}
+	cols := map[string]int{}
+	for i, c := range hdr {
+		if i == 0 {
+			c = strings.TrimPrefix(c, "\ufeff") // spreadsheets often add a BOM
+		}
+		if c = strings.TrimSpace(c); c != "" {
+			if _, ok := cols[c]; !ok {
+				cols[c] = i
+			}
+		}
+	}
+	for _, c := range s.m.columns() {
+		if _, ok := cols[c]; !ok {
+			return nil, s.wrapErr(fmt.Errorf("column %#v not found", c))
+		}
+	}
+
+	row := 1
+	return func() (map[string][]string, int, error) {
+		rec, err := cr.Read()
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				return nil, row + 1, pe.Err // the position is from the row count instead
+			}
+			return nil, row, err
+		}
+		row++
+		m := make(map[string][]string, len(s.m.columns()))
+		for _, c := range s.m.columns() {
+			m[c] = []string{rec[cols[c]]}
+		}
+		return m, row, nil
+	}, nil
+}
+
+// readJSON returns a function which reads the next object from an array. The
+// entire input is buffered so the line numbers can be determined from the
+// decoder offset.
+func (s *TableScanner) readJSON(r io.Reader) (func() (map[string][]string, int, error), error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, s.wrapErr(err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	if t, err := d.Token(); err != nil {
+		return nil, s.wrapErr(err)
+	} else if t != json.Delim('[') {
+		return nil, s.wrapErr(errors.New("expected an array of objects"))
+	}
+
+	line, off := 1, 0
+	return func() (map[string][]string, int, error) {
+		// find the line the next value starts on
+		n := int(d.InputOffset())
+		for n < len(buf) && (buf[n] == ',' || buf[n] == ' ' || buf[n] == '\t' || buf[n] == '\r' || buf[n] == '\n') {
+			n++
+		}
+		line += bytes.Count(buf[off:n], []byte("\n"))
+		off = n
+
+		if !d.More() {
+			if _, err := d.Token(); err != nil {
+				return nil, line, err
+			}
+			return nil, line, io.EOF
+		}
+		var obj map[string]interface{}
+		if err := d.Decode(&obj); err != nil {
+			return nil, line, err
+		}
+		rec, err := s.tableRecord(obj)
+		return rec, line, err
+	}, nil
+}
+
+// readJSONL returns a function which reads the object on the next non-empty
+// line.
+func (s *TableScanner) readJSONL(r io.Reader) (func() (map[string][]string, int, error), error) {
+	br := bufio.NewReader(r)
+	var line int
+	return func() (map[string][]string, int, error) {
+		for {
+			buf, err := br.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, line, err
+			}
+			if len(buf) == 0 && err == io.EOF {
+				return nil, line, io.EOF
+			}
+			line++
+
+			if buf = bytes.TrimSpace(buf); len(buf) == 0 {
+				continue
+			}
+
+			d := json.NewDecoder(bytes.NewReader(buf))
+			d.UseNumber()
+			var obj map[string]interface{}
+			if err := d.Decode(&obj); err != nil {
+				return nil, line, err
+			}
+			if d.More() {
+				return nil, line, errors.New("expected a single object")
+			}
+			rec, err := s.tableRecord(obj)
+			return rec, line, err
+		}
+	}, nil
+}
+
+// tableRecord converts the values of a JSON object into strings. Arrays are
+// converted into multiple values. The headword and definition keys must be
+// present.
+func (s *TableScanner) tableRecord(obj map[string]interface{}) (map[string][]string, error) {
+	if obj == nil {
+		return nil, errors.New("expected an object")
+	}
+	for _, c := range []string{s.m.Headword, s.m.Definition} {
+		if _, ok := obj[c]; !ok {
+			return nil, fmt.Errorf("key %#v not found", c)
+		}
+	}
+	rec := make(map[string][]string, len(obj))
+	for k, v := range obj {
+		vs, ok := v.([]interface{})
+		if !ok {
+			vs = []interface{}{v}
+		}
+		for _, v := range vs {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				rec[k] = append(rec[k], v)
+			case json.Number:
+				rec[k] = append(rec[k], v.String())
+			case bool:
+				rec[k] = append(rec[k], fmt.Sprint(v))
+			default:
+				return nil, fmt.Errorf("key %#v: unsupported value type %T", k, v)
+			}
+		}
+	}
+	return rec, nil
+}
+
+// wrapErr adds the filename (if any) to an error.
+func (s *TableScanner) wrapErr(err error) error {
+	if s.file != "" {
+		return fmt.Errorf("%s: %w", s.file, err)
+	}
+	return err
+}
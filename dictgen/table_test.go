@@ -0,0 +1,148 @@
+package dictgen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTableMapping(t *testing.T) {
+	for _, c := range []struct {
+		Spec string
+		Map  *TableMapping
+		Err  string
+	}{
+		{Spec: "headword=Term,definition=Meaning", Map: &TableMapping{Headword: "Term", Definition: "Meaning"}},
+		{Spec: `headword=Term, variant=Plural, variant=See also, "variant-sep=,", info=Part of speech, definition=Meaning, format=html`, Map: &TableMapping{Headword: "Term", Variant: []string{"Plural", "See also"}, VariantSep: ",", HeaderInfo: "Part of speech", Definition: "Meaning", HTML: true}},
+		{Spec: "headword=Term", Err: "no definition column specified"},
+		{Spec: "definition=Meaning", Err: "no headword column specified"},
+		{Spec: "headword=Term,definition=Meaning,format=rst", Err: `unknown definition format "rst" (expected markdown or html)`},
+		{Spec: "headword=Term,definition=Meaning,example=Example", Err: `unknown key "example"`},
+		{Spec: "headword=Term,Meaning", Err: `invalid pair "Meaning": expected key=value`},
+	} {
+		m, err := ParseTableMapping(c.Spec)
+		if c.Err != "" {
+			if err == nil || err.Error() != c.Err {
+				t.Errorf("%q: expected error %q, got %v", c.Spec, c.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.Spec, err)
+		} else if !reflect.DeepEqual(m, c.Map) {
+			t.Errorf("%q: expected %+v, got %+v", c.Spec, c.Map, m)
+		}
+	}
+}
+
+func TestTableScanner(t *testing.T) {
+	m := &TableMapping{
+		Headword:   "term",
+		Variant:    []string{"forms"},
+		VariantSep: ";",
+		HeaderInfo: "pos",
+		Definition: "def",
+	}
+	for _, c := range []struct {
+		Name string
+		In   string
+		Out  []string
+	}{
+		{
+			Name: "test.csv",
+			In:   "\ufeffterm,pos,forms,def,notes\nfoo,noun,foos; fooes,\"A *foo*,\nsecond line.\",x\n,,,,y\nbar,,,<html><b>Bar</b>,\n",
+			Out: []string{
+				`2:foo:["foos" "fooes"]:noun:false:"A *foo*,\nsecond line."`,
+				`4:bar:[]::true:"<b>Bar</b>"`,
+			},
+		},
+		{
+			Name: "test.tsv",
+			In:   "def\tterm\tforms\tpos\nA \"quoted\" foo.\tfoo\tfoos\tnoun\n",
+			Out: []string{
+				`2:foo:["foos"]:noun:false:"A \"quoted\" foo."`,
+			},
+		},
+		{
+			Name: "test.json",
+			In:   "[\n  {\"term\": \"foo\", \"pos\": \"noun\", \"forms\": [\"foos\", \"a;b\"], \"def\": \"A foo.\"},\n\n  {\n    \"term\": \"bar\", \"def\": 1.5, \"forms\": null\n  }\n]\n",
+			Out: []string{
+				`2:foo:["foos" "a" "b"]:noun:false:"A foo."`,
+				`4:bar:[]::false:"1.5"`,
+			},
+		},
+		{
+			Name: "test.jsonl",
+			In:   "{\"term\": \"foo\", \"def\": \"A foo.\"}\n\n{\"term\": \"bar\", \"def\": \"A bar.\", \"pos\": \"noun\"}",
+			Out: []string{
+				`1:foo:[]::false:"A foo."`,
+				`3:bar:[]:noun:false:"A bar."`,
+			},
+		},
+	} {
+		t.Run(c.Name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), c.Name)
+			if err := os.WriteFile(fn, []byte(c.In), 0644); err != nil {
+				t.Fatalf("write test file: %v", err)
+			}
+
+			s, err := OpenTableScanner(fn, m)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer s.Close()
+
+			var act []string
+			for s.Scan() {
+				dfe := s.Entry()
+				file, line := dfe.Position()
+				if file != fn {
+					t.Errorf("expected file %q, got %q", fn, file)
+				}
+				act = append(act, fmt.Sprintf("%d:%s:%q:%s:%t:%q", line, dfe.Headword, dfe.Variant, dfe.HeaderInfo, dfe.RawHTML, dfe.Definition))
+			}
+			if err := s.Err(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(act, c.Out) {
+				t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(c.Out, "\n"), strings.Join(act, "\n"))
+			}
+		})
+	}
+}
+
+func TestTableScannerErrors(t *testing.T) {
+	m := &TableMapping{Headword: "term", Definition: "def"}
+	for _, c := range []struct {
+		Format TableFormat
+		In     string
+		Err    string
+	}{
+		{TableCSV, "term,meaning\nfoo,bar\n", `column "def" not found`},
+		{TableCSV, "term,def\nfoo,bar\nbaz\n", `dictfile: line 3: wrong number of fields`},
+		{TableJSON, `{"term": "foo"}`, `expected an array of objects`},
+		{TableJSON, "[\n{\"term\": \"foo\", \"def\": \"bar\"},\n{\"term\": {}, \"def\": \"bar\"}]", `dictfile: line 3: key "term": unsupported value type map[string]interface {}`},
+		{TableJSONL, "{\"term\": \"foo\", \"def\": \"bar\"}\n[]\n", `dictfile: line 2: json: cannot unmarshal array into Go value of type map[string]interface {}`},
+		{TableJSONL, "{\"term\": \"foo\", \"def\": \"bar\"} {}\n", `dictfile: line 1: expected a single object`},
+		{TableJSON, "[\n{\"term\": \"foo\", \"def\": \"bar\"},\n{\"term\": \"baz\", \"meaning\": \"qux\"}]", `dictfile: line 3: key "def" not found`},
+		{TableJSONL, "{\"term\": \"foo\", \"def\": \"bar\"}\n{\"def\": \"qux\"}\n", `dictfile: line 2: key "term" not found`},
+		{TableJSONL, "\n{\"term\": \"say \\\"hi\\\"\", \"def\": \"bar\"}\n", `dictfile: line 2: word "say \"hi\"" (i:0): headword contains illegal string: must not contain "\""`},
+	} {
+		s, err := NewTableScanner(strings.NewReader(c.In), c.Format, m)
+		if err == nil {
+			var df DictFile
+			for s.Scan() {
+				df = append(df, s.Entry())
+			}
+			if err = s.Err(); err == nil {
+				err = df.Validate()
+			}
+		}
+		if err == nil || err.Error() != c.Err {
+			t.Errorf("%s %q: expected error %q, got %v", c.Format, c.In, c.Err, err)
+		}
+	}
+}
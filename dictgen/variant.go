@@ -0,0 +1,202 @@
+package dictgen
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pgaskin/dictutil/kobodict"
+	"golang.org/x/text/unicode/norm"
+)
+
+// VariantGenerator derives additional variants for entries, so words selected
+// in books match the headwords even if they are written slightly differently
+// (e.g. with curly apostrophes or ligatures). All forms are disabled by
+// default.
+type VariantGenerator struct {
+	// Apostrophes swaps straight and curly apostrophes.
+	Apostrophes bool
+	// Hyphens generates hyphenated (including with non-breaking hyphens),
+	// space-separated, and joined forms of words containing hyphens or spaces.
+	Hyphens bool
+	// Normalization generates the NFC and NFD forms.
+	Normalization bool
+	// Accents generates a form with the diacritics removed.
+	Accents bool
+	// Ligatures expands ligatures (e.g. œ to oe), and generates forms with the
+	// typographic ligatures used in books (e.g. fi to ﬁ).
+	Ligatures bool
+	// Max is the maximum number of variants to generate for a single word. If
+	// zero, it defaults to 32.
+	Max int
+}
+
+// ParseVariantGenerator parses a comma-separated list of variant forms
+// (apostrophe, hyphen, normalization, accent, ligature, or all).
+func ParseVariantGenerator(forms string) (*VariantGenerator, error) {
+	vg := new(VariantGenerator)
+	for _, f := range strings.Split(forms, ",") {
+		switch strings.TrimSpace(f) {
+		case "apostrophe":
+			vg.Apostrophes = true
+		case "hyphen":
+			vg.Hyphens = true
+		case "normalization":
+			vg.Normalization = true
+		case "accent":
+			vg.Accents = true
+		case "ligature":
+			vg.Ligatures = true
+		case "all":
+			vg.Apostrophes, vg.Hyphens, vg.Normalization, vg.Accents, vg.Ligatures = true, true, true, true, true
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown variant form %#v", f)
+		}
+	}
+	return vg, nil
+}
+
+// Apply adds the generated variants for the headword and existing variants of
+// each entry in the DictFile. Variants which are the same as the headword or
+// an existing variant (after normalization) are skipped. Since the generated
+// variants are added to the entries, they will be placed in the correct
+// dicthtml files by Prefixed.
+func (vg *VariantGenerator) Apply(df DictFile) {
+	for _, dfe := range df {
+		seen := map[string]bool{
+			kobodict.NormalizeWordReference(dfe.Headword, true): true,
+		}
+		for _, v := range dfe.Variant {
+			seen[kobodict.NormalizeWordReference(v, true)] = true
+		}
+
+		words := append([]string{dfe.Headword}, dfe.Variant...)
+		for _, w := range words {
+			for _, v := range vg.Variants(w) {
+				if n := kobodict.NormalizeWordReference(v, true); !seen[n] {
+					seen[n] = true
+					dfe.Variant = append(dfe.Variant, v)
+				}
+			}
+		}
+	}
+}
+
+// Variants returns the variants generated for a single word, not including
+// the word itself.
+func (vg *VariantGenerator) Variants(word string) []string {
+	max := vg.Max
+	if max == 0 {
+		max = 32
+	}
+
+	var fns []func(string) []string
+	if vg.Normalization {
+		fns = append(fns, variantNormalization)
+	}
+	if vg.Accents {
+		fns = append(fns, variantAccents)
+	}
+	if vg.Ligatures {
+		fns = append(fns, variantLigatures)
+	}
+	if vg.Apostrophes {
+		fns = append(fns, variantApostrophes)
+	}
+	if vg.Hyphens {
+		fns = append(fns, variantHyphens)
+	}
+
+	// apply each transformation to the word and all forms generated so far, so
+	// combinations are also generated (e.g. accent-stripped and joined)
+	var variants []string
+	seen := map[string]bool{word: true}
+	for _, fn := range fns {
+		for _, f := range append([]string{word}, variants...) {
+			for _, v := range fn(f) {
+				if v = strings.TrimSpace(v); v == "" || seen[v] || strings.Contains(v, "\"") {
+					continue
+				}
+				if len(variants) >= max {
+					return variants
+				}
+				seen[v] = true
+				variants = append(variants, v)
+			}
+		}
+	}
+	return variants
+}
+
+func variantNormalization(w string) []string {
+	return []string{norm.NFC.String(w), norm.NFD.String(w)}
+}
+
+func variantAccents(w string) []string {
+	var b strings.Builder
+	for _, c := range norm.NFD.String(w) {
+		if !unicode.Is(unicode.Mn, c) {
+			b.WriteRune(c)
+		}
+	}
+	return []string{norm.NFC.String(b.String())}
+}
+
+var (
+	variantLigatureExpand = strings.NewReplacer(
+		"ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st",
+		"æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE", "ĳ", "ij", "Ĳ", "IJ",
+	)
+	variantLigatureContract = strings.NewReplacer(
+		"ffi", "ﬃ", "ffl", "ﬄ", "ff", "ﬀ", "fi", "ﬁ", "fl", "ﬂ",
+	)
+)
+
+func variantLigatures(w string) []string {
+	return []string{
+		variantLigatureExpand.Replace(w),
+		variantLigatureContract.Replace(w),
+	}
+}
+
+const (
+	apostropheStraight = "'"
+	apostropheCurly    = "’" // right single quotation mark
+)
+
+var variantApostropheNormalize = strings.NewReplacer(
+	"‘", apostropheStraight, // left single quotation mark
+	"’", apostropheStraight, // right single quotation mark
+	"ʼ", apostropheStraight, // modifier letter apostrophe
+	"′", apostropheStraight, // prime
+)
+
+func variantApostrophes(w string) []string {
+	s := variantApostropheNormalize.Replace(w)
+	if !strings.Contains(s, apostropheStraight) {
+		return nil
+	}
+	return []string{s, strings.ReplaceAll(s, apostropheStraight, apostropheCurly)}
+}
+
+func variantHyphens(w string) []string {
+	sep := func(c rune) bool {
+		switch c {
+		case '-', '\u2010', '\u2011', '\u2012', '\u2013', '\u00ad': // hyphen-minus, hyphen, non-breaking hyphen, figure dash, en dash, soft hyphen
+			return true
+		}
+		return unicode.IsSpace(c)
+	}
+	parts := strings.FieldsFunc(w, sep)
+	if len(parts) < 2 {
+		return nil
+	}
+	return []string{
+		strings.Join(parts, "-"),
+		strings.Join(parts, "\u2011"), // non-breaking hyphen
+		strings.Join(parts, " "),
+		strings.Join(parts, ""),
+	}
+}
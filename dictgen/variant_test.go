@@ -0,0 +1,69 @@
+package dictgen
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariantGenerator(t *testing.T) {
+	for _, tc := range []struct {
+		forms string
+		word  string
+		out   []string
+	}{
+		{"apostrophe", "don't", []string{"don’t"}},
+		{"apostrophe", "don’t", []string{"don't"}},
+		{"apostrophe", "dont", nil},
+		{"hyphen", "e-mail", []string{"e‑mail", "e mail", "email"}},
+		{"hyphen", "ice cream", []string{"ice-cream", "ice‑cream", "icecream"}},
+		{"normalization", "café", []string{"café"}},
+		{"normalization", "café", []string{"café"}},
+		{"accent", "café", []string{"cafe"}},
+		{"accent", "cafe", nil},
+		{"ligature", "œuvre", []string{"oeuvre"}},
+		{"ligature", "find", []string{"ﬁnd"}},
+		{"ligature", "ﬁnd", []string{"find"}},
+		{"ligature", "does", nil},
+		{"ligature", "aerial", nil},
+		{"accent,hyphen", "bien-aimé", []string{"bien-aime", "bien‑aimé", "bien aimé", "bienaimé", "bien‑aime", "bien aime", "bienaime"}},
+		{"all", "test", nil},
+	} {
+		t.Logf("forms %#v word %#v", tc.forms, tc.word)
+		vg, err := ParseVariantGenerator(tc.forms)
+		if err != nil {
+			t.Fatalf("    parse: unexpected error: %v", err)
+		}
+		if out := vg.Variants(tc.word); !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("    expected %#v, got %#v", tc.out, out)
+		}
+	}
+
+	if _, err := ParseVariantGenerator("apostrophe,nonexistent"); err == nil {
+		t.Errorf("expected error for unknown form")
+	}
+
+	vg := &VariantGenerator{Hyphens: true, Max: 2}
+	if out := vg.Variants("e-mail"); len(out) != 2 {
+		t.Errorf("expected max 2 variants, got %#v", out)
+	}
+}
+
+func TestVariantGeneratorApply(t *testing.T) {
+	df := DictFile{
+		{Headword: "Café", Variant: []string{"cafe"}},
+		{Headword: "rock'n'roll"},
+	}
+	(&VariantGenerator{Apostrophes: true, Accents: true}).Apply(df)
+
+	if exp := []string{"cafe"}; !reflect.DeepEqual(df[0].Variant, exp) {
+		t.Errorf("expected variants %#v, got %#v", exp, df[0].Variant)
+	}
+	if exp := []string{"rock’n’roll"}; !reflect.DeepEqual(df[1].Variant, exp) {
+		t.Errorf("expected variants %#v, got %#v", exp, df[1].Variant)
+	}
+
+	prefixed := df.Prefixed()
+	if _, ok := prefixed["ro"]; !ok {
+		t.Errorf("expected prefix ro")
+	}
+}
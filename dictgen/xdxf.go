@@ -0,0 +1,294 @@
+package dictgen
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// XDXFOptions contains options for generating an XDXF dictionary. A nil or
+// zero value uses the defaults.
+type XDXFOptions struct {
+	Title       string
+	Author      string
+	Description string
+	Version     string
+	Locale      string // the locale code (e.g. en or en-fr), used for lang_from and lang_to
+
+	// Visual writes the visual format (formatted text, which is supported by
+	// more readers) instead of the logical one.
+	Visual bool
+
+	// Renderer is used to render Markdown definitions. If nil,
+	// RendererBlackfriday is used.
+	Renderer Renderer
+}
+
+// WriteXDXF validates the DictFile and writes it to w as an XDXF dictionary.
+// The headword and variants are written as keys (<k>), and the definition is
+// converted from HTML into the XDXF formatting tags (other tags are removed,
+// but their text is kept). The header info is written as the grammar (<gr>) in
+// the logical format, or on its own line in the visual one.
+//
+// Cross-references are written as references to other articles (<kref>), but
+// since they only contain the target, the label is not kept. Images are
+// written as resource references (<rref>) with the original path, so they must
+// be copied next to the XDXF file separately.
+func (df DictFile) WriteXDXF(w io.Writer, opt *XDXFOptions) error {
+	if err := df.Validate(); err != nil {
+		return err
+	}
+	if opt == nil {
+		opt = new(XDXFOptions)
+	}
+	var r Renderer = new(RendererBlackfriday)
+	if opt.Renderer != nil {
+		r = opt.Renderer
+	}
+
+	bw := bufio.NewWriter(w)
+	esc := html.EscapeString
+
+	from, to := xdxfLanguages(opt.Locale)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	bw.WriteString(`<xdxf`)
+	if from != "" {
+		bw.WriteString(` lang_from="` + from + `" lang_to="` + to + `"`)
+	}
+	if opt.Visual {
+		bw.WriteString(` format="visual">` + "\n")
+		bw.WriteString("<full_name>" + esc(xdxfOneLine(opt.Title)) + "</full_name>\n")
+		if opt.Description != "" {
+			bw.WriteString("<description>" + esc(strings.TrimSpace(opt.Description)) + "</description>\n")
+		}
+	} else {
+		bw.WriteString(` format="logical" revision="034">` + "\n")
+		bw.WriteString("<meta_info>\n")
+		bw.WriteString("<title>" + esc(xdxfOneLine(opt.Title)) + "</title>\n")
+		bw.WriteString("<full_title>" + esc(xdxfOneLine(opt.Title)) + "</full_title>\n")
+		if opt.Description != "" {
+			bw.WriteString("<description>" + esc(strings.TrimSpace(opt.Description)) + "</description>\n")
+		}
+		if opt.Author != "" {
+			bw.WriteString("<authors><author>" + esc(xdxfOneLine(opt.Author)) + "</author></authors>\n")
+		}
+		if opt.Version != "" {
+			bw.WriteString("<file_ver>" + esc(xdxfOneLine(opt.Version)) + "</file_ver>\n")
+		}
+		bw.WriteString("</meta_info>\n")
+		bw.WriteString("<lexicon>\n")
+	}
+
+	for _, dfe := range df {
+		defn := dfe.Definition
+		if !dfe.RawHTML {
+			var err error
+			if defn, err = r.Render(defn); err != nil {
+				return fmt.Errorf("word %#v: render markdown: %w", dfe.Headword, err)
+			}
+		}
+		defn, err := xdxfMarkup(renderStarDictReferences(defn+dfe.PostRawHTML), !opt.Visual)
+		if err != nil {
+			return fmt.Errorf("word %#v: convert definition: %w", dfe.Headword, err)
+		}
+		var info string
+		if !dfe.NoHeader {
+			if info, err = xdxfMarkup(dfe.HeaderInfo, false); err != nil {
+				return fmt.Errorf("word %#v: convert header info: %w", dfe.Headword, err)
+			}
+		}
+
+		bw.WriteString("<ar>")
+		seen := map[string]bool{}
+		for _, k := range append([]string{dfe.Headword}, dfe.Variant...) {
+			if !seen[k] {
+				seen[k] = true
+				bw.WriteString("<k>" + esc(k) + "</k>")
+				if opt.Visual {
+					bw.WriteString("\n")
+				}
+			}
+		}
+		if opt.Visual {
+			if info != "" {
+				bw.WriteString(info + "\n")
+			}
+			bw.WriteString(defn)
+		} else {
+			bw.WriteString("<def>")
+			if info != "" {
+				bw.WriteString("<gr>" + info + "</gr> ")
+			}
+			bw.WriteString("<deftext>" + defn + "</deftext>")
+			bw.WriteString("</def>")
+		}
+		bw.WriteString("</ar>\n")
+	}
+
+	if !opt.Visual {
+		bw.WriteString("</lexicon>\n")
+	}
+	bw.WriteString("</xdxf>\n")
+	return bw.Flush()
+}
+
+// xdxfLanguages returns the ISO 639-2 codes (e.g. ENG) for the source and
+// target languages of a locale (e.g. en or en-fr). If the locale only has a
+// single language, it is used for both.
+func xdxfLanguages(locale string) (from, to string) {
+	if locale == "" {
+		return "", ""
+	}
+	code := func(s string) string {
+		if b, err := language.ParseBase(s); err == nil {
+			return strings.ToUpper(b.ISO3())
+		}
+		return strings.ToUpper(s)
+	}
+	spl := strings.SplitN(locale, "-", 2)
+	from, to = code(spl[0]), code(spl[0])
+	if len(spl) == 2 {
+		to = code(spl[1])
+	}
+	return from, to
+}
+
+func xdxfOneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// xdxfTags maps HTML tags to the equivalent XDXF formatting tags.
+var xdxfTags = map[string]string{
+	"b": "b", "strong": "b",
+	"i": "i", "em": "i", "cite": "i", "dfn": "i", "var": "i",
+	"u": "u", "ins": "u",
+	"sub": "sub", "sup": "sup",
+	"tt": "tt", "code": "tt", "kbd": "tt", "samp": "tt",
+	"blockquote": "blockquote",
+}
+
+// xdxfBlockTags are HTML tags which are put on their own line.
+var xdxfBlockTags = map[string]bool{
+	"p": true, "div": true, "ul": true, "ol": true, "li": true, "dl": true,
+	"dt": true, "dd": true, "table": true, "tr": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"hr": true, "pre": true,
+}
+
+var (
+	xdxfSpaceRe   = regexp.MustCompile(`[ \t\r\n]+`)
+	xdxfNewlineRe = regexp.MustCompile(`(?: *\n *)+`)
+	xdxfBreakRe   = regexp.MustCompile(`(?: *<br/> *)+`)
+)
+
+// xdxfMarkup converts HTML to the XDXF formatting tags. In the logical format,
+// line breaks are written as <br/> since whitespace isn't significant.
+func xdxfMarkup(s string, logical bool) (string, error) {
+	d := xml.NewDecoder(strings.NewReader("<root>" + s + "</root>"))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	nl := "\n"
+	if logical {
+		nl = "<br/>"
+	}
+
+	var b strings.Builder
+	newline := func() {
+		if t := strings.TrimRight(b.String(), " "); t != "" && !strings.HasSuffix(t, nl) {
+			b.WriteString(nl)
+		}
+	}
+
+	type elem struct {
+		close string
+		block bool
+	}
+	var end []elem
+	var skip int // the depth inside an element whose contents are replaced
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip != 0 {
+				skip++
+				continue
+			}
+			n := strings.ToLower(t.Name.Local)
+			if xdxfBlockTags[n] {
+				newline()
+			}
+			var open, close string
+			switch n {
+			case "root":
+			case "br":
+				b.WriteString(nl)
+			case "a":
+				href := xmlAttrValue(t, "href")
+				if target := strings.TrimPrefix(href, "bword://"); target != href {
+					b.WriteString("<kref>" + html.EscapeString(target) + "</kref>")
+					skip = 1
+					continue
+				} else if href != "" && !strings.HasPrefix(href, "#") {
+					open, close = `<iref href="`+html.EscapeString(href)+`">`, "</iref>"
+				}
+			case "img":
+				if src := xmlAttrValue(t, "src"); src != "" && !strings.HasPrefix(src, "data:") {
+					b.WriteString("<rref>" + html.EscapeString(src) + "</rref>")
+				}
+			default:
+				if x, ok := xdxfTags[n]; ok {
+					open, close = "<"+x+">", "</"+x+">"
+				}
+			}
+			b.WriteString(open)
+			end = append(end, elem{close, xdxfBlockTags[n]})
+		case xml.EndElement:
+			if skip != 0 {
+				skip--
+				continue
+			}
+			if len(end) != 0 {
+				e := end[len(end)-1]
+				end = end[:len(end)-1]
+				b.WriteString(e.close)
+				if e.block {
+					newline()
+				}
+			}
+		case xml.CharData:
+			if skip == 0 {
+				b.WriteString(xdxfSpaceRe.ReplaceAllString(html.EscapeString(string(t)), " "))
+			}
+		}
+	}
+
+	nlRe := xdxfNewlineRe
+	if logical {
+		nlRe = xdxfBreakRe
+	}
+	s = nlRe.ReplaceAllString(b.String(), nl)
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), nl), nl), nil
+}
+
+func xmlAttrValue(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
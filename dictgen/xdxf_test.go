@@ -0,0 +1,60 @@
+package dictgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteXDXF(t *testing.T) {
+	df, err := ParseDictFile(strings.NewReader("@ banana\n: noun\n& Bananas\nA fruit, see [[apple|apples]].\n\n- yellow\n- long\n@ apple\n& apples\nA *fruit* & <img src=\"apple.png\">.\n"))
+	if err != nil {
+		t.Fatalf("parse dictfile: %v", err)
+	}
+
+	for _, tc := range []struct {
+		visual bool
+		exp    string
+	}{
+		{false, "" +
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+			"<xdxf lang_from=\"ENG\" lang_to=\"FRA\" format=\"logical\" revision=\"034\">\n" +
+			"<meta_info>\n" +
+			"<title>Test</title>\n" +
+			"<full_title>Test</full_title>\n" +
+			"<description>License: CC0</description>\n" +
+			"<authors><author>Someone</author></authors>\n" +
+			"<file_ver>1.0</file_ver>\n" +
+			"</meta_info>\n" +
+			"<lexicon>\n" +
+			"<ar><k>banana</k><k>Bananas</k><def><gr>noun</gr> <deftext>A fruit, see <kref>apple</kref>.<br/>yellow<br/>long</deftext></def></ar>\n" +
+			"<ar><k>apple</k><k>apples</k><def><deftext>A <i>fruit</i> &amp; <rref>apple.png</rref>.</deftext></def></ar>\n" +
+			"</lexicon>\n" +
+			"</xdxf>\n",
+		},
+		{true, "" +
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+			"<xdxf lang_from=\"ENG\" lang_to=\"FRA\" format=\"visual\">\n" +
+			"<full_name>Test</full_name>\n" +
+			"<description>License: CC0</description>\n" +
+			"<ar><k>banana</k>\n<k>Bananas</k>\nnoun\nA fruit, see <kref>apple</kref>.\nyellow\nlong</ar>\n" +
+			"<ar><k>apple</k>\n<k>apples</k>\nA <i>fruit</i> &amp; <rref>apple.png</rref>.</ar>\n" +
+			"</xdxf>\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if err := df.WriteXDXF(&buf, &XDXFOptions{
+			Title:       "Test",
+			Author:      "Someone",
+			Description: "License: CC0",
+			Version:     "1.0",
+			Locale:      "en-fr",
+			Visual:      tc.visual,
+		}); err != nil {
+			t.Fatalf("write xdxf: %v", err)
+		}
+		if act := buf.String(); act != tc.exp {
+			t.Errorf("visual=%t: expected:\n%s\ngot:\n%s", tc.visual, tc.exp, act)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package dictgen
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// xrefRe matches cross-references in the form [[word]] or [[word|label]].
+var xrefRe = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|([^\[\]\n]+))?\]\]`)
+
+// References returns the targets of the cross-references in the definition of
+// the entry. Cross-references are written as [[word]], or [[word|label]] to
+// show a different label.
+func (d DictFileEntry) References() []string {
+	var refs []string
+	for _, ref := range FindReferences(d.Definition) {
+		refs = append(refs, ref.Target)
+	}
+	return refs
+}
+
+// Reference is a cross-reference found by FindReferences.
+type Reference struct {
+	Target string
+	Label  string // empty if not specified
+	Start  int    // byte offset of the [[
+	End    int    // byte offset after the ]]
+}
+
+// FindReferences finds the cross-references in s (e.g. a definition or a
+// single line of one).
+func FindReferences(s string) []Reference {
+	var refs []Reference
+	for _, m := range xrefRe.FindAllStringSubmatchIndex(s, -1) {
+		ref := Reference{Target: strings.TrimSpace(s[m[2]:m[3]]), Start: m[0], End: m[1]}
+		if m[4] != -1 {
+			ref.Label = strings.TrimSpace(s[m[4]:m[5]])
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// CheckReferences checks if the target of every cross-reference in the
+// DictFile matches the headword or a variant of an entry (case-insensitively).
+// Since references can point to entries in other dictfiles, it should be
+// called after all of them are merged. If there are dangling references, an
+// error is returned for each one (joined with errors.Join).
+func (df DictFile) CheckReferences() error {
+	var c ReferenceChecker
+	for _, dfe := range df {
+		c.Add(dfe)
+	}
+	return c.Check()
+}
+
+// ReferenceChecker is like DictFile.CheckReferences, but the entries are added
+// one at a time (e.g. when used with DictFileScanner). Only the words and
+// references are kept in memory. The zero value is ready to use.
+type ReferenceChecker struct {
+	words map[string]bool
+	refs  []xref
+	n     int
+}
+
+type xref struct {
+	target string // normalized
+	err    error  // to return if dangling
+}
+
+// Add adds the headword, variants, and references of an entry.
+func (c *ReferenceChecker) Add(dfe *DictFileEntry) {
+	if c.words == nil {
+		c.words = map[string]bool{}
+	}
+	i := c.n
+	c.n++
+	c.words[kobodict.NormalizeWordReference(dfe.Headword, true)] = true
+	for _, v := range dfe.Variant {
+		c.words[kobodict.NormalizeWordReference(v, true)] = true
+	}
+	for _, ref := range dfe.References() {
+		err := fmt.Errorf("word %#v (i:%d): dangling cross-reference to %#v", dfe.Headword, i, ref)
+		if dfe.line != 0 {
+			err = &DictFileError{dfe.file, dfe.line, err}
+		}
+		c.refs = append(c.refs, xref{kobodict.NormalizeWordReference(ref, true), err})
+	}
+}
+
+// Check returns an error for each dangling reference (joined with
+// errors.Join), or nil if there aren't any.
+func (c *ReferenceChecker) Check() error {
+	var errs []error
+	for _, ref := range c.refs {
+		if !c.words[ref.target] {
+			errs = append(errs, ref.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// renderReferences replaces cross-references with HTML. Since nickel only shows
+// the entries for the word which was looked up, links to other entries can't
+// work, so they are rendered as italic text with the xref class instead (which
+// can be styled, or selected to look it up). The target is put in the title if
+// it differs from the label.
+func renderReferences(s string) string {
+	if !strings.Contains(s, "[[") {
+		return s
+	}
+	return xrefRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := xrefRe.FindStringSubmatch(m)
+		target, label := strings.TrimSpace(sm[1]), strings.TrimSpace(sm[2])
+		if label == "" || label == target {
+			return `<i class="xref">` + target + `</i>`
+		}
+		return `<i class="xref" title="` + strings.ReplaceAll(target, `"`, "&quot;") + `">` + label + `</i>`
+	})
+}
@@ -0,0 +1,62 @@
+package dictgen
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	df, err := ParseDictFile(strings.NewReader(`@ go
+& went
+See [[Walk]] and [[went|the past tense]].
+@ walk
+<html>
+<p>See [[go]], [[run]], and [[ fly | flying ]].</p>
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if refs := df[1].References(); !reflect.DeepEqual(refs, []string{"go", "run", "fly"}) {
+		t.Errorf("unexpected references %q", refs)
+	}
+
+	if refs := FindReferences("a [[b]] [[ c | d ]]"); !reflect.DeepEqual(refs, []Reference{{"b", "", 2, 7}, {"c", "d", 8, 19}}) {
+		t.Errorf("unexpected references %+v", refs)
+	}
+
+	err = df.CheckReferences()
+	if err == nil {
+		t.Fatalf("expected error for dangling references")
+	}
+	var dfErr *DictFileError
+	if !errors.As(err, &dfErr) || dfErr.Line != 4 {
+		t.Errorf("expected error on line 4, got %v", err)
+	}
+	if s := err.Error(); !strings.Contains(s, `"run"`) || !strings.Contains(s, `"fly"`) || strings.Count(s, "\n") != 1 {
+		t.Errorf("expected two dangling reference errors, got %q", s)
+	}
+	if err := df[:1].CheckReferences(); err == nil {
+		t.Errorf("expected error for dangling reference to walk")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := df.WriteKoboHTML(buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, x := range []string{
+		`<p>See <i class="xref">Walk</i> and <i class="xref" title="went">the past tense</i>.</p>`,
+		`<p>See <i class="xref">go</i>, <i class="xref">run</i>, and <i class="xref" title="fly">flying</i>.</p>`,
+	} {
+		if !strings.Contains(buf.String(), x) {
+			t.Errorf("expected output to contain %q, got %q", x, buf.String())
+		}
+	}
+
+	if df[0].Definition != "See [[Walk]] and [[went|the past tense]]." {
+		t.Errorf("expected original definition to be unchanged, got %q", df[0].Definition)
+	}
+}
@@ -0,0 +1,151 @@
+// Command bgl-convert converts a Babylon BGL dictionary to a dictgen dictfile.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/bgl"
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: the name of the bgl with the extension .df in the current directory)")
+	imageMethod := pflag.StringP("image-method", "I", "base64", "How to handle images embedded in the bgl (base64 - optimize and encode as base64, extract - write to the resources dir and reference them by path, remove)")
+	resources := pflag.StringP("resources", "r", "", "The directory to extract images to for --image-method=extract (default: the name of the bgl with the suffix _res in the current directory)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped entries, alternates, and images")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] bgl_path\n\nVersion: bgl-convert %s\n\nOptions:\n%s\nArguments:\n  bgl_path is the path to the Babylon .bgl file.\n\nIf an image can't be converted, it is removed from the entry.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	fn := pflag.Arg(0)
+	base := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+	if *output == "" {
+		*output = "." + string(os.PathSeparator) + base + ".df"
+	}
+	if *resources == "" {
+		*resources = "." + string(os.PathSeparator) + base + "_res"
+	}
+
+	var ih dictgen.ImageHandler
+	switch *imageMethod {
+	case "base64":
+		ih = new(dictgen.ImageHandlerBase64)
+	case "extract":
+		ih = &imageHandlerExtract{Dir: *resources}
+	case "remove":
+		ih = new(dictgen.ImageHandlerRemove)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid value for --image-method, see --help for details.\n")
+		os.Exit(2)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Reading dictionary.\n")
+	d, err := bgl.Open(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: read bgl %#v: %v\n", fn, err)
+		os.Exit(1)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Dictionary: %s (%d words, %d resources).\n", d.Title, len(d.Entries), len(d.Resources))
+
+	fmt.Fprintf(os.Stderr, "Transforming definitions (images: %s).\n", ih.Description())
+	df, warnings := d.DictFile(ih)
+	if !*quiet {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Writing dictfile.\n")
+	write := func(w io.Writer) error {
+		if err := d.Header().WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		return df.WriteDictFile(w)
+	}
+	switch *output {
+	case "-":
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := write(f); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from BGL dictionary %#v to dictfile %s.\n", len(df), len(d.Entries)-len(df), fn, *output)
+	os.Exit(0)
+}
+
+// imageHandlerExtract writes images to a directory, and references them by
+// path so dictgen can load them later.
+type imageHandlerExtract struct {
+	Dir string
+}
+
+// Transform implements dictgen.ImageHandler.
+func (ih *imageHandlerExtract) Transform(src string, ir io.Reader, _ *kobodict.Writer) (string, string, error) {
+	if err := os.MkdirAll(ih.Dir, 0755); err != nil {
+		return "", "", fmt.Errorf("imageHandlerExtract: create dir: %w", err)
+	}
+	fn := filepath.Join(ih.Dir, filepath.Base(filepath.FromSlash(strings.ReplaceAll(src, `\`, "/"))))
+	if _, err := os.Stat(fn); err == nil {
+		return filepath.ToSlash(fn), "", nil // already extracted
+	}
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", "", fmt.Errorf("imageHandlerExtract: create file: %w", err)
+	}
+	if _, err := io.Copy(f, ir); err != nil {
+		f.Close()
+		return "", "", fmt.Errorf("imageHandlerExtract: write file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", "", fmt.Errorf("imageHandlerExtract: write file: %w", err)
+	}
+	return filepath.ToSlash(fn), "", nil
+}
+
+// Description implements dictgen.ImageHandler.
+func (*imageHandlerExtract) Description() string {
+	return "extract to the resources dir"
+}
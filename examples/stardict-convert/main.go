@@ -0,0 +1,92 @@
+// Command stardict-convert converts a StarDict dictionary to a dictgen
+// dictfile.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen/importers/stardict"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: the name of the ifo with the extension .df in the current directory)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped entries and synonyms")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] ifo_path\n\nVersion: stardict-convert %s\n\nOptions:\n%s\nArguments:\n  ifo_path is the path to the .ifo file of the StarDict dictionary. The .idx (or .idx.gz), .dict (or .dict.dz), and .syn (optional) must be in the same directory.\n\nImages are referenced from the res directory next to the ifo, if it exists.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	ifo := pflag.Arg(0)
+	if *output == "" {
+		*output = "." + string(os.PathSeparator) + strings.TrimSuffix(filepath.Base(ifo), ".ifo") + ".df"
+	}
+
+	fmt.Fprintf(os.Stderr, "Reading dictionary.\n")
+	d, err := stardict.Open(ifo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: read stardict %#v: %v\n", ifo, err)
+		os.Exit(1)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Dictionary: %s (%d words, %d synonyms).\n", d.BookName, len(d.Entries), d.SynWordCount)
+
+	fmt.Fprintf(os.Stderr, "Transforming definitions.\n")
+	df, warnings := d.DictFile()
+	if !*quiet {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Writing dictfile.\n")
+	write := func(w io.Writer) error {
+		if err := d.Header().WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		return df.WriteDictFile(w)
+	}
+	switch *output {
+	case "-":
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := write(f); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from StarDict dictionary %#v to dictfile %s.\n", len(df), len(d.Entries)-len(df), ifo, *output)
+	os.Exit(0)
+}
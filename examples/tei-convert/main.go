@@ -0,0 +1,127 @@
+// Command tei-convert converts a TEI XML dictionary (e.g. from FreeDict) to a
+// dictgen dictfile.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/tei"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: the name of the tei with the extension .df in the current directory)")
+	locale := pflag.StringP("locale", "l", "", "Override the locale code for the dictfile header (e.g. de-en) (default: detected from the tei or the FreeDict filename)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped entries and variants")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] tei_path\n\nVersion: tei-convert %s\n\nOptions:\n%s\nArguments:\n  tei_path is the path to the TEI XML file (e.g. deu-eng.tei from FreeDict).\n\nThe dictionary is converted one entry at a time, so large dictionaries don't need to fit in memory.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	fn := pflag.Arg(0)
+	if *output == "" {
+		*output = "." + string(os.PathSeparator) + strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn)) + ".df"
+	}
+
+	fmt.Fprintf(os.Stderr, "Opening dictionary.\n")
+	s, err := tei.Open(fn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: open tei %#v: %v\n", fn, err)
+		os.Exit(1)
+		return
+	}
+	defer s.Close()
+
+	fmt.Fprintf(os.Stderr, "Converting entries.\n")
+	var n int
+	warn := func() {
+		if !*quiet {
+			for _, w := range s.Warnings() {
+				fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+			}
+		}
+	}
+	write := func(w io.Writer) error {
+		// the header is complete once the first entry has been read
+		ok := s.Scan()
+		warn()
+		hdr := s.Header()
+		if *locale != "" {
+			hdr.Locale = *locale
+		}
+		if err := hdr.WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		for ok {
+			if err := (dictgen.DictFile{s.Entry()}).WriteDictFile(w); err != nil {
+				return fmt.Errorf("write entry %#v: %w", s.Entry().Headword, err)
+			}
+			n++
+			ok = s.Scan()
+			warn()
+		}
+		if err := s.Err(); err != nil {
+			return fmt.Errorf("read tei: %w", err)
+		}
+		return nil
+	}
+	switch *output {
+	case "-":
+		bw := bufio.NewWriter(os.Stdout)
+		if err := write(bw); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: convert dictionary: %v\n", err)
+			os.Exit(1)
+			return
+		}
+		if err := bw.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		bw := bufio.NewWriter(f)
+		if err := write(bw); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: convert dictionary: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := bw.Flush(); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from TEI dictionary %#v to dictfile %s.\n", n, s.Skipped(), fn, *output)
+	os.Exit(0)
+}
@@ -9,6 +9,8 @@ import (
 	"html/template"
 	"io"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/spf13/pflag"
 
@@ -18,7 +20,22 @@ import (
 
 var version = "dev"
 
+// seeRe matches references to other entries in the text (e.g. See Abandon).
+var seeRe = regexp.MustCompile(`\b(See(?: also| under)?) ([A-Z][a-z]+(?:-[a-z]+)*)\b`)
+
+// words contains the lowercased headwords and variants for xref.
+var words = map[string]bool{}
+
 var deftmpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"xref": func(s string) string {
+		return seeRe.ReplaceAllStringFunc(s, func(m string) string {
+			sm := seeRe.FindStringSubmatch(m)
+			if !words[strings.ToLower(sm[2])] {
+				return m
+			}
+			return sm[1] + " [[" + sm[2] + "]]"
+		})
+	},
 	"spldc": func(s string) []string {
 		for i, c := range s {
 			if c == '.' || c == ',' || c == '(' {
@@ -29,7 +46,7 @@ var deftmpl = template.Must(template.New("").Funcs(template.FuncMap{
 	},
 }).Parse(`
 	{{- with .Etymology}}<p><i>{{.}}</i></p>{{end -}}
-	{{- with .Meanings}}<ol>{{range .}}<li>{{.Text}}{{with .Example}}<br/><br/>{{.}}{{end}}</li>{{end}}</ol>{{end -}}
+	{{- with .Meanings}}<ol>{{range .}}<li>{{xref .Text}}{{with .Example}}<br/><br/>{{.}}{{end}}</li>{{end}}</ol>{{end -}}
 	{{- with .PhraseDefns}}<p>{{range $n, $v := .}}{{if $n}} {{end}}{{range $x, $y := (spldc $v)}}{{if $x}}<span>{{$y}}</span>{{else}}<b>{{$y}}</b>{{end}}{{end}}{{end}}</p>{{end -}}
 	{{- with .Synonyms}}<p>{{range $n, $v := .}}{{if $n}} {{end}}{{$v}}{{end}}</p>{{end -}}
 	{{- with .Extra}}<p>{{.}}</p>{{end -}}
@@ -86,6 +103,12 @@ func main() {
 	}
 
 	fmt.Fprintf(os.Stderr, "Transforming definitions.\n")
+	for _, d := range wd {
+		words[strings.ToLower(d.Headword)] = true
+		for _, v := range d.Variant {
+			words[strings.ToLower(v)] = true
+		}
+	}
 	var df dictgen.DictFile
 	dbuf := bytes.NewBuffer(nil)
 	for _, d := range wd {
@@ -0,0 +1,135 @@
+// Command wiktextract-convert converts a Wiktionary dump extracted by
+// wiktextract (e.g. from kaikki.org) to a dictgen dictfile.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen"
+	"github.com/pgaskin/dictutil/dictgen/importers/wiktextract"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: the name of the dump with the extension .df in the current directory)")
+	lang := pflag.StringP("lang", "L", "", "Only convert the entries for a language, as a language code or name (e.g. en or English) (default: all languages)")
+	dropArchaic := pflag.Bool("drop-archaic", false, "Drop senses tagged as archaic")
+	dropObsolete := pflag.Bool("drop-obsolete", false, "Drop senses tagged as obsolete")
+	locale := pflag.StringP("locale", "l", "", "Override the locale code for the dictfile header (e.g. de) (default: the language of the first entry)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped entries and variants")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] jsonl_path\n\nVersion: wiktextract-convert %s\n\nOptions:\n%s\nArguments:\n  jsonl_path is the path to the wiktextract JSONL dump (e.g. kaikki.org-dictionary-English.jsonl), optionally gzipped.\n\nThe dump is converted one entry at a time, so large dumps don't need to fit in memory.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	fn := pflag.Arg(0)
+	if *output == "" {
+		base := strings.TrimSuffix(filepath.Base(fn), ".gz")
+		*output = "." + string(os.PathSeparator) + strings.TrimSuffix(base, filepath.Ext(base)) + ".df"
+	}
+
+	fmt.Fprintf(os.Stderr, "Opening dictionary.\n")
+	s, err := wiktextract.Open(fn, &wiktextract.Options{
+		Lang:         *lang,
+		DropArchaic:  *dropArchaic,
+		DropObsolete: *dropObsolete,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: open dump %#v: %v\n", fn, err)
+		os.Exit(1)
+		return
+	}
+	defer s.Close()
+
+	fmt.Fprintf(os.Stderr, "Converting entries.\n")
+	var n int
+	warn := func() {
+		if !*quiet {
+			for _, w := range s.Warnings() {
+				fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+			}
+		}
+	}
+	write := func(w io.Writer) error {
+		// the header is complete once the first entry has been read
+		ok := s.Scan()
+		warn()
+		hdr := s.Header()
+		if *locale != "" {
+			hdr.Locale = *locale
+		}
+		if err := hdr.WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		for ok {
+			if err := (dictgen.DictFile{s.Entry()}).WriteDictFile(w); err != nil {
+				return fmt.Errorf("write entry %#v: %w", s.Entry().Headword, err)
+			}
+			n++
+			ok = s.Scan()
+			warn()
+		}
+		if err := s.Err(); err != nil {
+			return fmt.Errorf("read dump: %w", err)
+		}
+		return nil
+	}
+	switch *output {
+	case "-":
+		bw := bufio.NewWriter(os.Stdout)
+		if err := write(bw); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: convert dictionary: %v\n", err)
+			os.Exit(1)
+			return
+		}
+		if err := bw.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		bw := bufio.NewWriter(f)
+		if err := write(bw); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: convert dictionary: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := bw.Flush(); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from wiktextract dump %#v to dictfile %s.\n", n, s.Skipped(), fn, *output)
+	os.Exit(0)
+}
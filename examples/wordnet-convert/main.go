@@ -0,0 +1,96 @@
+// Command wordnet-convert converts a Princeton WordNet database to a dictgen
+// dictfile.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen/importers/wordnet"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: wordnet.df in the current directory)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped entries and variants")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] wordnet_dir\n\nVersion: wordnet-convert %s\n\nOptions:\n%s\nArguments:\n  wordnet_dir is the path to the directory containing the WordNet database files (data.*, index.*, and *.exc), or a WordNet distribution containing a dict directory.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	dir := pflag.Arg(0)
+	if *output == "" {
+		*output = "." + string(os.PathSeparator) + "wordnet.df"
+	}
+
+	fmt.Fprintf(os.Stderr, "Reading database.\n")
+	db, err := wordnet.Open(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: read wordnet %#v: %v\n", dir, err)
+		os.Exit(1)
+		return
+	}
+	lemmas := map[string]bool{}
+	for _, pos := range wordnet.POSes {
+		for _, ie := range db.Index[pos] {
+			lemmas[ie.Lemma] = true
+		}
+	}
+	fmt.Fprintf(os.Stderr, "  Database: WordNet %s (%d synsets, %d lemmas).\n", db.Version, len(db.Synsets), len(lemmas))
+
+	fmt.Fprintf(os.Stderr, "Transforming synsets.\n")
+	df, warnings := db.DictFile()
+	if !*quiet {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Writing dictfile.\n")
+	write := func(w io.Writer) error {
+		if err := db.Header().WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		return df.WriteDictFile(w)
+	}
+	switch *output {
+	case "-":
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := write(f); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from WordNet database %#v to dictfile %s.\n", len(df), len(lemmas)-len(df), dir, *output)
+	os.Exit(0)
+}
@@ -0,0 +1,91 @@
+// Command xdxf-convert converts an XDXF dictionary to a dictgen dictfile.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/pgaskin/dictutil/dictgen/importers/xdxf"
+)
+
+var version = "dev"
+
+func main() {
+	pflag.CommandLine.SortFlags = false
+	output := pflag.StringP("output", "o", "", "The output filename (will be overwritten if it exists) (- is stdout) (default: the name of the xdxf with the extension .df in the current directory)")
+	quiet := pflag.BoolP("quiet", "q", false, "Don't show warnings for skipped articles and keys")
+	help := pflag.BoolP("help", "h", false, "Show this help text")
+	pflag.Parse()
+
+	if *help || pflag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] xdxf_path\n\nVersion: xdxf-convert %s\n\nOptions:\n%s\nArguments:\n  xdxf_path is the path to the XDXF dictionary (usually dict.xdxf). Both the visual and logical formats are supported.\n\nImages are referenced relative to the directory containing the xdxf.\n\nTo convert the resulting dictfile into a dictzip, use dictgen.\n", os.Args[0], version, pflag.CommandLine.FlagUsages())
+		os.Exit(0)
+		return
+	}
+
+	xp := pflag.Arg(0)
+	if *output == "" {
+		*output = "." + string(os.PathSeparator) + strings.TrimSuffix(filepath.Base(xp), filepath.Ext(xp)) + ".df"
+	}
+
+	fmt.Fprintf(os.Stderr, "Reading dictionary.\n")
+	d, err := xdxf.Open(xp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: read xdxf %#v: %v\n", xp, err)
+		os.Exit(1)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  Dictionary: %s (%s format, %d articles).\n", d.Title, d.Format, len(d.Articles))
+
+	fmt.Fprintf(os.Stderr, "Transforming articles.\n")
+	df, warnings := d.DictFile()
+	if !*quiet {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %v.\n", w)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Writing dictfile.\n")
+	write := func(w io.Writer) error {
+		if err := d.Header().WriteDictFileHeader(w); err != nil {
+			return err
+		}
+		return df.WriteDictFile(w)
+	}
+	switch *output {
+	case "-":
+		if err := write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	default:
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: create dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := write(f); err != nil {
+			f.Close()
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: write dictfile: %v\n", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Successfully converted %d entries (%d skipped) from XDXF dictionary %#v to dictfile %s.\n", len(df), len(d.Articles)-len(df), xp, *output)
+	os.Exit(0)
+}
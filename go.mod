@@ -9,6 +9,8 @@ require (
 	github.com/pgaskin/koboutils/v2 v2.1.0
 	github.com/russross/blackfriday/v2 v2.0.1
 	github.com/spf13/pflag v1.0.10
+	github.com/yuin/goldmark v1.8.5
+	golang.org/x/text v0.30.0
 	gopkg.in/yaml.v2 v2.2.8
 )
 
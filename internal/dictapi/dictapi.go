@@ -0,0 +1,298 @@
+// Package dictapi implements a JSON HTTP API for looking up words in Kobo
+// dictionaries. It is used by dictutil serve --api.
+package dictapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// Server serves the API for a set of dictzips, which can be replaced at any
+// time (e.g. when they change). The zero value is ready to use.
+//
+// The endpoints are:
+//
+//	GET /api/dictionaries
+//	GET /api/lookup?q=word[&dict=id,...]
+//	GET /api/complete?q=prefix[&dict=id,...][&limit=20]
+//	GET /api/entry?dict=id&id=entry
+//
+// Errors are returned as {"error": "message"} with an appropriate status code.
+type Server struct {
+	// CORS, if not empty, is the value of the Access-Control-Allow-Origin
+	// header.
+	CORS string
+
+	mu    sync.RWMutex
+	dicts map[string]*dict
+}
+
+type dict struct {
+	dr    *kobodict.Reader
+	pfn   kobodict.PrefixFunc
+	words []word // sorted by lowercase
+	err   error
+}
+
+type word struct {
+	lower, word string
+}
+
+// Dictionary is the information about a dictzip.
+type Dictionary struct {
+	ID    string `json:"id"`
+	Words int    `json:"words"`
+	Error string `json:"error,omitempty"` // if the dictzip couldn't be loaded
+}
+
+// Entry is an entry from a dictzip.
+type Entry struct {
+	Dict     string   `json:"dict"`
+	ID       string   `json:"id"` // prefix/index
+	Headword string   `json:"headword"`
+	Variant  []string `json:"variants"`
+	HTML     string   `json:"html"`
+	Text     string   `json:"text"`
+}
+
+// Update adds or replaces a dictzip. If err is not nil, it is returned for
+// requests using the dictzip instead.
+func (s *Server) Update(id string, dr *kobodict.Reader, pfn kobodict.PrefixFunc, err error) {
+	d := &dict{dr: dr, pfn: pfn, err: err}
+	if dr != nil {
+		d.words = make([]word, len(dr.Word))
+		for i, w := range dr.Word {
+			d.words[i] = word{strings.ToLower(w), w}
+		}
+		sort.Slice(d.words, func(i, j int) bool {
+			return d.words[i].lower < d.words[j].lower
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dicts == nil {
+		s.dicts = map[string]*dict{}
+	}
+	s.dicts[id] = d
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.CORS != "" {
+		w.Header().Set("Access-Control-Allow-Origin", s.CORS)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/dictionaries":
+		s.serveDictionaries(w, r)
+	case "/api/lookup":
+		s.serveLookup(w, r)
+	case "/api/complete":
+		s.serveComplete(w, r)
+	case "/api/entry":
+		s.serveEntry(w, r)
+	default:
+		s.error(w, http.StatusNotFound, fmt.Errorf("not found"))
+	}
+}
+
+func (s *Server) json(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func (s *Server) error(w http.ResponseWriter, status int, err error) {
+	s.json(w, status, map[string]string{"error": err.Error()})
+}
+
+// selected returns the dictionaries specified by the dict parameter (a
+// comma-separated list of IDs), or all of them which were loaded successfully
+// (sorted by ID) if it is empty. If it returns false, the error has already
+// been written.
+func (s *Server) selected(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var ids []string
+	if v := r.FormValue("dict"); v != "" {
+		for _, id := range strings.Split(v, ",") {
+			if d, ok := s.dicts[id]; !ok {
+				s.error(w, http.StatusBadRequest, fmt.Errorf("unknown dictionary %#v", id))
+				return nil, false
+			} else if d.err != nil {
+				s.error(w, http.StatusInternalServerError, fmt.Errorf("dictionary %#v: %w", id, d.err))
+				return nil, false
+			}
+			ids = append(ids, id)
+		}
+	} else {
+		// the ones which failed are shown in /api/dictionaries
+		for id, d := range s.dicts {
+			if d.err == nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+	}
+	return ids, true
+}
+
+func (s *Server) serveDictionaries(w http.ResponseWriter, r *http.Request) {
+	ds := []Dictionary{}
+	for id, d := range s.dicts {
+		x := Dictionary{ID: id}
+		if d.err != nil {
+			x.Error = d.err.Error()
+		} else {
+			x.Words = len(d.dr.Word)
+		}
+		ds = append(ds, x)
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].ID < ds[j].ID
+	})
+	s.json(w, http.StatusOK, map[string]interface{}{"dictionaries": ds})
+}
+
+func (s *Server) serveLookup(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.FormValue("q"))
+	if q == "" {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("missing query"))
+		return
+	}
+
+	ids, ok := s.selected(w, r)
+	if !ok {
+		return
+	}
+
+	es := []Entry{}
+	for _, id := range ids {
+		d := s.dicts[id]
+		res, err := d.dr.Lookup(q, d.pfn)
+		if err != nil {
+			s.error(w, http.StatusInternalServerError, fmt.Errorf("dictionary %#v: %w", id, err))
+			return
+		}
+		for _, e := range res {
+			es = append(es, entry(id, e))
+		}
+	}
+	s.json(w, http.StatusOK, map[string]interface{}{"query": q, "entries": es})
+}
+
+func (s *Server) serveComplete(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.FormValue("q")))
+	if q == "" {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("missing query"))
+		return
+	}
+
+	limit := 20
+	if v := r.FormValue("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+			s.error(w, http.StatusBadRequest, fmt.Errorf("invalid limit %#v", v))
+			return
+		} else {
+			limit = n
+		}
+	}
+
+	ids, ok := s.selected(w, r)
+	if !ok {
+		return
+	}
+
+	seen := map[string]bool{}
+	var ws []word
+	for _, id := range ids {
+		d := s.dicts[id]
+		i := sort.Search(len(d.words), func(i int) bool {
+			return d.words[i].lower >= q
+		})
+		for n := 0; i < len(d.words) && n < limit && strings.HasPrefix(d.words[i].lower, q); i++ {
+			if !seen[d.words[i].word] {
+				seen[d.words[i].word] = true
+				ws = append(ws, d.words[i])
+				n++
+			}
+		}
+	}
+	sort.SliceStable(ws, func(i, j int) bool {
+		return ws[i].lower < ws[j].lower
+	})
+	if len(ws) > limit {
+		ws = ws[:limit]
+	}
+
+	words := make([]string, len(ws))
+	for i, x := range ws {
+		words[i] = x.word
+	}
+	s.json(w, http.StatusOK, map[string]interface{}{"query": q, "words": words})
+}
+
+func (s *Server) serveEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("dict")
+	d, ok := s.dicts[id]
+	if !ok {
+		s.error(w, http.StatusNotFound, fmt.Errorf("unknown dictionary %#v", id))
+		return
+	} else if d.err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("dictionary %#v: %w", id, d.err))
+		return
+	}
+
+	eid := r.FormValue("id")
+	i := strings.LastIndex(eid, "/")
+	if i == -1 {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid entry id %#v", eid))
+		return
+	}
+	n, err := strconv.Atoi(eid[i+1:])
+	if err != nil {
+		s.error(w, http.StatusBadRequest, fmt.Errorf("invalid entry id %#v", eid))
+		return
+	}
+
+	es, err := d.dr.Entries(eid[:i])
+	if err != nil {
+		s.error(w, http.StatusInternalServerError, fmt.Errorf("dictionary %#v: %w", id, err))
+		return
+	} else if n < 0 || n >= len(es) {
+		s.error(w, http.StatusNotFound, fmt.Errorf("entry %#v not found", eid))
+		return
+	}
+	s.json(w, http.StatusOK, entry(id, es[n]))
+}
+
+func entry(id string, e kobodict.Entry) Entry {
+	v := e.Variant
+	if v == nil {
+		v = []string{}
+	}
+	return Entry{
+		Dict:     id,
+		ID:       e.Prefix + "/" + strconv.Itoa(e.Index),
+		Headword: e.Headword,
+		Variant:  v,
+		HTML:     e.HTML,
+		Text:     e.Text(),
+	}
+}
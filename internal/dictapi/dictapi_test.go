@@ -0,0 +1,118 @@
+package dictapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+func TestServer(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	dw := kobodict.NewWriter(buf)
+	if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte(`<html><w><a name="test" /><var><variant name="tests"/></var><p>A &amp; <b>b</b></p></w><w><a name="testing" /><var></var><p>B</p></w></html>`)); err != nil {
+		t.Fatalf("write dicthtml: %v", err)
+	}
+	for _, w := range []string{"test", "tests", "testing"} {
+		if err := dw.AddWord(w); err != nil {
+			t.Fatalf("add word: %v", err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	dr, err := kobodict.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read dictzip: %v", err)
+	}
+
+	s := Server{CORS: "*"}
+	get := func(url string, status int, v interface{}) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected status %d, got %d: %s", url, status, rec.Code, rec.Body)
+		}
+		if h := rec.Header().Get("Access-Control-Allow-Origin"); h != "*" {
+			t.Errorf("%s: expected cors header, got %q", url, h)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Errorf("%s: decode response: %v", url, err)
+		}
+	}
+
+	s.Update("dicthtml-en", dr, kobodict.PrefixV2, nil)
+	s.Update("dicthtml-xx", nil, nil, errors.New("read failed"))
+
+	var ds struct{ Dictionaries []Dictionary }
+	get("/api/dictionaries", 200, &ds)
+	if exp := []Dictionary{{ID: "dicthtml-en", Words: 3}, {ID: "dicthtml-xx", Error: "read failed"}}; !reflect.DeepEqual(ds.Dictionaries, exp) {
+		t.Errorf("expected dictionaries %+v, got %+v", exp, ds.Dictionaries)
+	}
+
+	var lr struct{ Entries []Entry }
+	get("/api/lookup?q=Tests&dict=dicthtml-en", 200, &lr)
+	if exp := []Entry{{
+		Dict:     "dicthtml-en",
+		ID:       "te/0",
+		Headword: "test",
+		Variant:  []string{"tests"},
+		HTML:     `<w><a name="test" /><var><variant name="tests"/></var><p>A &amp; <b>b</b></p></w>`,
+		Text:     "A & b",
+	}}; !reflect.DeepEqual(lr.Entries, exp) {
+		t.Errorf("expected entries %+v, got %+v", exp, lr.Entries)
+	}
+
+	// like nickel, the first prefix match is used if nothing matches exactly
+	get("/api/lookup?q=testers&dict=dicthtml-en", 200, &lr)
+	if len(lr.Entries) != 1 || lr.Entries[0].ID != "te/0" {
+		t.Errorf("expected prefix match te/0, got %+v", lr.Entries)
+	}
+	get("/api/lookup?q=tx&dict=dicthtml-en", 200, &lr)
+	if len(lr.Entries) != 0 {
+		t.Errorf("expected no entries, got %+v", lr.Entries)
+	}
+
+	// broken dictionaries are skipped unless they are explicitly specified
+	get("/api/lookup?q=test", 200, &lr)
+	if len(lr.Entries) != 1 || lr.Entries[0].Dict != "dicthtml-en" {
+		t.Errorf("expected entry from dicthtml-en, got %+v", lr.Entries)
+	}
+
+	var er struct{ Error string }
+	get("/api/lookup?q=test&dict=dicthtml-en,dicthtml-xx", 500, &er)
+	if er.Error != `dictionary "dicthtml-xx": read failed` {
+		t.Errorf("expected error for broken dictionary, got %q", er.Error)
+	}
+	get("/api/lookup?q=test&dict=nothing", 400, &er)
+	get("/api/lookup?dict=dicthtml-en", 400, &er)
+
+	var cr struct{ Words []string }
+	get("/api/complete?q=TEST&dict=dicthtml-en&limit=2", 200, &cr)
+	if exp := []string{"test", "testing"}; !reflect.DeepEqual(cr.Words, exp) {
+		t.Errorf("expected completions %q, got %q", exp, cr.Words)
+	}
+	get("/api/complete?q=test&dict=dicthtml-en&limit=x", 400, &er)
+	get("/api/complete?q=test", 200, &cr)
+	if exp := []string{"test", "testing", "tests"}; !reflect.DeepEqual(cr.Words, exp) {
+		t.Errorf("expected completions %q, got %q", exp, cr.Words)
+	}
+	get("/api/complete?q=test&dict=dicthtml-xx", 500, &er)
+
+	var e Entry
+	get("/api/entry?dict=dicthtml-en&id=te/1", 200, &e)
+	if e.Headword != "testing" || e.Text != "B" {
+		t.Errorf("expected second entry, got %+v", e)
+	}
+	get("/api/entry?dict=dicthtml-en&id=te/2", 404, &er)
+	get("/api/entry?dict=dicthtml-en&id=te", 400, &er)
+	get("/api/nothing", 404, &er)
+}
@@ -0,0 +1,243 @@
+// Package preview implements a local HTTP server for previewing Kobo
+// dictionaries as they would be shown by the dictionary webview on an eReader.
+// It is used by dictgen serve and dictutil serve.
+package preview
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+// Server serves a search page for a dictzip, which can be replaced at any time
+// (e.g. when it is rebuilt). The zero value is ready to use.
+type Server struct {
+	Title string // shown in the page title
+
+	mu      sync.RWMutex
+	dr      *kobodict.Reader
+	pfn     kobodict.PrefixFunc
+	words   []string // sorted, lowercased
+	err     error
+	version int64
+}
+
+// Update replaces the dictzip being previewed. If err is not nil, it is shown
+// instead of the results (e.g. if the dictzip couldn't be rebuilt). Pages
+// which are open in a browser are reloaded automatically.
+func (s *Server) Update(dr *kobodict.Reader, pfn kobodict.PrefixFunc, err error) {
+	var words []string
+	if dr != nil {
+		words = make([]string, len(dr.Word))
+		for i, w := range dr.Word {
+			words[i] = strings.ToLower(w)
+		}
+		sort.Strings(words)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dr, s.pfn, s.words, s.err = dr, pfn, words, err
+	s.version = time.Now().UnixNano()
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch p := r.URL.Path; {
+	case p == "/":
+		s.serveSearch(w, r)
+	case p == "/version":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-store")
+		io.WriteString(w, strconv.FormatInt(s.version, 10))
+	case strings.HasPrefix(p, "/file/"):
+		s.serveFile(w, r, strings.TrimPrefix(p, "/file/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveFile serves a file from the dictzip (i.e. for dict:/// images).
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	if s.dr != nil {
+		for _, f := range s.dr.File {
+			if f.Name == name {
+				fr, err := f.Open()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				defer fr.Close()
+				if ct := mimeType(name); ct != "" {
+					w.Header().Set("Content-Type", ct)
+				}
+				io.Copy(w, fr)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func mimeType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".svg":
+		return "image/svg+xml"
+	default:
+		return ""
+	}
+}
+
+type searchPage struct {
+	Title       string
+	Version     int64
+	Query       string
+	Prefix      string
+	Entries     []template.HTML
+	Suggestions []string
+	Words       int
+	Err         error
+}
+
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request) {
+	pg := searchPage{
+		Title:   s.Title,
+		Version: s.version,
+		Query:   strings.TrimSpace(r.FormValue("q")),
+		Err:     s.err,
+	}
+
+	if s.dr != nil && pg.Err == nil {
+		pg.Words = len(s.dr.Word)
+		if pg.Query != "" {
+			pg.Prefix = s.pfn(pg.Query)
+			if es, err := s.dr.Lookup(pg.Query, s.pfn); err != nil {
+				pg.Err = fmt.Errorf("lookup %#v: %w", pg.Query, err)
+			} else {
+				for _, e := range es {
+					// images embedded in the dictzip are referenced with dict:///
+					pg.Entries = append(pg.Entries, template.HTML(strings.ReplaceAll(e.HTML, `"dict:///`, `"file/`)))
+				}
+			}
+
+			q := strings.ToLower(pg.Query)
+			for i := sort.SearchStrings(s.words, q); i < len(s.words) && len(pg.Suggestions) < 20 && strings.HasPrefix(s.words[i], q); i++ {
+				if s.words[i] != q {
+					pg.Suggestions = append(pg.Suggestions, s.words[i])
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := searchTmpl.Execute(w, pg); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: render preview: %v.\n", err)
+	}
+}
+
+// searchTmpl renders the search page. The results are shown in a frame which
+// approximates the in-book dictionary on an e-ink screen (with a similar size,
+// font, and grayscale rendering).
+var searchTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with .Query}}{{.}} - {{end}}{{with .Title}}{{.}}{{else}}Dictionary{{end}} - Preview</title>
+<style>
+body { margin: 0; padding: 24px; background: #ddd; font-family: sans-serif; font-size: 14px; color: #333; }
+form { width: 632px; margin: 0 auto 16px; display: flex; gap: 8px; }
+form input[type=search] { flex: 1; font-size: 16px; padding: 6px 8px; }
+.info, .suggestions, .error { width: 632px; margin: 0 auto 12px; }
+.suggestions a { margin-right: 8px; }
+.error { white-space: pre-wrap; color: #900; font-family: monospace; }
+.device { width: 600px; margin: 0 auto; padding: 16px; background: #222; border-radius: 16px; }
+.screen { height: 520px; overflow-y: auto; padding: 12px 18px; background: #f3f3ef; color: #111; filter: grayscale(100%); font-family: Georgia, "Times New Roman", serif; font-size: 19px; line-height: 1.35; }
+.screen img { max-width: 100%; }
+.screen .none { color: #555; font-style: italic; }
+</style>
+</head>
+<body>
+<form method="get" action="">
+<input type="search" name="q" value="{{.Query}}" placeholder="Look up a word" autofocus>
+<input type="submit" value="Look up">
+</form>
+{{- if .Err}}
+<div class="error">Error: {{.Err}}</div>
+{{- else}}
+<div class="info">{{.Words}} words{{with .Prefix}}; looking up in {{.}}.html{{end}}</div>
+{{- end}}
+<div class="device"><div class="screen">
+{{- if .Query}}
+{{- range .Entries}}{{.}}{{else}}<p class="none">No entries found for “{{.Query}}”.</p>{{end}}
+{{- end}}
+</div></div>
+{{- with .Suggestions}}
+<div class="suggestions">Other words: {{range .}}<a href="?q={{.}}">{{.}}</a>{{end}}</div>
+{{- end}}
+<script>
+(function() {
+	var version = "{{.Version}}";
+	setInterval(function() {
+		fetch("version", {cache: "no-store"}).then(function(r) { return r.text(); }).then(function(v) {
+			if (v !== version) location.reload();
+		}).catch(function() {});
+	}, 1000);
+})();
+</script>
+</body>
+</html>
+`))
+
+// Watch calls fn, then calls it again whenever the modification time or size
+// of any of the files it returned changes (or they are created or deleted).
+// It polls the files at the specified interval, and never returns.
+func Watch(interval time.Duration, fn func() []string) {
+	stat := func(files []string) map[string]string {
+		m := map[string]string{}
+		for _, name := range files {
+			if fi, err := os.Stat(name); err == nil {
+				m[name] = fi.ModTime().String() + " " + strconv.FormatInt(fi.Size(), 10)
+			} else {
+				m[name] = ""
+			}
+		}
+		return m
+	}
+
+	files := fn()
+	last := stat(files)
+	for range time.Tick(interval) {
+		cur := stat(files)
+		var changed bool
+		for name, v := range cur {
+			if last[name] != v {
+				changed = true
+				break
+			}
+		}
+		if changed {
+			files = fn()
+			last = stat(files)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/dictutil/kobodict"
+)
+
+func TestServer(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	dw := kobodict.NewWriter(buf)
+	if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte(`<html><w><a name="test" /><var><variant name="tests"/></var><p>A <img src="dict:///test.png"></p></w><w><a name="testing" /><var></var><p>B</p></w></html>`)); err != nil {
+		t.Fatalf("write dicthtml: %v", err)
+	}
+	if fw, err := dw.CreateFile("test.png"); err != nil {
+		t.Fatalf("create file: %v", err)
+	} else if _, err := fw.Write([]byte("png")); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	for _, w := range []string{"test", "tests", "testing"} {
+		if err := dw.AddWord(w); err != nil {
+			t.Fatalf("add word: %v", err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	dr, err := kobodict.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read dictzip: %v", err)
+	}
+
+	var s Server
+	get := func(url string) string {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		b, _ := io.ReadAll(rec.Result().Body)
+		return string(b)
+	}
+
+	s.Update(dr, kobodict.PrefixV2, nil)
+
+	if b := get("/?q=Tests"); !strings.Contains(b, `<p>A <img src="file/test.png"></p>`) || strings.Contains(b, "<p>B</p>") {
+		t.Errorf("expected only the first entry with the image url rewritten, got:\n%s", b)
+	} else if !strings.Contains(b, "te.html") {
+		t.Errorf("expected prefix, got:\n%s", b)
+	}
+	if b := get("/?q=test"); !strings.Contains(b, `href="?q=testing"`) || !strings.Contains(b, `href="?q=tests"`) {
+		t.Errorf("expected suggestions, got:\n%s", b)
+	}
+	if b := get("/?q=nothing"); !strings.Contains(b, "No entries found") {
+		t.Errorf("expected no entries, got:\n%s", b)
+	}
+	if b := get("/file/test.png"); b != "png" {
+		t.Errorf("expected file contents, got %q", b)
+	}
+
+	v := get("/version")
+	s.Update(nil, nil, errors.New("build failed"))
+	if get("/version") == v {
+		t.Errorf("expected version to change")
+	}
+	if b := get("/?q=test"); !strings.Contains(b, "Error: build failed") {
+		t.Errorf("expected error, got:\n%s", b)
+	}
+}
@@ -0,0 +1,158 @@
+package kobodict
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Entry is an entry (<w>...</w>) in a dicthtml file.
+type Entry struct {
+	Prefix   string // the dicthtml file it is in
+	Index    int    // the index of the entry in the dicthtml file
+	Headword string
+	Variant  []string
+	HTML     string
+}
+
+// Entries returns the entries in the dicthtml file for a prefix, or nil if it
+// doesn't exist.
+func (r *Reader) Entries(prefix string) ([]Entry, error) {
+	var f *ReaderDicthtml
+	for _, d := range r.Dicthtml {
+		if d.Prefix == prefix {
+			f = d
+			break
+		}
+	}
+	if f == nil {
+		return nil, nil
+	}
+
+	fr, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open dicthtml %#v: %w", f.Name, err)
+	}
+	defer fr.Close()
+
+	buf, err := ioutil.ReadAll(fr)
+	if err != nil {
+		return nil, fmt.Errorf("read dicthtml %#v: %w", f.Name, err)
+	}
+
+	var es []Entry
+	for i, e := range reshardEntryRe.FindAll(buf, -1) {
+		x := Entry{Prefix: prefix, Index: i, HTML: string(e)}
+		if m := reshardHeadRe.FindSubmatch(e); m != nil {
+			x.Headword = string(m[1])
+		}
+		for _, v := range reshardVariantRe.FindAllSubmatch(e, -1) {
+			x.Variant = append(x.Variant, string(v[1]))
+		}
+		es = append(es, x)
+	}
+	return es, nil
+}
+
+// Lookup returns the entries matching a word in the order they appear in the
+// dicthtml. It approximates the way nickel looks up words (see
+// NormalizeWordReference and MatchKanji), so only the dicthtml for the prefix
+// of the word is searched. If nothing matches exactly, the first entry which is
+// a prefix of the word is returned (i.e. tests will match test). The prefix
+// function should be the one used to create the dictzip.
+func (r *Reader) Lookup(word string, prefix PrefixFunc) ([]Entry, error) {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return nil, nil
+	}
+
+	es, err := r.Entries(prefix(word))
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Entry
+	for _, e := range es {
+		if e.Match(word) {
+			res = append(res, e)
+		}
+	}
+	if len(res) == 0 {
+		for _, e := range es {
+			if e.MatchPrefix(word) {
+				return []Entry{e}, nil
+			}
+		}
+	}
+	return res, nil
+}
+
+// Match checks if the entry would be shown by nickel for a word, assuming it
+// is in the dicthtml for the prefix of the word.
+func (e Entry) Match(word string) bool {
+	queries, lower := entryQueries(word)
+	for _, q := range queries {
+		if MatchKanji(q, e.Headword) {
+			return true
+		}
+	}
+	for _, v := range e.Variant {
+		if v == lower {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPrefix checks if the headword or a variant of the entry is a prefix of
+// the word, which is what nickel falls back to if there aren't any exact
+// matches.
+func (e Entry) MatchPrefix(word string) bool {
+	queries, lower := entryQueries(word)
+	for _, q := range queries {
+		if e.Headword != "" && strings.HasPrefix(q, e.Headword) {
+			return true
+		}
+	}
+	for _, v := range e.Variant {
+		if v != "" && strings.HasPrefix(lower, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryQueries returns the queries to match headwords against, and the one to
+// match variants against. Headwords are matched against the query in
+// different cases, but variants are only matched against the lowercase query.
+func entryQueries(word string) ([]string, string) {
+	word = strings.TrimSpace(word)
+	lower := strings.ToLower(word)
+	queries := []string{word, strings.ToUpper(word), lower}
+	if r := []rune(lower); len(r) != 0 {
+		queries = append(queries, strings.ToUpper(string(r[:1]))+string(r[1:]))
+	}
+	return queries, lower
+}
+
+var (
+	entryBlockRe = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|h[1-6]|tr|blockquote|pre)>`)
+	entryVarRe   = regexp.MustCompile(`(?s)<var>.*?</var>`)
+	entryTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+	entrySpaceRe = regexp.MustCompile(`[ \t\r\f]+`)
+	entryLinesRe = regexp.MustCompile(`\s*\n\s*`)
+)
+
+// Text converts the HTML of the entry to plain text. Block-level elements are
+// separated by newlines.
+func (e Entry) Text() string {
+	s := entryVarRe.ReplaceAllString(e.HTML, "")
+	s = entryBlockRe.ReplaceAllString(s, "$0\n")
+	s = entryTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = entrySpaceRe.ReplaceAllString(s, " ")
+	s = entryLinesRe.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,109 @@
+package kobodict
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	dw := NewWriter(buf)
+	if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte(`<html><w><a name="te" /><var></var>1</w><w><a name="test" /><var></var>2</w><w><a name="Test" /><var></var>3</w><w><a name="tent" /><var><variant name="tenting"/></var>4</w></html>`)); err != nil {
+		t.Fatalf("write dicthtml: %v", err)
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	dr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read dictzip: %v", err)
+	}
+
+	for _, c := range []struct {
+		Word string
+		Exp  []int
+	}{
+		{"test", []int{1, 2}},
+		{"tests", []int{0}},    // the first prefix match, not the longest
+		{"tentings", []int{0}}, // even if a variant is a longer prefix
+		{"tenting", []int{3}},  // exact variant match
+		{"TENT", []int{3}},     // exact headword match in a different case
+		{"t", nil},             // dicthtml doesn't exist
+		{"  ", nil},
+	} {
+		es, err := dr.Lookup(c.Word, PrefixV2)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.Word, err)
+			continue
+		}
+		var act []int
+		for _, e := range es {
+			act = append(act, e.Index)
+		}
+		if !reflect.DeepEqual(act, c.Exp) {
+			t.Errorf("%q: expected entries %v, got %v", c.Word, c.Exp, act)
+		}
+	}
+}
+
+func TestEntryMatch(t *testing.T) {
+	es := []Entry{
+		{Headword: "Test", HTML: "1"},
+		{Headword: "test", Variant: []string{"tests"}, HTML: "2"},
+		{Headword: "testing", Variant: []string{"test"}, HTML: "3"},
+		{Headword: "書く", HTML: "4"},
+	}
+	for _, c := range []struct {
+		Word string
+		Exp  []string
+	}{
+		{"test", []string{"1", "2", "3"}},
+		{" TEST ", []string{"1", "2", "3"}},
+		{"Tests", []string{"2"}},
+		{"testin", nil},
+		{"書かない", []string{"4"}},
+	} {
+		var act []string
+		for _, e := range es {
+			if e.Match(c.Word) {
+				act = append(act, e.HTML)
+			}
+		}
+		if !reflect.DeepEqual(act, c.Exp) {
+			t.Errorf("%q: expected %q, got %q", c.Word, c.Exp, act)
+		}
+	}
+}
+
+func TestEntryMatchPrefix(t *testing.T) {
+	for _, c := range []struct {
+		Entry Entry
+		Word  string
+		Exp   bool
+	}{
+		{Entry{Headword: "test"}, "tests", true},
+		{Entry{Headword: "test"}, "Tests", true},
+		{Entry{Headword: "Test"}, "testing", true},
+		{Entry{Headword: "test"}, "test", true},
+		{Entry{Headword: "tests"}, "test", false},
+		{Entry{Headword: "test", Variant: []string{"try"}}, "trying", true},
+		{Entry{Headword: "test", Variant: []string{"try"}}, "TRYING", true},
+		{Entry{Variant: []string{""}}, "test", false},
+		{Entry{}, "test", false},
+	} {
+		if act := c.Entry.MatchPrefix(c.Word); act != c.Exp {
+			t.Errorf("%+v %q: expected %t, got %t", c.Entry, c.Word, c.Exp, act)
+		}
+	}
+}
+
+func TestEntryText(t *testing.T) {
+	e := Entry{HTML: `<w><p><a name="test" /><b>test</b> -noun</p><var><variant name="tests"/></var><p>A <i>trial</i> &amp; an<br>exam.</p><ul><li>One</li><li>Two</li></ul></w>`}
+	if exp := "test -noun\nA trial & an\nexam.\nOne\nTwo"; e.Text() != exp {
+		t.Errorf("expected %q, got %q", exp, e.Text())
+	}
+}
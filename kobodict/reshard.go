@@ -0,0 +1,171 @@
+package kobodict
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+)
+
+var (
+	reshardEntryRe   = regexp.MustCompile(`(?s)<w>.*?</w>`)
+	reshardHeadRe    = regexp.MustCompile(`<a name="([^"]*)"`)
+	reshardVariantRe = regexp.MustCompile(`<variant name="([^"]*)"`)
+)
+
+// Reshard copies the contents of a Reader to a Writer, which should not have
+// been used yet, re-calculating the prefixes of the dicthtml files using the
+// writer's prefix function (see Writer.SetPrefixFunc). It can be used to
+// convert a v1 dictionary into a v2 one. Reshard will not close the writer.
+//
+// Each <w> entry is placed in the dicthtml file for the prefix of its headword
+// and the prefixes of each of its variants. Entries which were duplicated
+// across multiple dicthtml files in the original dictzip are only included
+// once per new dicthtml file.
+//
+// If there is any non-whitespace text outside of the <w> entries (other than
+// the <html> tags), an error is returned, since it can't be resharded (some v1
+// dictionaries have entries which are missing the <w> tags). To discard it
+// instead, use ReshardDiscard.
+func Reshard(w *Writer, r *Reader) error {
+	_, err := reshard(w, r, false)
+	return err
+}
+
+// ReshardDiscard is like Reshard, but text outside of the <w> entries is
+// discarded instead of returning an error. The number of discarded fragments
+// is returned.
+func ReshardDiscard(w *Writer, r *Reader) (discarded int, err error) {
+	return reshard(w, r, true)
+}
+
+func reshard(w *Writer, r *Reader, discard bool) (int, error) {
+	for _, f := range r.File {
+		if err := func() error {
+			fr, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("open file: %w", err)
+			}
+			defer fr.Close()
+
+			fw, err := w.CreateFile(f.Name)
+			if err != nil {
+				return fmt.Errorf("create dictzip entry: %w", err)
+			}
+
+			if _, err := io.Copy(fw, fr); err != nil {
+				return fmt.Errorf("copy file: %w", err)
+			}
+			return nil
+		}(); err != nil {
+			return 0, fmt.Errorf("copy file %#v: %w", f.Name, err)
+		}
+	}
+
+	type entry struct {
+		headword string
+		html     []byte
+	}
+
+	var discarded int
+	prefixed := map[string][]entry{}
+	seen := map[string]map[string]bool{}
+	for _, f := range r.Dicthtml {
+		buf, err := func() ([]byte, error) {
+			fr, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open dicthtml: %w", err)
+			}
+			defer fr.Close()
+			return ioutil.ReadAll(fr)
+		}()
+		if err != nil {
+			return 0, fmt.Errorf("read dicthtml %#v: %w", f.Name, err)
+		}
+
+		var last int
+		for _, loc := range append(reshardEntryRe.FindAllIndex(buf, -1), []int{len(buf), len(buf)}) {
+			if t := reshardOutsideText(buf[last:loc[0]]); len(t) != 0 {
+				if !discard {
+					return 0, fmt.Errorf("read dicthtml %#v: text outside of <w> entries would be discarded: %#v", f.Name, string(t))
+				}
+				discarded++
+			}
+			last = loc[1]
+			if loc[0] == loc[1] {
+				break
+			}
+
+			e := buf[loc[0]:loc[1]]
+			m := reshardHeadRe.FindSubmatch(e)
+			if m == nil {
+				return 0, fmt.Errorf("read dicthtml %#v: parse entry %#v: no headword found", f.Name, string(e))
+			}
+			hw := string(m[1])
+
+			pfx := map[string]bool{w.Prefix(hw): true}
+			for _, v := range reshardVariantRe.FindAllSubmatch(e, -1) {
+				pfx[w.Prefix(string(v[1]))] = true
+			}
+
+			for p := range pfx {
+				if seen[p] == nil {
+					seen[p] = map[string]bool{}
+				}
+				if seen[p][string(e)] {
+					continue
+				}
+				seen[p][string(e)] = true
+				prefixed[p] = append(prefixed[p], entry{hw, e})
+			}
+		}
+	}
+
+	var prefixes []string
+	for p := range prefixed {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	hbuf := bytes.NewBuffer(nil)
+	for _, p := range prefixes {
+		es := prefixed[p]
+
+		// must be sorted for proper matching (see dictgen)
+		sort.SliceStable(es, func(i, j int) bool {
+			return es[i].headword < es[j].headword
+		})
+
+		hbuf.Reset()
+		hbuf.WriteString("<html>")
+		for _, e := range es {
+			hbuf.Write(e.html)
+		}
+		hbuf.WriteString("</html>")
+
+		if hw, err := w.CreateDicthtml(p); err != nil {
+			return 0, fmt.Errorf("write dicthtml for %s: %w", p, err)
+		} else if _, err := hw.Write(hbuf.Bytes()); err != nil {
+			return 0, fmt.Errorf("write dicthtml for %s: %w", p, err)
+		}
+	}
+
+	for _, word := range r.Word {
+		if err := w.AddWord(word); err != nil {
+			return 0, fmt.Errorf("add word %#v: %w", word, err)
+		}
+	}
+
+	return discarded, nil
+}
+
+// reshardOutsideText returns the text between <w> entries, without whitespace
+// and the <html> tags.
+func reshardOutsideText(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	b = bytes.TrimSpace(bytes.TrimPrefix(b, []byte("<html>")))
+	b = bytes.TrimSpace(bytes.TrimSuffix(b, []byte("</html>")))
+	return b
+}
@@ -0,0 +1,107 @@
+package kobodict
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReshard(t *testing.T) {
+	v1 := map[string]string{
+		"1b": `<html><w><a name="ébahir" /><var></var>ébahir</w><w><a name="ébauche" /><var><variant name="test"/></var>ébauche</w></html>`,
+		"te": `<html><w><a name="test" /><var></var>test</w><w><a name="ébauche" /><var><variant name="test"/></var>ébauche</w></html>`,
+	}
+	v2 := map[string]string{
+		"éb": `<html><w><a name="ébahir" /><var></var>ébahir</w><w><a name="ébauche" /><var><variant name="test"/></var>ébauche</w></html>`,
+		"te": `<html><w><a name="test" /><var></var>test</w><w><a name="ébauche" /><var><variant name="test"/></var>ébauche</w></html>`,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	dw := NewWriter(buf)
+	dw.SetPrefixFunc(PrefixV1)
+	for _, p := range []string{"1b", "te"} {
+		if hw, err := dw.CreateDicthtml(p); err != nil {
+			t.Fatalf("create v1 dicthtml: %v", err)
+		} else if _, err := hw.Write([]byte(v1[p])); err != nil {
+			t.Fatalf("write v1 dicthtml: %v", err)
+		}
+	}
+	for _, w := range []string{"ébahir", "ébauche", "test"} {
+		if err := dw.AddWord(w); err != nil {
+			t.Fatalf("add word: %v", err)
+		}
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatalf("close v1 writer: %v", err)
+	}
+
+	dr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read v1 dictzip: %v", err)
+	}
+
+	nbuf := bytes.NewBuffer(nil)
+	nw := NewWriter(nbuf)
+	nw.SetPrefixFunc(PrefixV2)
+	if err := Reshard(nw, dr); err != nil {
+		t.Fatalf("reshard: unexpected error: %v", err)
+	} else if err := nw.Close(); err != nil {
+		t.Fatalf("close v2 writer: %v", err)
+	}
+
+	nr, err := NewReader(bytes.NewReader(nbuf.Bytes()), int64(nbuf.Len()))
+	if err != nil {
+		t.Fatalf("read v2 dictzip: %v", err)
+	}
+
+	if !reflect.DeepEqual(nr.Word, dr.Word) {
+		t.Errorf("expected words %#v, got %#v", dr.Word, nr.Word)
+	}
+
+	act := map[string]string{}
+	for _, f := range nr.Dicthtml {
+		fr, err := f.Open()
+		if err != nil {
+			t.Fatalf("open v2 dicthtml %s: %v", f.Name, err)
+		}
+		b, err := ioutil.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			t.Fatalf("read v2 dicthtml %s: %v", f.Name, err)
+		}
+		act[f.Prefix] = string(b)
+	}
+	if !reflect.DeepEqual(v2, act) {
+		t.Errorf("expected dicthtml %#v, got %#v", v2, act)
+	}
+}
+
+func TestReshardOutsideText(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	dw := NewWriter(buf)
+	dw.SetPrefixFunc(PrefixV1)
+	if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create v1 dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte("<html>\n<w><a name=\"test\" /><var></var>test</w>\n<a name=\"tester\" /><var></var>tester</w>\n</html>")); err != nil {
+		t.Fatalf("write v1 dicthtml: %v", err)
+	} else if err := dw.Close(); err != nil {
+		t.Fatalf("close v1 writer: %v", err)
+	}
+
+	dr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read v1 dictzip: %v", err)
+	}
+
+	if err := Reshard(NewWriter(bytes.NewBuffer(nil)), dr); err == nil || !strings.Contains(err.Error(), `text outside of <w> entries would be discarded: "<a name=\"tester\" /><var></var>tester</w>"`) {
+		t.Errorf("reshard: expected error about discarded text, got %v", err)
+	}
+
+	if n, err := ReshardDiscard(NewWriter(bytes.NewBuffer(nil)), dr); err != nil {
+		t.Errorf("reshard (discard): unexpected error: %v", err)
+	} else if n != 1 {
+		t.Errorf("reshard (discard): expected 1 discarded fragment, got %d", n)
+	}
+}
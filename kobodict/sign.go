@@ -0,0 +1,175 @@
+package kobodict
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SignMethodEd25519 is the prefix for ed25519 dictzip signatures.
+const SignMethodEd25519 string = "ed25519"
+
+// ContentHash calculates the SHA-256 hash of the contents of a dictzip. Only
+// the names and uncompressed contents of the entries (in lexical order) are
+// used, so it is independent of the zip comment and the layout of the zip.
+// Every entry is included, even if it isn't a regular file, since nickel reads
+// files by name regardless of the mode.
+func ContentHash(r io.ReaderAt, size int64) ([]byte, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("open zip: %w", err)
+	}
+
+	zfs := append([]*zip.File(nil), zr.File...)
+	sort.SliceStable(zfs, func(i, j int) bool {
+		return zfs[i].Name < zfs[j].Name
+	})
+
+	h := sha256.New()
+	for _, zf := range zfs {
+		if err := func() error {
+			fr, err := zf.Open()
+			if err != nil {
+				return fmt.Errorf("open zip entry: %w", err)
+			}
+			defer fr.Close()
+
+			fh := sha256.New()
+			n, err := io.Copy(fh, fr)
+			if err != nil {
+				return fmt.Errorf("read zip entry: %w", err)
+			}
+
+			// name, null terminator, uint64 size, sha256 of contents
+			var tmp [8]byte
+			binary.BigEndian.PutUint64(tmp[:], uint64(n))
+			h.Write([]byte(zf.Name))
+			h.Write([]byte{0})
+			h.Write(tmp[:])
+			h.Write(fh.Sum(nil))
+			return nil
+		}(); err != nil {
+			return nil, fmt.Errorf("hash file %#v: %w", zf.Name, err)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign signs the content hash of a dictzip, and returns the signature in the
+// textual format used for the zip comment and sidecar files.
+func Sign(r io.ReaderAt, size int64, key ed25519.PrivateKey) (string, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("invalid ed25519 private key length %d", len(key))
+	}
+	hash, err := ContentHash(r, size)
+	if err != nil {
+		return "", fmt.Errorf("hash dictzip: %w", err)
+	}
+	return SignMethodEd25519 + ":" + base64.StdEncoding.EncodeToString(ed25519.Sign(key, hash)), nil
+}
+
+// Verify checks a signature (in the format returned by Sign) against the
+// content hash of a dictzip. Dictzips with duplicate names or entries which
+// aren't regular files (e.g. directories or symlinks) are rejected, since
+// they could be read differently than they were hashed.
+func Verify(r io.ReaderAt, size int64, sig string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key length %d", len(key))
+	}
+	buf, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+	if err := checkEntries(r, size); err != nil {
+		return err
+	}
+	hash, err := ContentHash(r, size)
+	if err != nil {
+		return fmt.Errorf("hash dictzip: %w", err)
+	}
+	if !ed25519.Verify(key, hash, buf) {
+		return fmt.Errorf("signature does not match dictzip contents")
+	}
+	return nil
+}
+
+// ReadCommentSignature reads the signature stored in the zip comment of a
+// dictzip. If there isn't one, an empty string is returned.
+func ReadCommentSignature(r io.ReaderAt, size int64) (string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", fmt.Errorf("open zip: %w", err)
+	}
+	if c := strings.TrimSpace(zr.Comment); strings.HasPrefix(c, SignMethodEd25519+":") {
+		return c, nil
+	}
+	return "", nil
+}
+
+// WriteCommentSignature copies the dictzip from r to w, setting the zip comment
+// to the signature. The compressed file contents are copied as-is, so the
+// content hash is unchanged.
+func WriteCommentSignature(w io.Writer, r io.ReaderAt, size int64, sig string) error {
+	if _, err := parseSignature(sig); err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	zw := zip.NewWriter(w)
+	for _, zf := range zr.File {
+		if err := zw.Copy(zf); err != nil {
+			return fmt.Errorf("copy zip entry %#v: %w", zf.Name, err)
+		}
+	}
+	if err := zw.SetComment(sig); err != nil {
+		return fmt.Errorf("set zip comment: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close zip: %w", err)
+	}
+	return nil
+}
+
+// checkEntries ensures all entries in a dictzip are regular files with unique
+// names.
+func checkEntries(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, zf := range zr.File {
+		if seen[zf.Name] {
+			return fmt.Errorf("invalid dictzip: duplicate entry %#v", zf.Name)
+		}
+		seen[zf.Name] = true
+		if !zf.Mode().IsRegular() || strings.HasSuffix(zf.Name, "/") {
+			return fmt.Errorf("invalid dictzip: entry %#v is not a regular file", zf.Name)
+		}
+	}
+	return nil
+}
+
+func parseSignature(sig string) ([]byte, error) {
+	spl := strings.SplitN(strings.TrimSpace(sig), ":", 2)
+	if len(spl) != 2 {
+		return nil, fmt.Errorf("invalid signature: no method specified")
+	} else if spl[0] != SignMethodEd25519 {
+		return nil, fmt.Errorf("invalid signature: unknown method %#v", spl[0])
+	}
+	buf, err := base64.StdEncoding.DecodeString(spl[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: decode base64: %w", err)
+	} else if len(buf) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid signature: incorrect length %d", len(buf))
+	}
+	return buf, nil
+}
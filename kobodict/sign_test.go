@@ -0,0 +1,156 @@
+package kobodict
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	dw := NewWriter(buf)
+	if err := dw.AddWord("test"); err != nil {
+		t.Fatalf("add word: %v", err)
+	} else if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte(`<html><w><a name="test" /><var></var>test</w></html>`)); err != nil {
+		t.Fatalf("write dicthtml: %v", err)
+	} else if err := dw.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+	dz := buf.Bytes()
+
+	sig, err := Sign(bytes.NewReader(dz), int64(len(dz)), priv)
+	if err != nil {
+		t.Fatalf("sign: unexpected error: %v", err)
+	}
+
+	if err := Verify(bytes.NewReader(dz), int64(len(dz)), sig, pub); err != nil {
+		t.Errorf("verify original: unexpected error: %v", err)
+	}
+
+	if sig, err := ReadCommentSignature(bytes.NewReader(dz), int64(len(dz))); err != nil {
+		t.Errorf("read comment signature: unexpected error: %v", err)
+	} else if sig != "" {
+		t.Errorf("read comment signature: expected no signature, got %#v", sig)
+	}
+
+	sbuf := bytes.NewBuffer(nil)
+	if err := WriteCommentSignature(sbuf, bytes.NewReader(dz), int64(len(dz)), sig); err != nil {
+		t.Fatalf("write comment signature: unexpected error: %v", err)
+	}
+	sdz := sbuf.Bytes()
+
+	if csig, err := ReadCommentSignature(bytes.NewReader(sdz), int64(len(sdz))); err != nil {
+		t.Errorf("read comment signature: unexpected error: %v", err)
+	} else if csig != sig {
+		t.Errorf("read comment signature: expected %#v, got %#v", sig, csig)
+	} else if err := Verify(bytes.NewReader(sdz), int64(len(sdz)), csig, pub); err != nil {
+		t.Errorf("verify commented: unexpected error: %v", err)
+	}
+
+	if opub, _, err := ed25519.GenerateKey(nil); err != nil {
+		t.Fatalf("generate key: %v", err)
+	} else if err := Verify(bytes.NewReader(dz), int64(len(dz)), sig, opub); err == nil {
+		t.Errorf("verify with wrong key: expected error")
+	}
+
+	buf.Reset()
+	dw = NewWriter(buf)
+	if err := dw.AddWord("tset"); err != nil {
+		t.Fatalf("add word: %v", err)
+	} else if hw, err := dw.CreateDicthtml("te"); err != nil {
+		t.Fatalf("create dicthtml: %v", err)
+	} else if _, err := hw.Write([]byte(`<html><w><a name="test" /><var></var>test</w></html>`)); err != nil {
+		t.Fatalf("write dicthtml: %v", err)
+	} else if err := dw.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), int64(buf.Len()), sig, pub); err == nil {
+		t.Errorf("verify modified: expected error")
+	}
+}
+
+func TestVerifyEntries(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	for _, c := range []struct {
+		What  string
+		Files []*zip.FileHeader
+		Err   string
+	}{
+		{"regular", []*zip.FileHeader{{Name: "words"}, {Name: "11.html"}}, ""},
+		{"directory", []*zip.FileHeader{{Name: "words"}, {Name: "11.html/"}}, `invalid dictzip: entry "11.html/" is not a regular file`},
+		{"symlink", []*zip.FileHeader{{Name: "words"}, symlinkHeader("11.html")}, `invalid dictzip: entry "11.html" is not a regular file`},
+		{"duplicate", []*zip.FileHeader{{Name: "words"}, {Name: "11.html"}, {Name: "11.html"}}, `invalid dictzip: duplicate entry "11.html"`},
+	} {
+		buf := bytes.NewBuffer(nil)
+		zw := zip.NewWriter(buf)
+		for i, fh := range c.Files {
+			if w, err := zw.CreateHeader(fh); err != nil {
+				t.Fatalf("%s: create zip entry: %v", c.What, err)
+			} else if strings.HasSuffix(fh.Name, "/") {
+				continue // directories can't have contents
+			} else if _, err := fmt.Fprintf(w, "file %d", i); err != nil {
+				t.Fatalf("%s: write zip entry: %v", c.What, err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("%s: close zip: %v", c.What, err)
+		}
+		dz := buf.Bytes()
+
+		sig, err := Sign(bytes.NewReader(dz), int64(len(dz)), priv)
+		if err != nil {
+			t.Fatalf("%s: sign: unexpected error: %v", c.What, err)
+		}
+		err = Verify(bytes.NewReader(dz), int64(len(dz)), sig, pub)
+		if c.Err == "" && err != nil {
+			t.Errorf("%s: verify: unexpected error: %v", c.What, err)
+		} else if c.Err != "" && (err == nil || err.Error() != c.Err) {
+			t.Errorf("%s: verify: expected error %q, got %v", c.What, c.Err, err)
+		}
+	}
+
+	// a file added with non-regular mode bits must change the content hash
+	hash := func(fhs ...*zip.FileHeader) []byte {
+		buf := bytes.NewBuffer(nil)
+		zw := zip.NewWriter(buf)
+		for _, fh := range fhs {
+			if w, err := zw.CreateHeader(fh); err != nil {
+				t.Fatalf("create zip entry: %v", err)
+			} else if _, err := w.Write([]byte("test")); err != nil {
+				t.Fatalf("write zip entry: %v", err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("close zip: %v", err)
+		}
+		h, err := ContentHash(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("content hash: %v", err)
+		}
+		return h
+	}
+	if bytes.Equal(hash(&zip.FileHeader{Name: "words"}), hash(&zip.FileHeader{Name: "words"}, symlinkHeader("11.html"))) {
+		t.Errorf("expected symlink entry to be included in the content hash")
+	}
+}
+
+func symlinkHeader(name string) *zip.FileHeader {
+	fh := &zip.FileHeader{Name: name}
+	fh.SetMode(os.ModeSymlink | 0777)
+	return fh
+}
@@ -7,10 +7,54 @@
 package kobodict
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 )
 
+// PrefixFunc calculates the prefix of a word for sharding dicthtml files.
+type PrefixFunc func(word string) string
+
+// Prefix algorithms which can be used with ParsePrefixFunc.
+const (
+	PrefixMethodV1       string = "v1"
+	PrefixMethodV2       string = "v2"
+	PrefixMethodJapanese string = "ja"
+)
+
+// ParsePrefixFunc returns the PrefixFunc for the specified algorithm.
+func ParsePrefixFunc(method string) (PrefixFunc, error) {
+	switch method {
+	case PrefixMethodV1:
+		return PrefixV1, nil
+	case PrefixMethodV2:
+		return PrefixV2, nil
+	case PrefixMethodJapanese:
+		return WordPrefixJapanese, nil
+	default:
+		return nil, fmt.Errorf("unknown prefix algorithm %#v", method)
+	}
+}
+
+// PrefixV1 gets the prefix of a word for v1 dictionaries (firmware versions
+// before 4.7.10364). It is the same as PrefixV2, but all non-ASCII characters
+// are converted to '1' afterwards.
+func PrefixV1(word string) string {
+	pfx := []rune(WordPrefix(word))
+	for i, c := range pfx {
+		if c > unicode.MaxASCII {
+			pfx[i] = '1'
+		}
+	}
+	return string(pfx)
+}
+
+// PrefixV2 gets the prefix of a word for v2 dictionaries (firmware 4.7.10364+).
+// It is equivalent to WordPrefix.
+func PrefixV2(word string) string {
+	return WordPrefix(word)
+}
+
 // NormalizeWordReference normalizes a word for use in an dicthtml headword
 // (<a name="...") or variant (<variant name="..."). It matches the way Kobo
 // finds words in a file.
@@ -84,6 +128,119 @@ func WordPrefix(word string) string {
 	return string(pfx)
 }
 
+// WordPrefixJapanese gets the prefix of a word for sharding dicthtml files in
+// Japanese dictionaries (i.e. jaxxdjs).
+//
+// Words starting with kana or kanji are not padded with 'a's, and the second
+// character is dropped if it isn't a letter. Other words are handled the same
+// way as WordPrefix.
+//
+// Note that this is an approximation. It is consistent with the shard names in
+// dicthtml-ja, but hasn't been verified against nickel with dictword-test.
+func WordPrefixJapanese(word string) string {
+	pfx := []rune(word)
+
+	for i, c := range pfx {
+		if i >= 2 || c == '\x00' { // limit to 2 chars, also cut at null
+			pfx = pfx[:i]
+			break
+		}
+		pfx[i] = unicode.ToLower(c)
+	}
+
+	for len(pfx) != 0 && unicode.IsSpace(pfx[0]) {
+		pfx = pfx[1:] // trim left space
+	}
+
+	for len(pfx) != 0 && unicode.IsSpace(pfx[len(pfx)-1]) {
+		pfx = pfx[:len(pfx)-1] // trim right space
+	}
+
+	if len(pfx) == 0 || !isJapanese(pfx[0]) {
+		return WordPrefix(word)
+	}
+
+	if len(pfx) == 2 && !unicode.IsLetter(pfx[1]) && !isJapanese(pfx[1]) {
+		pfx = pfx[:1]
+	}
+
+	return string(pfx)
+}
+
+// The range of characters nickel allows after a kanji stem when matching
+// Japanese headwords (the ([%1-%2]?) regexp in DictionaryParser).
+const (
+	okuriganaFirst = '\u3041' // ぁ
+	okuriganaLast  = '\u3093' // ん
+)
+
+// KanjiStem removes all trailing okurigana (hiragana) from a word containing
+// kanji. If the word doesn't contain kanji, it is returned as-is.
+func KanjiStem(word string) string {
+	r := []rune(strings.TrimSpace(word))
+
+	var kanji bool
+	for _, c := range r {
+		if unicode.Is(unicode.Han, c) {
+			kanji = true
+			break
+		}
+	}
+	if !kanji {
+		return string(r)
+	}
+
+	for len(r) != 0 && isOkurigana(r[len(r)-1]) {
+		r = r[:len(r)-1]
+	}
+	return string(r)
+}
+
+// MatchKanji approximates whether a headword would be matched by nickel for a
+// Japanese query containing kanji. The headword matches if it is equal to the
+// query, or to the query with one or more trailing okurigana characters
+// removed, optionally followed by a single okurigana character (e.g. 食べた
+// matches 食べる and 食べ, and 見ました matches 見る).
+//
+// Note that this is an approximation. It is only inferred from the
+// kanji-specific regexps in DictionaryParser::searchWordMultipleCases in
+// libnickel (i.e. the ([%1-%2]?) suffix), and the exact way nickel derives the
+// stem from the query hasn't been verified on a device.
+func MatchKanji(query, headword string) bool {
+	query, headword = strings.TrimSpace(query), strings.TrimSpace(headword)
+	if query == headword {
+		return true
+	}
+
+	stem := []rune(query)
+	if string(stem) == KanjiStem(query) {
+		return false // no kanji or okurigana
+	}
+	for len(stem) != 0 && isOkurigana(stem[len(stem)-1]) {
+		stem = stem[:len(stem)-1]
+		if !strings.HasPrefix(headword, string(stem)) {
+			continue
+		}
+		switch rest := []rune(headword[len(string(stem)):]); len(rest) {
+		case 0:
+			return true
+		case 1:
+			if isOkurigana(rest[0]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isOkurigana(c rune) bool {
+	return c >= okuriganaFirst && c <= okuriganaLast
+}
+
+func isJapanese(c rune) bool {
+	return unicode.In(c, unicode.Hiragana, unicode.Katakana, unicode.Han)
+}
+
 // wordPrefix gets the prefix of a word for sharding dicthtml files.
 //
 // This is not to be used with Kanji, as those are handled by a separate
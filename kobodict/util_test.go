@@ -44,11 +44,7 @@ var tcs = []struct{ w, p string }{
 	{"aérer", "aé"},
 	{"living-room", "li"},
 
-	// dicthtml-ja
-	// Note, Kanji not currently implemented, so not testing (note, the logic
-	// is in a separate function, anyways).
-	// {"あ", "あ"},
-	// {"アークとう", "アー"},
+	// dicthtml-ja: see tcsJapanese
 
 	// generated by dictword-test: spaces
 	{" x", "xa"},
@@ -134,6 +130,78 @@ func TestWordPrefix(t *testing.T) {
 	}
 }
 
+func TestPrefixV1(t *testing.T) {
+	for _, tc := range []struct{ w, p string }{
+		{"test", "te"},
+		{"ébahir", "1b"},
+		{"à", "1a"},
+		{"aérer", "a1"},
+		{"a1", "11"},
+		{"дaд", "1a"},
+		{"д", "1"},
+		{"未未", "11"},
+		{" x", "xa"},
+	} {
+		t.Logf("word %#v (%#v)", tc.w, tc.p)
+		if p := PrefixV1(tc.w); p != tc.p {
+			t.Errorf("    got %#v", p)
+		}
+	}
+}
+
+var tcsJapanese = []struct{ w, p string }{
+	// dicthtml-ja
+	{"あ", "あ"},
+	{"アークとう", "アー"},
+
+	// synthetic (not verified on a device)
+	{"食べる", "食べ"},
+	{"見る", "見る"},
+	{" 見", "見"},
+	{"見!", "見"},
+	{"ｱ", "ｱ"},
+	{"  見", "11"},
+	{"test", "te"},
+	{"a", "aa"},
+	{"д", "д"},
+	{"!", "11"},
+	{"", "11"},
+}
+
+func TestWordPrefixJapanese(t *testing.T) {
+	for _, tc := range tcsJapanese {
+		t.Logf("word %#v (%#v)", tc.w, tc.p)
+		if p := WordPrefixJapanese(tc.w); p != tc.p {
+			t.Errorf("    got %#v", p)
+		}
+	}
+}
+
+func TestMatchKanji(t *testing.T) {
+	for _, tc := range []struct {
+		q, h string
+		m    bool
+	}{
+		{"見る", "見る", true},
+		{"見た", "見る", true},
+		{"見た", "見", true},
+		{"見ました", "見る", true},
+		{"見ました", "見える", false},
+		{"見た", "見学", false},
+		{"食べた", "食べ", true},
+		{"食べた", "食べる", true},
+		{"食べた", "食べ物", false},
+		{"たべた", "たべる", false},
+		{"test", "test", true},
+		{"tests", "test", false},
+	} {
+		t.Logf("query %#v headword %#v (%t)", tc.q, tc.h, tc.m)
+		if m := MatchKanji(tc.q, tc.h); m != tc.m {
+			t.Errorf("    got %t", m)
+		}
+	}
+}
+
 func BenchmarkWordPrefix(b *testing.B) {
 	for _, tcf := range []struct {
 		n  string
@@ -13,11 +13,13 @@ import (
 	"github.com/pgaskin/go-marisa"
 )
 
-// Writer creates dictzips. It does not do any validation; it only does what it
+// Writer creates dictzips. Other than checking the prefixes of words if a
+// prefix function is set, it does not do any validation; it only does what it
 // is told. It is up to the user to ensure the input is valid.
 type Writer struct {
 	z      *zip.Writer
 	e      Encrypter
+	p      PrefixFunc
 	words  map[string]struct{} // doesn't take up space for values
 	used   map[string]struct{}
 	closed bool
@@ -147,17 +149,25 @@ func (w *Writer) Close() error {
 		w.last = nil
 	}
 
-	var trie marisa.Trie
-	if err := trie.Build(maps.Keys(w.words), marisa.Config{}); err != nil {
-		return fmt.Errorf("build index: %w", err)
-	}
-
 	var words []string
 	for word := range w.words {
 		words = append(words, word)
 	}
 	sort.Strings(words)
 
+	if w.p != nil {
+		for _, word := range words {
+			if pfx := w.p(word); !w.Exists(pfx + ".html") {
+				return fmt.Errorf("word %#v: no dicthtml file for prefix %#v", word, pfx)
+			}
+		}
+	}
+
+	var trie marisa.Trie
+	if err := trie.Build(maps.Keys(w.words), marisa.Config{}); err != nil {
+		return fmt.Errorf("build index: %w", err)
+	}
+
 	if fw, err := w.z.Create("words"); err != nil {
 		return fmt.Errorf("create index zip entry: %w", err)
 	} else if _, err := trie.WriteTo(fw); err != nil {
@@ -176,6 +186,24 @@ func (w *Writer) SetEncrypter(e Encrypter) {
 	w.e = e
 }
 
+// SetPrefixFunc sets the function used by Prefix to calculate the prefix of
+// words for dicthtml files. If it is set, Close will return an error if a word
+// added with AddWord doesn't have a dicthtml file for its prefix (since Kobo
+// wouldn't be able to find it).
+func (w *Writer) SetPrefixFunc(fn PrefixFunc) {
+	w.p = fn
+}
+
+// Prefix calculates the prefix for a word using the function set with
+// SetPrefixFunc, or PrefixV2 if it isn't set. It should be used to choose the
+// dicthtml file to pass to CreateDicthtml for each word.
+func (w *Writer) Prefix(word string) string {
+	if w.p == nil {
+		return PrefixV2(word)
+	}
+	return w.p(word)
+}
+
 type encryptWriter struct {
 	e Encrypter
 	w io.Writer
@@ -1,3 +1,40 @@
 package kobodict
 
+import (
+	"io"
+	"testing"
+)
+
 // TODO(v1)
+
+func TestWriterPrefix(t *testing.T) {
+	for _, c := range []struct {
+		Prefix PrefixFunc
+		Words  []string
+		Files  []string
+		Err    string
+	}{
+		{nil, []string{"apple", "banana"}, []string{"xx"}, ""},
+		{PrefixV2, []string{"apple", "apricot", "banana"}, []string{"ap", "ba"}, ""},
+		{PrefixV2, []string{"apple", "banana", "cherry"}, []string{"ap", "ba"}, `word "cherry": no dicthtml file for prefix "ch"`},
+		{PrefixV1, []string{"éa"}, []string{"éa"}, `word "éa": no dicthtml file for prefix "1a"`},
+	} {
+		w := NewWriter(io.Discard)
+		w.SetPrefixFunc(c.Prefix)
+		for _, word := range c.Words {
+			if err := w.AddWord(word); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		for _, f := range c.Files {
+			if _, err := w.CreateDicthtml(f); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := w.Close(); c.Err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", c.Words, err)
+		} else if c.Err != "" && (err == nil || err.Error() != c.Err) {
+			t.Errorf("%q: expected error %q, got %v", c.Words, c.Err, err)
+		}
+	}
+}